@@ -11,7 +11,7 @@ URL: https://github.com/Donders-Institute/%{name}
 Source0: https://github.com/Donders-Institute/%{name}/archive/%{version}.tar.gz
 
 BuildArch: x86_64
-Requires: libcap acl nfs4-acl-tools
+Requires: libcap
 
 # defin the GOPATH that is created later within the extracted source code.
 %define gopath %{_tmppath}/go.rpmbuild-%{name}-%{version}
@@ -42,6 +42,9 @@ install -m 755 %{gopath}/bin/pacs_streamdata %{buildroot}/%{_sbindir}/pacs_strea
 install -m 755 %{gopath}/bin/prj_setacl %{buildroot}/%{_bindir}/prj_setacl
 install -m 755 %{gopath}/bin/prj_getacl %{buildroot}/%{_bindir}/prj_getacl
 install -m 755 %{gopath}/bin/prj_delacl %{buildroot}/%{_bindir}/prj_delacl
+install -m 755 %{gopath}/bin/prj_applyacl %{buildroot}/%{_bindir}/prj_applyacl
+install -m 755 %{gopath}/bin/prj_exportacl %{buildroot}/%{_bindir}/prj_exportacl
+install -m 755 %{gopath}/bin/prj_importacl %{buildroot}/%{_bindir}/prj_importacl
 install -m 755 %{gopath}/bin/prj_chown  %{buildroot}/%{_bindir}/prj_chown
 
 %files
@@ -54,6 +57,9 @@ install -m 755 %{gopath}/bin/prj_chown  %{buildroot}/%{_bindir}/prj_chown
 %{_bindir}/prj_setacl
 %{_bindir}/prj_getacl
 %{_bindir}/prj_delacl
+%{_bindir}/prj_applyacl
+%{_bindir}/prj_exportacl
+%{_bindir}/prj_importacl
 %{_bindir}/prj_chown
 #%{_sysconfdir}/bash_completion.d/hpcutil
 
@@ -61,6 +67,9 @@ install -m 755 %{gopath}/bin/prj_chown  %{buildroot}/%{_bindir}/prj_chown
 echo "setting linux capabilities for ACL utilities ..."
 setcap cap_fowner,cap_sys_admin+eip %{_bindir}/prj_delacl
 setcap cap_fowner,cap_sys_admin+eip %{_bindir}/prj_setacl
+setcap cap_fowner,cap_sys_admin+eip %{_bindir}/prj_applyacl
+setcap cap_fowner,cap_sys_admin+eip %{_bindir}/prj_importacl
+setcap cap_sys_admin+eip %{_bindir}/prj_exportacl
 setcap cap_sys_admin+eip %{_bindir}/prj_getacl
 setcap cap_chown+eip %{_bindir}/prj_chown
 
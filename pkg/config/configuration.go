@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/spf13/viper"
 )
@@ -19,6 +20,7 @@ type Configuration struct {
 	Repository    RepositoryConfiguration
 	VolumeManager VolumeManagerConfiguration
 	SMTP          SMTPConfiguration
+	Storage       StorageConfiguration
 }
 
 // LoadConfig reads configuration file `cpath` and returns the
@@ -42,10 +44,27 @@ func LoadConfig(cpath string) (Configuration, error) {
 		return conf, fmt.Errorf("Error reading config file, %s", err)
 	}
 
+	// the fake project database can be referred by name.
+	if strings.EqualFold(viper.GetString("pdb.version"), "fake") {
+		viper.Set("pdb.version", PDBVersionFake)
+	}
+
 	err = viper.Unmarshal(&conf)
 	if err != nil {
 		return conf, fmt.Errorf("unable to decode into struct, %v", err)
 	}
 
+	if !viper.IsSet("pdb.version") {
+		conf.PDB.Version = PDBVersionUnset
+	}
+
+	// use the built-in storage systems if they are not declared.
+	if len(conf.Storage.Systems) == 0 {
+		conf.Storage = DefaultStorageConfiguration()
+	}
+	if conf.Storage.Default == "" {
+		conf.Storage.Default = conf.Storage.Systems[0].Name
+	}
+
 	return conf, nil
 }
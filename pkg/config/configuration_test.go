@@ -1,7 +1,9 @@
 package config
 
 import (
+	"io/ioutil"
 	"os"
+	"path/filepath"
 	"testing"
 
 	log "github.com/Donders-Institute/tg-toolset-golang/pkg/logger"
@@ -54,3 +56,52 @@ func TestRepositoryConfig(t *testing.T) {
 	}
 
 }
+
+func TestStorageConfig(t *testing.T) {
+
+	t.Logf("Storage config: %+v\n", testConf.Storage)
+
+	if testConf.Storage.ProjectRoot() != "/project" {
+		t.Errorf("unexpected project root of the default storage system: %s", testConf.Storage.ProjectRoot())
+	}
+
+	s, err := testConf.Storage.System("cephfs")
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if s.Roler != "cephfs" || s.ProjectRoot != "/project_cephfs" {
+		t.Errorf("unexpected cephfs storage system: %+v", s)
+	}
+}
+
+func TestPDBVersionConfig(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// the `fake` version is set into viper, and therefore comes last.
+	for _, c := range []struct {
+		content string
+		version int
+	}{
+		{"pdb:\n  v1:\n    db_host: localhost\n", PDBVersionUnset},
+		{"pdb:\n  version: 0\n", PDBVersionFake},
+		{"pdb:\n  version: 2\n", 2},
+		{"pdb:\n  version: fake\n", PDBVersionFake},
+	} {
+		cpath := filepath.Join(dir, "config.yml")
+		if err := ioutil.WriteFile(cpath, []byte(c.content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		conf, err := LoadConfig(cpath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if conf.PDB.Version != c.version {
+			t.Errorf("expect pdb version %d, got %d: %q", c.version, conf.PDB.Version, c.content)
+		}
+	}
+}
@@ -1,10 +1,19 @@
 package config
 
+// PDBVersionFake is the `Version` of the fake project database loaded from a fixture
+// file.  It can also be specified as `fake` in the configuration file.
+const PDBVersionFake = 0
+
+// PDBVersionUnset is the `Version` loaded by `LoadConfig` from a configuration file without
+// the version, so that it doesn't select the fake project database.
+const PDBVersionUnset = -1
+
 // PDBConfiguration defines the configuration parameters for project database.
 type PDBConfiguration struct {
 	Version int
 	V1      DBConfiguration
 	V2      CoreAPIConfiguration
+	Fake    FakePDBConfiguration
 }
 
 // CoreAPIConfiguration defines the configuration parameters for the core api of the project database v2.
@@ -13,3 +22,9 @@ type CoreAPIConfiguration struct {
 	AuthURL          string `mapstructure:"auth_url"`
 	CoreAPIURL       string `mapstructure:"core_api_url"`
 }
+
+// FakePDBConfiguration defines the configuration parameters for the fake project database.
+type FakePDBConfiguration struct {
+	// Fixture is the path of the YAML or JSON file with the content of the fake project database.
+	Fixture string
+}
@@ -0,0 +1,98 @@
+package config
+
+import "fmt"
+
+// StorageConfiguration is the data structure for marshaling the
+// storage configuration sessions of the config.yml file
+// using the viper configuration framework.
+type StorageConfiguration struct {
+	// Default is the name of the storage system in which the project directories
+	// are resolved by default.  It defaults to the first storage system.
+	Default string `mapstructure:"default"`
+	// Systems are the storage systems providing the project storage.
+	Systems []StorageSystemConfiguration `mapstructure:"systems"`
+}
+
+// StorageSystemConfiguration is the data structure for marshaling the
+// configuration of a storage system.
+type StorageSystemConfiguration struct {
+	// Name is the name of the storage system, e.g. `netapp`.  It is the storage
+	// system referred by the project database.
+	Name string `mapstructure:"name"`
+	// ProjectRoot is the mount point in which the project directories are organized.
+	ProjectRoot string `mapstructure:"project_root"`
+	// MountPoints are other mount points of the storage system on which the roles
+	// are managed, e.g. `/groupshare`.
+	MountPoints []string `mapstructure:"mount_points"`
+	// Roler is the type of the roler managing the roles on the mount points:
+	// `netapp`, `freenas`, `cephfs` or `posix` (i.e. a plain filesystem with POSIX ACL).
+	Roler string `mapstructure:"roler"`
+	// VolumeManager is the type of the volume manager provisioning the project volumes
+	// in the project root, e.g. `netapp`.  It is empty if the project volumes are not
+	// provisioned by a volume manager.
+	VolumeManager string `mapstructure:"volume_manager"`
+}
+
+// DefaultStorageConfiguration returns the storage configuration used when the
+// configuration file has no storage section.
+func DefaultStorageConfiguration() StorageConfiguration {
+	return StorageConfiguration{
+		Default: "netapp",
+		Systems: []StorageSystemConfiguration{
+			{
+				Name:          "netapp",
+				ProjectRoot:   "/project",
+				MountPoints:   []string{"/groupshare"},
+				Roler:         "netapp",
+				VolumeManager: "netapp",
+			},
+			{
+				Name:        "freenas",
+				ProjectRoot: "/project_freenas",
+				Roler:       "freenas",
+			},
+			{
+				Name:        "cephfs",
+				ProjectRoot: "/project_cephfs",
+				Roler:       "cephfs",
+			},
+		},
+	}
+}
+
+// System returns the configuration of the storage system with the given `name`.
+func (c StorageConfiguration) System(name string) (StorageSystemConfiguration, error) {
+	for _, s := range c.Systems {
+		if s.Name == name {
+			return s, nil
+		}
+	}
+	return StorageSystemConfiguration{}, fmt.Errorf("unsupported storage system: %s", name)
+}
+
+// SystemNames returns the names of the storage systems.
+func (c StorageConfiguration) SystemNames() []string {
+	names := make([]string, 0, len(c.Systems))
+	for _, s := range c.Systems {
+		names = append(names, s.Name)
+	}
+	return names
+}
+
+// ProjectRoot returns the project root of the default storage system.
+func (c StorageConfiguration) ProjectRoot() string {
+	s, err := c.System(c.Default)
+	if err != nil {
+		return ""
+	}
+	return s.ProjectRoot
+}
+
+// Paths returns the project root and the other mount points of the storage system.
+func (s StorageSystemConfiguration) Paths() []string {
+	paths := []string{}
+	if s.ProjectRoot != "" {
+		paths = append(paths, s.ProjectRoot)
+	}
+	return append(paths, s.MountPoints...)
+}
@@ -4,7 +4,9 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"syscall"
+	"time"
 	"unsafe"
 )
 
@@ -41,22 +43,48 @@ func clen(n []byte) int {
 // If mode is provided, both root and mode are respected. Otherwise, the root is stated to
 // retrieve its FileMode.  If the root is a symbolic link, the returned FilePathInfo contains
 // information and path referring to the referent of the link.
-func fastWalk(root string, mode *os.FileMode, followLink bool, skipFiles bool, chanP *chan FilePathMode) {
+//
+// The parent is the directory in which the root is found; it is empty for the top-level root.
+// The depth is the number of directory levels of the root below the top-level root.
+func fastWalk(root string, mode *os.FileMode, parent string, depth int, opts *WalkOptions, chanP *chan FilePathMode) {
 
+	var fpm FilePathMode
 	if mode == nil {
 		// retrieve FileMode when it is not provided by the caller
-		fpm, err := GetFilePathMode(root)
+		p, err := GetFilePathMode(root)
 		if err != nil {
 			return
 		}
 		// respect the path returned so that symlink can be followed on the referent's path.
-		root = filepath.Clean(fpm.Path)
-		*chanP <- *fpm
+		root = filepath.Clean(p.Path)
+		fpm = *p
 	} else {
-		*chanP <- FilePathMode{Path: root, Mode: *mode}
+		fpm = FilePathMode{Path: root, Mode: *mode}
+	}
+
+	if parent != "" && opts.skip(root, depth, fpm.Mode.IsDir()) {
+		logger.Debugf("skip path: %s", root)
+		return
+	}
+
+	opts.push(fpm, parent, chanP)
+
+	if !fpm.Mode.IsDir() {
+		return
 	}
 
+	if opts.Leave != nil {
+		defer opts.Leave(root)
+	}
+
+	// the content of a directory at the maximum depth is left out from the walk.
+	if opts.MaxDepth > 0 && depth >= opts.MaxDepth {
+		return
+	}
+
+	release := opts.Limiter.Acquire()
 	dir, err := os.Open(root)
+	release()
 	if err != nil {
 		logger.Error(fmt.Sprintf("%s", err))
 		return
@@ -69,7 +97,9 @@ func fastWalk(root string, mode *os.FileMode, followLink bool, skipFiles bool, c
 	nbuf := len(buf)
 	for {
 		var errno int
+		release := opts.Limiter.Acquire()
 		nbuf, errno = getdents(int(dir.Fd()), buf)
+		release()
 		if errno != 0 || nbuf <= 0 {
 			return
 		}
@@ -100,16 +130,16 @@ func fastWalk(root string, mode *os.FileMode, followLink bool, skipFiles bool, c
 
 			switch dirent.Type {
 			case syscall.DT_UNKNOWN:
-				if !skipFiles {
-					*chanP <- FilePathMode{Path: vpath, Mode: 0}
+				if !opts.SkipFiles && !opts.skip(vpath, depth+1, false) {
+					opts.push(FilePathMode{Path: vpath, Mode: 0}, root, chanP)
 				}
 			case syscall.DT_REG:
-				if !skipFiles {
-					*chanP <- FilePathMode{Path: vpath, Mode: 0}
+				if !opts.SkipFiles && !opts.skip(vpath, depth+1, false) {
+					opts.push(FilePathMode{Path: vpath, Mode: 0}, root, chanP)
 				}
 			case syscall.DT_DIR:
 				m := os.ModeDir
-				fastWalk(vpath, &m, followLink, skipFiles, chanP)
+				fastWalk(vpath, &m, root, depth+1, opts, chanP)
 			case syscall.DT_LNK:
 
 				// TODO: walk through symlinks is not supported due to issue with
@@ -118,7 +148,7 @@ func fastWalk(root string, mode *os.FileMode, followLink bool, skipFiles bool, c
 				// logger.Warnf("skip symlink: %s\n", vpath)
 				// continue
 
-				if !followLink {
+				if !opts.FollowLink {
 					logger.Warnf("skip symlink: %s\n", vpath)
 					continue
 				}
@@ -138,7 +168,9 @@ func fastWalk(root string, mode *os.FileMode, followLink bool, skipFiles bool, c
 				}
 
 				logger.Warnf("symlink only followed to its first non-symlink referent: %s -> %s\n", vpath, referent)
-				fastWalk(referent, nil, false, skipFiles, chanP)
+				ropts := *opts
+				ropts.FollowLink = false
+				fastWalk(referent, nil, root, depth+1, &ropts, chanP)
 
 			default:
 				logger.Warnf("skip unhandled file: %s (type: %s)", vpath, string(dirent.Type))
@@ -160,11 +192,177 @@ func fastWalk(root string, mode *os.FileMode, followLink bool, skipFiles bool, c
 // Note: This method uses the linux specific way (i.e. syscall.SYS_GETDENT64)
 // of getting directory content.  Thus it can only be used with $GOOS=linux.
 func GoFastWalk(root string, followLink bool, skipFiles bool, buffer int) chan FilePathMode {
+	return GoFastWalkWithOptions(root, WalkOptions{FollowLink: followLink, SkipFiles: skipFiles}, buffer)
+}
+
+// WalkOptions controls how GoFastWalkWithOptions walks through the filesystem tree.
+type WalkOptions struct {
+	// FollowLink specifies whether a symbolic link is followed to its first non-symlink referent.
+	FollowLink bool
+	// SkipFiles specifies whether files are left out from the walk; only directories are visited.
+	SkipFiles bool
+	// SkipDir is called on every sub-directory before it is visited.  The sub-directory and
+	// its content are left out from the walk if it returns true.
+	SkipDir func(dir string) bool
+	// Visit is called on every path right before it is pushed to the channel, with the
+	// directory in which the path is found.  The directory is empty for the top-level root.
+	Visit func(p FilePathMode, dir string)
+	// Leave is called on every directory after all of its content has been pushed to
+	// the channel.
+	Leave func(dir string)
+	// Include are the glob patterns of the files to be walked.  If specified, the files not
+	// matching any of the patterns are left out from the walk; the directories are always
+	// walked into.  See `Exclude` for how the patterns are matched.
+	Include []string
+	// Exclude are the glob patterns of the files and directories to be left out from the walk,
+	// together with the content of the directories.  A pattern without path separator (e.g.
+	// `*.tmp`) is matched against the base name of a path; otherwise (e.g. `derived/*`) it is
+	// matched against the path relative to the top-level root.
+	Exclude []string
+	// MaxDepth is the maximum number of directory levels below the top-level root to be walked.
+	// The default 0 means no limit.
+	MaxDepth int
+	// SameFilesystem specifies whether the walk is restricted to the filesystem of the
+	// top-level root, leaving out the directories on which another filesystem is mounted.
+	SameFilesystem bool
+	// SkipSnapshots specifies whether the snapshot directories (see `SnapshotDirs`) are left
+	// out from the walk.  They are walked into by default, like any other directory.
+	SkipSnapshots bool
+	// ChangedSince is the time since which the files to be walked are changed.  If specified,
+	// the files of which both the modification and the status change (ctime) times are before
+	// it are left out from the walk; the directories are always walked into.  The files of
+	// a directory tree renamed (moved) into the walked tree keep both times, and are left out.
+	ChangedSince time.Time
+	// Limiter limits the rate of the filesystem operations of the walk.  It can be shared
+	// with the workers acting on the walked paths.
+	Limiter *RateLimiter
+
+	// top is the top-level root of the walk.
+	top string
+	// dev is the device of the filesystem of the top-level root.
+	dev uint64
+}
+
+// SnapshotDirs are the names of the snapshot directories exposed by the filers, e.g.
+// `.snapshot` of NetApp and `.zfs` of ZFS.
+var SnapshotDirs = []string{".snapshot", ".zfs"}
+
+// Validate checks the glob patterns of the Include and Exclude options.
+func (opts WalkOptions) Validate() error {
+	for _, p := range append(append([]string{}, opts.Include...), opts.Exclude...) {
+		if _, err := filepath.Match(p, ""); err != nil {
+			return fmt.Errorf("invalid pattern %q: %s", p, err)
+		}
+	}
+	return nil
+}
+
+// skip checks whether the `path` found at the `depth` below the top-level root is left out
+// from the walk.  The `isDir` flag indicates whether the path is a directory.
+func (opts *WalkOptions) skip(path string, depth int, isDir bool) bool {
+
+	if opts.MaxDepth > 0 && depth > opts.MaxDepth {
+		return true
+	}
+
+	if opts.matchAny(opts.Exclude, path) {
+		return true
+	}
+
+	if !isDir {
+		if len(opts.Include) > 0 && !opts.matchAny(opts.Include, path) {
+			return true
+		}
+		return !opts.changed(path)
+	}
+
+	if opts.SkipSnapshots {
+		for _, s := range SnapshotDirs {
+			if filepath.Base(path) == s {
+				return true
+			}
+		}
+	}
+
+	if opts.SameFilesystem && opts.dev != 0 {
+		var st syscall.Stat_t
+		if err := syscall.Lstat(path, &st); err == nil && uint64(st.Dev) != opts.dev {
+			return true
+		}
+	}
+
+	return opts.SkipDir != nil && opts.SkipDir(path)
+}
+
+// changed checks whether the file `path` is changed since the ChangedSince time.  A file
+// that cannot be stated is considered as changed, so that the error is left to the caller.
+func (opts *WalkOptions) changed(path string) bool {
+	if opts.ChangedSince.IsZero() {
+		return true
+	}
+
+	var st syscall.Stat_t
+	release := opts.Limiter.Acquire()
+	err := syscall.Stat(path, &st)
+	release()
+	if err != nil {
+		return true
+	}
+
+	since := opts.ChangedSince.UnixNano()
+	return st.Mtim.Nano() >= since || st.Ctim.Nano() >= since
+}
+
+// matchAny checks whether the `path` matches any of the glob `patterns`.
+func (opts *WalkOptions) matchAny(patterns []string, path string) bool {
+	if len(patterns) == 0 {
+		return false
+	}
+
+	rel, err := filepath.Rel(opts.top, path)
+	if err != nil {
+		rel = path
+	}
+
+	for _, p := range patterns {
+		name := rel
+		if !strings.Contains(p, separator) {
+			name = filepath.Base(path)
+		}
+		if ok, _ := filepath.Match(p, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// push calls the Visit function, if any, and pushes the path to the channel.
+func (opts *WalkOptions) push(p FilePathMode, dir string, chanP *chan FilePathMode) {
+	if opts.Visit != nil {
+		opts.Visit(p, dir)
+	}
+	*chanP <- p
+}
+
+// GoFastWalkWithOptions is GoFastWalk with the walk controlled by the given WalkOptions.
+func GoFastWalkWithOptions(root string, opts WalkOptions, buffer int) chan FilePathMode {
 
 	chanP := make(chan FilePathMode, buffer)
 
+	// the top-level root is resolved in the same way as in the walk.
+	opts.top = filepath.Clean(root)
+	if p, err := GetFilePathMode(root); err == nil {
+		opts.top = filepath.Clean(p.Path)
+	}
+	if opts.SameFilesystem {
+		var st syscall.Stat_t
+		if err := syscall.Stat(root, &st); err == nil {
+			opts.dev = uint64(st.Dev)
+		}
+	}
+
 	go func() {
-		fastWalk(root, nil, followLink, skipFiles, &chanP)
+		fastWalk(root, nil, "", 0, &opts, &chanP)
 		defer close(chanP)
 	}()
 
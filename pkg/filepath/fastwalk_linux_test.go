@@ -0,0 +1,98 @@
+package filepath
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+// walkRel walks through the `root` with the given options, and returns the walked paths
+// relative to the `root`.
+func walkRel(root string, opts WalkOptions) []string {
+	var paths []string
+	for p := range GoFastWalkWithOptions(root, opts, 4) {
+		rel, _ := filepath.Rel(root, p.Path)
+		paths = append(paths, rel)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+func TestWalkFilters(t *testing.T) {
+	root, err := ioutil.TempDir("", "fastwalk")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	for _, d := range []string{".snapshot/hourly", "raw/sub", "derived"} {
+		if err := os.MkdirAll(filepath.Join(root, d), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, f := range []string{"a.txt", "b.tmp", "raw/c.nii", "raw/sub/d.nii", "derived/e.nii", ".snapshot/hourly/a.txt"} {
+		if err := ioutil.WriteFile(filepath.Join(root, f), []byte{}, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cases := []struct {
+		name  string
+		opts  WalkOptions
+		paths []string
+	}{
+		{"default", WalkOptions{}, []string{".", ".snapshot", ".snapshot/hourly", ".snapshot/hourly/a.txt", "a.txt", "b.tmp", "derived", "derived/e.nii", "raw", "raw/c.nii", "raw/sub", "raw/sub/d.nii"}},
+		{"exclude", WalkOptions{SkipSnapshots: true, Exclude: []string{"*.tmp", "derived"}}, []string{".", "a.txt", "raw", "raw/c.nii", "raw/sub", "raw/sub/d.nii"}},
+		{"exclude relative", WalkOptions{SkipSnapshots: true, Exclude: []string{"raw/*"}}, []string{".", "a.txt", "b.tmp", "derived", "derived/e.nii", "raw"}},
+		{"include", WalkOptions{SkipSnapshots: true, Include: []string{"*.nii"}}, []string{".", "derived", "derived/e.nii", "raw", "raw/c.nii", "raw/sub", "raw/sub/d.nii"}},
+		{"max depth", WalkOptions{SkipSnapshots: true, MaxDepth: 1}, []string{".", "a.txt", "b.tmp", "derived", "raw"}},
+		{"same filesystem", WalkOptions{SkipSnapshots: true, SameFilesystem: true, MaxDepth: 1}, []string{".", "a.txt", "b.tmp", "derived", "raw"}},
+		{"skip snapshots", WalkOptions{SkipSnapshots: true, MaxDepth: 1}, []string{".", "a.txt", "b.tmp", "derived", "raw"}},
+	}
+
+	for _, c := range cases {
+		if paths := walkRel(root, c.opts); !reflect.DeepEqual(paths, c.paths) {
+			t.Errorf("%s: expect %v but got %v", c.name, c.paths, paths)
+		}
+	}
+
+	if err := (WalkOptions{Exclude: []string{"[a-"}}).Validate(); err == nil {
+		t.Errorf("expect invalid pattern error")
+	}
+}
+
+func TestWalkChangedSince(t *testing.T) {
+	root, err := ioutil.TempDir("", "fastwalk")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	if err := os.MkdirAll(filepath.Join(root, "raw"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range []string{"a.txt", "raw/b.nii"} {
+		if err := ioutil.WriteFile(filepath.Join(root, f), []byte{}, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// leave a margin for the coarse granularity of the file timestamps.
+	time.Sleep(50 * time.Millisecond)
+	since := time.Now()
+	time.Sleep(50 * time.Millisecond)
+
+	if err := ioutil.WriteFile(filepath.Join(root, "raw/c.nii"), []byte{}, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// the unchanged files are left out, the directories are always walked.
+	expected := []string{".", "raw", "raw/c.nii"}
+	if paths := walkRel(root, WalkOptions{ChangedSince: since}); !reflect.DeepEqual(paths, expected) {
+		t.Errorf("expect %v but got %v", expected, paths)
+	}
+}
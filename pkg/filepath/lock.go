@@ -1,28 +1,205 @@
 package filepath
 
 import (
-	"errors"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"os/user"
+	"path/filepath"
+	"syscall"
+	"time"
 )
 
+// lockPollInterval is the interval at which AcquireLockWait checks the lock.
+var lockPollInterval = time.Second
+
+// Lock is a data structure containing the information of a lock file.
+type Lock struct {
+	// Path is the path of the lock file.
+	Path string
+	// User is the name of the user holding the lock.
+	User string
+	// Host is the name of the host on which the lock is created.
+	Host string
+	// PID is the id of the process holding the lock.
+	PID int
+	// Created is the modification time of the lock file.
+	Created time.Time
+}
+
+// String returns a single-line representation of the lock.
+func (l Lock) String() string {
+	return fmt.Sprintf("%s (user: %s, host: %s, pid: %d, since: %s)",
+		l.Path, l.User, l.Host, l.PID, l.Created.Format(time.RFC3339))
+}
+
+// IsLocal checks whether the lock is created on the current host.
+func (l Lock) IsLocal() bool {
+	h, _ := os.Hostname()
+	return h == l.Host
+}
+
+// IsStale checks whether the lock is left behind by a process that is no longer running.
+// Only a lock created on the current host can be determined as stale; a lock from another
+// host is never stale.
+func (l Lock) IsStale() bool {
+	if !l.IsLocal() {
+		return false
+	}
+	// signal 0 checks the existence of the process without sending a signal.
+	return syscall.Kill(l.PID, 0) == syscall.ESRCH
+}
+
+// ErrLocked is the error returned when the lock is held by another process.
+type ErrLocked struct {
+	Lock Lock
+}
+
+func (e *ErrLocked) Error() string {
+	return fmt.Sprintf("program locked due to incomplete or on-going run on the same project: %s", e.Lock)
+}
+
+// ReadLock reads the information of the lock file at the path specified by the flock argument.
+// The content of the lock file is expected to be `user host pid`.
+func ReadLock(flock string) (*Lock, error) {
+	data, err := ioutil.ReadFile(flock)
+	if err != nil {
+		return nil, err
+	}
+
+	fi, err := os.Stat(flock)
+	if err != nil {
+		return nil, err
+	}
+
+	l := Lock{Path: flock, Created: fi.ModTime()}
+	if _, err := fmt.Sscanf(string(data), "%s %s %d", &l.User, &l.Host, &l.PID); err != nil {
+		return nil, fmt.Errorf("invalid lock content: %s", flock)
+	}
+
+	return &l, nil
+}
+
 // AcquireLock creates a lock file at the path specified by the flock argument, and writes a piece of information to the file.
 // The information contains: 1) current user id, 2) hostname, and 3) the current process id.
+//
+// If the lock file exists but is stale (see `Lock.IsStale`), it is replaced (see
+// `replaceStaleLock`). Otherwise the returned error is of type `*ErrLocked`.
 func AcquireLock(flock string) error {
-	if _, err := os.Stat(flock); err == nil {
-		s := fmt.Sprintf("program locked due to incomplete or on-going run on the same project!\n\nRemove %s and run again!!\n", flock)
-		return errors.New(s)
+
+	f, err := os.OpenFile(flock, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+
+	if os.IsExist(err) {
+		return replaceStaleLock(flock)
 	}
 
-	f, err := os.Create(flock)
 	if err != nil {
 		return err
 	}
-	u, _ := user.Current()
-	h, _ := os.Hostname()
-	s := fmt.Sprintf("%s %s %d", u.Username, h, os.Getpid())
-	f.WriteString(s)
+
+	f.WriteString(lockContent())
 	f.Close()
 	return nil
 }
+
+// lockContent returns the content of the lock file created by the current process.
+func lockContent() string {
+	u, _ := user.Current()
+	h, _ := os.Hostname()
+	return fmt.Sprintf("%s %s %d", u.Username, h, os.Getpid())
+}
+
+// replaceStaleLock replaces the existing lock file at the path specified by the flock argument
+// with the lock of the current process, if the existing lock is stale.
+//
+// Processes finding the same stale lock may try to replace it at the same time.  For only one
+// of them to win, the stale lock is checked and replaced while holding an exclusive `flock(2)`
+// on it.  The new lock is written into a temporary file and renamed over the stale lock, so
+// that the lock file never disappears nor appears without content.  A process acquiring the
+// `flock(2)` after the replacement finds the path no longer referring to the stale lock, and
+// the lock is considered held by the winner.
+func replaceStaleLock(flock string) error {
+
+	f, err := os.Open(flock)
+	if err != nil {
+		// the lock may be just released by another process.
+		logger.Debugf("cannot open lock: %s", err)
+		return &ErrLocked{Lock: Lock{Path: flock}}
+	}
+	defer f.Close()
+
+	// the flock is released when the file is closed.
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err != nil {
+		return fmt.Errorf("cannot flock %s: %s", flock, err)
+	}
+
+	// the lock file has been replaced or removed by another process.
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if pi, err := os.Stat(flock); err != nil || !os.SameFile(fi, pi) {
+		l, rerr := ReadLock(flock)
+		if rerr != nil {
+			return &ErrLocked{Lock: Lock{Path: flock}}
+		}
+		return &ErrLocked{Lock: *l}
+	}
+
+	l, err := ReadLock(flock)
+	if err != nil {
+		// the lock may be just created by another process and not yet written.
+		logger.Debugf("cannot read lock: %s", err)
+		return &ErrLocked{Lock: Lock{Path: flock}}
+	}
+	if !l.IsStale() {
+		return &ErrLocked{Lock: *l}
+	}
+	logger.Warnf("replacing stale lock: %s", l)
+
+	tmp, err := ioutil.TempFile(filepath.Dir(flock), filepath.Base(flock)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.WriteString(lockContent())
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), flock)
+}
+
+// AcquireLockWait is AcquireLock that waits for the lock held by another process to be released,
+// until the given timeout is reached.  A timeout of 0 means no waiting.
+func AcquireLockWait(flock string, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		err := AcquireLock(flock)
+		if _, ok := err.(*ErrLocked); !ok || !time.Now().Before(deadline) {
+			return err
+		}
+		logger.Debugf("waiting for lock: %s", flock)
+		time.Sleep(lockPollInterval)
+	}
+}
+
+// BreakLock removes the lock file at the path specified by the flock argument.  A lock held
+// by a running process, or created on another host, is only removed if `force` is true.
+func BreakLock(flock string, force bool) error {
+	l, err := ReadLock(flock)
+	if err == nil && !force && !l.IsStale() {
+		return &ErrLocked{Lock: *l}
+	}
+	if err != nil && !force {
+		return err
+	}
+	return os.Remove(flock)
+}
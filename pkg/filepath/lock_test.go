@@ -0,0 +1,112 @@
+package filepath
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestAcquireLock(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	flock := filepath.Join(dir, "test.lock")
+
+	if err := AcquireLock(flock); err != nil {
+		t.Fatalf("cannot acquire lock: %s", err)
+	}
+
+	l, err := ReadLock(flock)
+	if err != nil {
+		t.Fatalf("cannot read lock: %s", err)
+	}
+	if l.PID != os.Getpid() || !l.IsLocal() || l.IsStale() {
+		t.Errorf("unexpected lock: %s", l)
+	}
+
+	// lock held by the running process
+	if _, ok := AcquireLockWait(flock, 10*time.Millisecond).(*ErrLocked); !ok {
+		t.Errorf("expect lock to be held")
+	}
+	if _, ok := BreakLock(flock, false).(*ErrLocked); !ok {
+		t.Errorf("expect active lock not to be broken")
+	}
+
+	// stale lock left behind by a process no longer running
+	h, _ := os.Hostname()
+	if err := ioutil.WriteFile(flock, []byte(fmt.Sprintf("nobody %s %d", h, 1<<22+1)), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := AcquireLock(flock); err != nil {
+		t.Errorf("expect stale lock to be replaced: %s", err)
+	}
+
+	if err := BreakLock(flock, true); err != nil {
+		t.Errorf("cannot break lock: %s", err)
+	}
+	if _, err := os.Stat(flock); !os.IsNotExist(err) {
+		t.Errorf("expect lock removed: %s", flock)
+	}
+}
+
+func TestAcquireLockStaleConcurrent(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	flock := filepath.Join(dir, "test.lock")
+
+	// stale lock left behind by a process no longer running
+	h, _ := os.Hostname()
+	if err := ioutil.WriteFile(flock, []byte(fmt.Sprintf("nobody %s %d", h, 1<<22+1)), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// callers replacing the same stale lock at the same time
+	n := 64
+	errs := make(chan error, n)
+	start := make(chan struct{})
+	for i := 0; i < n; i++ {
+		go func() {
+			<-start
+			errs <- AcquireLock(flock)
+		}()
+	}
+	close(start)
+
+	won := 0
+	for i := 0; i < n; i++ {
+		err := <-errs
+		if err == nil {
+			won++
+			continue
+		}
+		if _, ok := err.(*ErrLocked); !ok {
+			t.Errorf("unexpected error: %s", err)
+		}
+	}
+	if won != 1 {
+		t.Errorf("expect exactly one caller to acquire the lock, got %d", won)
+	}
+
+	l, err := ReadLock(flock)
+	if err != nil {
+		t.Fatalf("cannot read lock: %s", err)
+	}
+	if l.PID != os.Getpid() {
+		t.Errorf("unexpected lock: %s", l)
+	}
+
+	// no temporary files are left behind
+	if fs, _ := ioutil.ReadDir(dir); len(fs) != 1 {
+		t.Errorf("expect only the lock file in %s, got %d files", dir, len(fs))
+	}
+}
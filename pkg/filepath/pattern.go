@@ -0,0 +1,36 @@
+package filepath
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// Patterns is a list of glob patterns, e.g. for the Include and Exclude walk options.  It
+// implements the `flag.Value` interface, taking a comma-separated list of patterns; the
+// patterns of a repeated flag are appended to the list.
+type Patterns []string
+
+// String returns the comma-separated list of the patterns.
+func (p *Patterns) String() string {
+	return strings.Join(*p, ",")
+}
+
+// Set appends the comma-separated list of patterns `v` to the list.
+func (p *Patterns) Set(v string) error {
+	for _, s := range strings.Split(v, ",") {
+		if s == "" {
+			continue
+		}
+		if _, err := filepath.Match(s, ""); err != nil {
+			return fmt.Errorf("invalid pattern %q: %s", s, err)
+		}
+		*p = append(*p, s)
+	}
+	return nil
+}
+
+// Type returns the type name of the flag value, as required by the `pflag.Value` interface.
+func (p *Patterns) Type() string {
+	return "patterns"
+}
@@ -0,0 +1,212 @@
+package filepath
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RateLimiter limits the filesystem operations by the number of operations per second and
+// the number of concurrent operations.  It is safe for concurrent use, so that it can be
+// shared by the walks and the workers acting on the walked paths.  The limits can be
+// adjusted while the operations are running.  A nil RateLimiter imposes no limit.
+type RateLimiter struct {
+	mutex sync.Mutex
+	cond  *sync.Cond
+
+	// rate is the maximum number of operations per second; 0 for no limit.
+	rate float64
+	// concurrency is the maximum number of concurrent operations; 0 for no limit.
+	concurrency int
+	// baseRate is the rate set by `SetLimits`, restored once the rate is sped up again
+	// after being slowed down.
+	baseRate float64
+	// level is the number of times the rate is slowed down from the baseRate.
+	level int
+
+	// active is the number of operations in progress.
+	active int
+	// next is the earliest time at which the next operation can start.
+	next time.Time
+	// ops is the number of operations started since the last adjustment of the rate.
+	ops int64
+	// since is the time of the last adjustment of the rate.
+	since time.Time
+}
+
+// NewRateLimiter creates a RateLimiter allowing at most `rate` operations per second and
+// `concurrency` concurrent operations.  The value 0 means no limit.
+func NewRateLimiter(rate float64, concurrency int) *RateLimiter {
+	l := &RateLimiter{}
+	l.cond = sync.NewCond(&l.mutex)
+	l.SetLimits(rate, concurrency)
+	return l
+}
+
+// Acquire blocks until an operation is allowed to start by the limits, and returns the
+// function to be called when the operation is completed.
+func (l *RateLimiter) Acquire() (release func()) {
+	if l == nil {
+		return func() {}
+	}
+
+	l.mutex.Lock()
+	for l.concurrency > 0 && l.active >= l.concurrency {
+		l.cond.Wait()
+	}
+	l.active++
+	l.ops++
+
+	var wait time.Duration
+	if l.rate > 0 {
+		now := time.Now()
+		if l.next.Before(now) {
+			l.next = now
+		}
+		wait = l.next.Sub(now)
+		l.next = l.next.Add(time.Duration(float64(time.Second) / l.rate))
+	}
+	l.mutex.Unlock()
+
+	time.Sleep(wait)
+
+	return func() {
+		l.mutex.Lock()
+		l.active--
+		l.cond.Signal()
+		l.mutex.Unlock()
+	}
+}
+
+// Limits returns the current limits of the operations per second and the concurrent
+// operations.
+func (l *RateLimiter) Limits() (rate float64, concurrency int) {
+	if l == nil {
+		return 0, 0
+	}
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.rate, l.concurrency
+}
+
+// SetLimits sets the limits of the operations per second and the concurrent operations.
+// The value 0 means no limit.  Negative values are taken as 0.
+func (l *RateLimiter) SetLimits(rate float64, concurrency int) {
+	if rate < 0 {
+		rate = 0
+	}
+	if concurrency < 0 {
+		concurrency = 0
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.rate, l.baseRate, l.level = rate, rate, 0
+	l.concurrency = concurrency
+	l.reset()
+	l.cond.Broadcast()
+}
+
+// SlowDown halves the rate of the operations, and returns the new rate.  Without a rate
+// limit, the rate is halved from the rate measured since the last adjustment.  The rate is
+// left unchanged if it cannot be measured as no operation has taken place.
+func (l *RateLimiter) SlowDown() float64 {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	rate := l.rate
+	if rate == 0 {
+		if elapsed := time.Since(l.since).Seconds(); l.ops > 0 && elapsed > 0 {
+			rate = float64(l.ops) / elapsed
+		}
+	}
+	if rate == 0 {
+		return l.rate
+	}
+
+	l.rate = rate / 2
+	l.level++
+	l.reset()
+	return l.rate
+}
+
+// SpeedUp reverts the last SlowDown by doubling the rate of the operations, and returns
+// the new rate.  The rate set by `SetLimits` is restored once every SlowDown is reverted.
+func (l *RateLimiter) SpeedUp() float64 {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.level == 0 {
+		return l.rate
+	}
+
+	l.level--
+	l.rate *= 2
+	if l.level == 0 {
+		l.rate = l.baseRate
+	}
+	l.reset()
+	return l.rate
+}
+
+// reset restarts the measurement and the schedule of the operations after the limits are
+// adjusted.  The caller must hold the mutex.
+func (l *RateLimiter) reset() {
+	l.ops = 0
+	l.since = time.Now()
+	l.next = time.Time{}
+}
+
+// LoadControl sets the limits from the control file `path`.  The control file contains
+// `key = value` lines with the keys `rate` for the operations per second and `concurrency`
+// for the concurrent operations; a key not in the file keeps the limit last set by
+// `SetLimits`, i.e. without the SlowDown.  Empty lines and lines starting with `#` are ignored.
+func (l *RateLimiter) LoadControl(path string) error {
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	l.mutex.Lock()
+	rate, concurrency := l.baseRate, l.concurrency
+	l.mutex.Unlock()
+
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		kv := strings.SplitN(line, "=", 2)
+		if len(kv) != 2 {
+			return fmt.Errorf("invalid control line %d in %s: %q", n, path, line)
+		}
+
+		key, val := strings.TrimSpace(kv[0]), strings.TrimSpace(kv[1])
+		switch key {
+		case "rate":
+			if rate, err = strconv.ParseFloat(val, 64); err != nil || rate < 0 {
+				return fmt.Errorf("invalid rate in %s: %q", path, val)
+			}
+		case "concurrency":
+			if concurrency, err = strconv.Atoi(val); err != nil || concurrency < 0 {
+				return fmt.Errorf("invalid concurrency in %s: %q", path, val)
+			}
+		default:
+			return fmt.Errorf("unknown control key in %s: %q", path, key)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	l.SetLimits(rate, concurrency)
+	return nil
+}
@@ -0,0 +1,111 @@
+package filepath
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+
+	// a nil limiter imposes no limit.
+	var nl *RateLimiter
+	nl.Acquire()()
+
+	// rate limit: 10 operations at 100 per second take at least 90ms.
+	l := NewRateLimiter(100, 0)
+	start := time.Now()
+	for i := 0; i < 10; i++ {
+		l.Acquire()()
+	}
+	if elapsed := time.Since(start); elapsed < 90*time.Millisecond {
+		t.Errorf("operations not limited by the rate: %s", elapsed)
+	}
+
+	// concurrency limit
+	l = NewRateLimiter(0, 2)
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	active, maxActive := 0, 0
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			release := l.Acquire()
+			mutex.Lock()
+			if active++; active > maxActive {
+				maxActive = active
+			}
+			mutex.Unlock()
+			time.Sleep(5 * time.Millisecond)
+			mutex.Lock()
+			active--
+			mutex.Unlock()
+			release()
+		}()
+	}
+	wg.Wait()
+	if maxActive > 2 {
+		t.Errorf("expect at most 2 concurrent operations but got %d", maxActive)
+	}
+
+	// slowing down and speeding up again restores the rate.
+	l = NewRateLimiter(100, 0)
+	if rate := l.SlowDown(); rate != 50 {
+		t.Errorf("expect rate 50 but got %f", rate)
+	}
+	if rate := l.SlowDown(); rate != 25 {
+		t.Errorf("expect rate 25 but got %f", rate)
+	}
+	l.SpeedUp()
+	if rate := l.SpeedUp(); rate != 100 {
+		t.Errorf("expect rate 100 but got %f", rate)
+	}
+	if rate := l.SpeedUp(); rate != 100 {
+		t.Errorf("expect rate not to exceed 100 but got %f", rate)
+	}
+
+	// slowing down without a rate limit derives the rate from the measured rate.
+	l = NewRateLimiter(0, 0)
+	if rate := l.SlowDown(); rate != 0 {
+		t.Errorf("expect no rate limit without operations but got %f", rate)
+	}
+	l.Acquire()()
+	if rate := l.SlowDown(); rate <= 0 {
+		t.Errorf("expect a rate limit but got %f", rate)
+	}
+	if rate := l.SpeedUp(); rate != 0 {
+		t.Errorf("expect no rate limit restored but got %f", rate)
+	}
+}
+
+func TestRateLimiterLoadControl(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ratelimit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	fctl := filepath.Join(dir, "control")
+	l := NewRateLimiter(100, 4)
+
+	if err := ioutil.WriteFile(fctl, []byte("# slow down\nrate = 20\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.LoadControl(fctl); err != nil {
+		t.Fatal(err)
+	}
+	if rate, concurrency := l.Limits(); rate != 20 || concurrency != 4 {
+		t.Errorf("unexpected limits: rate %f, concurrency %d", rate, concurrency)
+	}
+
+	if err := ioutil.WriteFile(fctl, []byte("concurrency = -1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.LoadControl(fctl); err == nil {
+		t.Errorf("expect invalid concurrency error")
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"net/smtp"
 	"text/template"
+	"time"
 
 	"github.com/Donders-Institute/tg-toolset-golang/pkg/config"
 	"github.com/Donders-Institute/tg-toolset-golang/project/pkg/pdb"
@@ -123,6 +124,63 @@ Best regards, the DCCN Technical Group`
 	return sendMail(m.config, from, manager.Email, subject, body)
 }
 
+// ExpiredRole is a time-limited data access role that has expired and been removed.
+type ExpiredRole struct {
+	// Path is the path on which the role was granted.
+	Path string
+	// Principal is the user or group to which the role was granted.
+	Principal string
+	// Role is the name of the role.
+	Role string
+	// Expiry is the time at which the role expired.
+	Expiry time.Time
+}
+
+// NotifyRoleGrantsExpired sends out email notification to `manager` about the time-limited
+// roles `grants` on the project `pid` that have expired and been removed.
+func (m *Mailer) NotifyRoleGrantsExpired(manager pdb.User, pid, pname string, grants []ExpiredRole) error {
+
+	from := "helpdesk@fcdonders.ru.nl"
+	name := fmt.Sprintf("%s %s", manager.Firstname, manager.Lastname)
+	subject := fmt.Sprintf("Expired data access roles removed from your project %s", pid)
+
+	// message template
+	tempStr := `Dear {{.Name}},
+
+You received this notification because you are a manager of the project {{.ProjectID}} with title:
+
+    {{.ProjectName}}
+
+The following time-limited data access roles on the project storage have expired, and have been removed:
+{{range .Grants}}
+    * {{.Principal}} ({{.Role}}) on {{.Path}}, expired at {{.Expiry.Format "2006-01-02 15:04"}}
+{{- end}}
+
+Should the access still be needed, you may grant the roles again following the guide:
+
+    http://dccn-hpc-wiki.readthedocs.io/en/latest/docs/project_storage/access_management.html
+
+Should you have any questions, please don't hesitate to contact the TG helpdesk <helpdesk@fcdonders.ru.nl>.
+
+Best regards, the DCCN Technical Group`
+
+	// data for message template
+	tempData := struct {
+		Name        string
+		ProjectID   string
+		ProjectName string
+		Grants      []ExpiredRole
+	}{name, pid, pname, grants}
+
+	body, err := composeMessageTempstr(tempStr, tempData)
+
+	if err != nil {
+		return err
+	}
+
+	return sendMail(m.config, from, manager.Email, subject, body)
+}
+
 // composeMessage composes a message using the given `tempfile` template file and the `data`
 // provided.
 func composeMessageTempfile(tempfile string, data interface{}) (string, error) {
@@ -0,0 +1,146 @@
+// This program converges the data-access roles of a project storage to the
+// roles declared in a YAML policy file.  Like `prj_setacl`, it uses the linux
+// capabilities for operations granted to project managers when POSIX ACL system
+// is used on the filesystem (e.g. CephFs), and should be set in advance with the
+// following command.
+//
+// ```
+// $ sudo setcap cap_fowner,cap_sys_admin+eip prj_applyacl
+// ```
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	log "github.com/Donders-Institute/tg-toolset-golang/pkg/logger"
+	ustr "github.com/Donders-Institute/tg-toolset-golang/pkg/strings"
+	"github.com/Donders-Institute/tg-toolset-golang/project/pkg/acl"
+)
+
+// global variables from command-line arguments
+var optsBase *string
+var optsConfig *string
+var optsNthreads *int
+var optsForce *bool
+var optsVerbose *bool
+var optsSilence *bool
+var optsFollowLink *bool
+var optsSkipFiles *bool
+var optsDryRun *bool
+var optsLockWait *time.Duration
+
+func init() {
+	optsBase = flag.String("d", "", "set the root path of project storage, default to the project root of the default storage system")
+	optsConfig = flag.String("config", os.Getenv("TG_TOOLSET_CONFIG"), "`path` of the configuration file declaring the storage systems, default to the built-in storage systems")
+	optsNthreads = flag.Int("n", 4, "set number of concurrent processing threads")
+	optsForce = flag.Bool("f", false, "force role setting regardlessly")
+	optsVerbose = flag.Bool("v", false, "print `verbosed` messages")
+	optsSilence = flag.Bool("s", false, "set to `silence` mode")
+	optsFollowLink = flag.Bool("l", false, "`follow` symlink to set roles on its first non-symlink referent")
+	optsSkipFiles = flag.Bool("k", false, "`skip` setting roles on existing files")
+	optsDryRun = flag.Bool("dry-run", false, "report the role changes on every path without applying them")
+	optsLockWait = flag.Duration("lock-wait", 0, "maximum `duration` to wait for the lock held by another run on the same path")
+
+	flag.Usage = usage
+
+	flag.Parse()
+
+	cfg := log.Configuration{
+		EnableConsole:     true,
+		ConsoleJSONFormat: false,
+		ConsoleLevel:      log.Info,
+	}
+
+	if *optsVerbose {
+		cfg.ConsoleLevel = log.Debug
+	}
+
+	// initialize logger
+	log.NewLogger(cfg, log.InstanceLogrusLogger)
+
+	// load the storage systems on which the roles are managed.
+	storage, err := acl.LoadStorage(*optsConfig)
+	if err != nil {
+		log.Fatalf("%s", err)
+	}
+	if *optsBase == "" {
+		*optsBase = storage.ProjectRoot()
+	}
+}
+
+func usage() {
+	fmt.Printf("\nApplying users' access permission declared in policy files on projects.\n")
+	fmt.Printf("\nUSAGE: %s [OPTIONS] policy.yml [policy.yml ...]\n", os.Args[0])
+	fmt.Printf("\nOPTIONS:\n")
+	flag.PrintDefaults()
+	fmt.Printf("\nPOLICY:\n")
+	fmt.Printf("\n%s\n", ustr.StringWrap("The policy file declares the roles on the project root and, optionally, on sub-directories. Users in the roles of a sub-directory are given the traverse role on the parent directories. Unless a sub-directory is 'exclusive', it inherits the roles of the project root.", 80))
+	fmt.Printf(`
+  project: "3010000.01"
+  roles:
+    manager: [honlee]
+    contributor: [edwger]
+  subdirs:
+    - path: raw
+      roles:
+        viewer: [rendbru]
+    - path: private
+      exclusive: true
+      roles:
+        manager: [honlee]
+`)
+	fmt.Printf("\nEXAMPLES:\n")
+	fmt.Printf("\n%s\n", ustr.StringWrap("Converging the roles of the project to the policy in 3010000.01.yml", 80))
+	fmt.Printf("\n  %s 3010000.01.yml\n", os.Args[0])
+	fmt.Printf("\n%s\n", ustr.StringWrap("Showing the role changes to converge the project to the policy, without applying them", 80))
+	fmt.Printf("\n  %s -dry-run 3010000.01.yml\n", os.Args[0])
+	fmt.Printf("\n")
+}
+
+func main() {
+
+	// command-line options
+	args := flag.Args()
+
+	if len(args) < 1 {
+		flag.Usage()
+		log.Fatalf("no policy file: %v", args)
+	}
+
+	// load all policies before applying any of them.
+	policies := make([]*acl.Policy, len(args))
+	for i, f := range args {
+		p, err := acl.LoadPolicy(f)
+		if err != nil {
+			log.Fatalf("%s", err)
+		}
+		policies[i] = p
+	}
+
+	exitcode := 0
+	for i, p := range policies {
+		log.Infof("applying policy %s on %s", args[i], p.RootPath(*optsBase))
+
+		runner := acl.Runner{
+			Force:       *optsForce,
+			FollowLink:  *optsFollowLink,
+			SkipFiles:   *optsSkipFiles,
+			Silence:     *optsSilence,
+			Nthreads:    *optsNthreads,
+			DryRun:      *optsDryRun,
+			LockTimeout: *optsLockWait,
+		}
+
+		ec, err := runner.ApplyPolicy(*p, *optsBase)
+		if err != nil {
+			log.Errorf("%s: %s", args[i], err)
+		}
+		if ec != 0 {
+			exitcode = ec
+		}
+	}
+	os.Exit(exitcode)
+}
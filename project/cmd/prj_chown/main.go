@@ -44,6 +44,11 @@ func init() {
 
 	// initialize logger
 	log.NewLogger(cfg, log.InstanceLogrusLogger)
+
+	// load the storage systems on which the roles are managed.
+	if _, err := acl.LoadStorage(os.Getenv("TG_TOOLSET_CONFIG")); err != nil {
+		log.Fatalf("%s", err)
+	}
 }
 
 func usage() {
@@ -5,8 +5,8 @@
 // - CAP_SYS_ADMIN: for accessing the `trusted.managers` xattr that maintains
 //                  a list of project managers.
 //
-// - CAP_FOWNER: for allowing managers to set ACLs via the `setfacl` command
-//               without being the owner of files and directories.
+// - CAP_FOWNER: for allowing managers to set ACLs on files and directories
+//               without being the owner.
 //
 // In order to allow this trick to work, this executable should be set in
 // advance to allow using the linux capability using the following command.
@@ -22,8 +22,10 @@ import (
 	"os"
 	"path/filepath"
 	"regexp"
+	"time"
 	"strings"
 
+	ufp "github.com/Donders-Institute/tg-toolset-golang/pkg/filepath"
 	log "github.com/Donders-Institute/tg-toolset-golang/pkg/logger"
 	ustr "github.com/Donders-Institute/tg-toolset-golang/pkg/strings"
 	"github.com/Donders-Institute/tg-toolset-golang/project/pkg/acl"
@@ -31,11 +33,11 @@ import (
 
 // global variables from command-line arguments
 var optsBase *string
+var optsConfig *string
 var optsPath *string
 var optsManager *string
 var optsContributor *string
-
-//var optsWriter *string
+var optsWriter *string
 var optsViewer *string
 var optsTraverse *bool
 var optsNthreads *int
@@ -44,14 +46,28 @@ var optsVerbose *bool
 var optsSilence *bool
 var optsFollowLink *bool
 var optsSkipFiles *bool
+var optsDryRun *bool
+var optsJournal *bool
+var optsResume *bool
+var optsLockWait *time.Duration
+var optsRetries *int
+var optsRetryBackoff *time.Duration
+var optsFailures *string
+var optsFromFailures *string
+var optsProgress *time.Duration
+var optsProgressJSON *bool
+var optsRate *float64
+var optsMaxOps *int
+var optsControl *string
 
 func init() {
-	optsManager = flag.String("m", "", "specify a comma-separated-list of users to be removed from the manager role")
-	optsContributor = flag.String("c", "", "specify a comma-separated-list of users to be removed from the contributor role")
-	//optsWriter = flag.String("w", "", "specify a comma-separated-list of users for the writer role")
-	optsViewer = flag.String("u", "", "specify a comma-separated-list of users to be removed from the viewer role")
+	optsManager = flag.String("m", "", "specify a comma-separated-list of users or groups (prefixed with g:) to be removed from the manager role")
+	optsContributor = flag.String("c", "", "specify a comma-separated-list of users or groups (prefixed with g:) to be removed from the contributor role")
+	optsWriter = flag.String("w", "", "specify a comma-separated-list of users or groups (prefixed with g:) to be removed from the writer role")
+	optsViewer = flag.String("u", "", "specify a comma-separated-list of users or groups (prefixed with g:) to be removed from the viewer role")
 	optsTraverse = flag.Bool("t", false, "remove users' traverse permission from the parent directories")
-	optsBase = flag.String("d", "/project", "set the root path of project storage")
+	optsBase = flag.String("d", "", "set the root path of project storage, default to the project root of the default storage system")
+	optsConfig = flag.String("config", os.Getenv("TG_TOOLSET_CONFIG"), "`path` of the configuration file declaring the storage systems, default to the built-in storage systems")
 	optsPath = flag.String("p", "", "set path of a sub-directory in the project folder")
 	optsNthreads = flag.Int("n", 2, "set number of concurrent processing threads")
 	optsForce = flag.Bool("f", false, "force the deletion regardlessly")
@@ -59,6 +75,19 @@ func init() {
 	optsSilence = flag.Bool("s", false, "set to `silence` mode")
 	optsFollowLink = flag.Bool("l", false, "`follow` symlinks to set roles on referents")
 	optsSkipFiles = flag.Bool("k", false, "`skip` deleting roles on existing files")
+	optsDryRun = flag.Bool("dry-run", false, "report the role changes on every path without applying them")
+	optsJournal = flag.Bool("j", false, "record the progress in a `journal` so that an interrupted run can be resumed")
+	optsResume = flag.Bool("resume", false, "resume an interrupted run from its journal, skipping completed directories")
+	optsLockWait = flag.Duration("lock-wait", 0, "maximum `duration` to wait for the lock held by another run on the same path")
+	optsRetries = flag.Int("retries", 2, "number of `retries` on the paths on which the roles failed to be removed")
+	optsRetryBackoff = flag.Duration("retry-backoff", time.Second, "`duration` to wait before the first retry, doubled after every retry")
+	optsFailures = flag.String("failures", "", "write the paths on which the roles failed to be removed into a JSON `report`")
+	optsFromFailures = flag.String("from-failures", "", "remove the roles again only on the failed paths in the JSON `report` written by -failures, updating the report with the remaining failures")
+	optsProgress = flag.Duration("progress", 0, "report the progress with throughput and ETA at every `interval`, e.g. 30s")
+	optsProgressJSON = flag.Bool("progress-json", false, "write the progress as JSON lines to the stderr instead of the log")
+	optsRate = flag.Float64("rate", 0, "maximum `number` of filesystem operations per second, 0 for no limit; send SIGUSR1 to halve it while running, and SIGUSR2 to revert")
+	optsMaxOps = flag.Int("max-ops", 0, "maximum `number` of concurrent filesystem operations, 0 for no limit")
+	optsControl = flag.String("control", "", "`path` of a control file with 'rate = N' and 'concurrency = N' lines, reloaded while running when it is modified")
 
 	flag.Usage = usage
 
@@ -76,6 +105,15 @@ func init() {
 
 	// initialize logger
 	log.NewLogger(cfg, log.InstanceLogrusLogger)
+
+	// load the storage systems on which the roles are managed.
+	storage, err := acl.LoadStorage(*optsConfig)
+	if err != nil {
+		log.Fatalf("%s", err)
+	}
+	if *optsBase == "" {
+		*optsBase = storage.ProjectRoot()
+	}
 }
 
 func usage() {
@@ -88,15 +126,33 @@ func usage() {
 	fmt.Printf("\n  %s honlee,edwger 3010000.01\n", os.Args[0])
 	fmt.Printf("\n%s\n", ustr.StringWrap("Removing users 'honlee' and 'edwger' from the 'contributor' role on project 3010000.01", 80))
 	fmt.Printf("\n  %s -c honlee,edwger 3010000.01\n", os.Args[0])
+	fmt.Printf("\n%s\n", ustr.StringWrap("Removing the group 'tg' from the 'contributor' role on project 3010000.01", 80))
+	fmt.Printf("\n  %s -c g:tg 3010000.01\n", os.Args[0])
 	fmt.Printf("\n%s\n", ustr.StringWrap("Removing users 'honlee' and 'edwger' from accessing files and directories under a specific path", 80))
 	fmt.Printf("\n  %s honlee,edwger /project/3010000.01/data_dir\n", os.Args[0])
 	fmt.Printf("\n%s\n", ustr.StringWrap("Removing users 'honlee' and 'edwger' from accessing files and directories under a specific path, and the traverse permission on its parent directories", 80))
 	fmt.Printf("\n  %s -t honlee,edwger /project/3010000.01/data_dir\n", os.Args[0])
+	fmt.Printf("\n%s\n", ustr.StringWrap("Removing user 'honlee' from the 'contributor' role on project 3010000.01 with the paths failed after the retries reported in 'report.json', and removing the role again only on the failed paths afterwards", 80))
+	fmt.Printf("\n  %s -failures report.json -c honlee 3010000.01\n", os.Args[0])
+	fmt.Printf("\n  %s -from-failures report.json\n", os.Args[0])
+	fmt.Printf("\n%s\n", ustr.StringWrap("Removing the roles as above, with the progress written as JSON lines to the stderr every minute", 80))
+	fmt.Printf("\n  %s -progress 1m -progress-json -failures report.json -c honlee 3010000.01\n", os.Args[0])
+	fmt.Printf("\n%s\n", ustr.StringWrap("Removing user 'honlee' from the 'contributor' role on project 3010000.01 with at most 200 filesystem operations per second, and slowing down the running job afterwards with a control file or by halving the rate with the SIGUSR1 signal", 80))
+	fmt.Printf("\n  %s -rate 200 -control /tmp/prj_delacl.ctl -c honlee 3010000.01\n", os.Args[0])
+	fmt.Printf("\n  echo 'rate = 50' > /tmp/prj_delacl.ctl\n")
+	fmt.Printf("\n  kill -USR1 $(pgrep prj_delacl)\n")
+	fmt.Printf("\nEXIT STATUS:\n")
+	fmt.Printf("\n%s\n", ustr.StringWrap("0 if the roles are removed on all paths, 1 if the run fails, 2 if the roles fail to be removed on some of the paths, or the signal number if the run is stopped by a signal.", 80))
 	fmt.Printf("\n")
 }
 
 func main() {
 
+	// rerun on the failed paths reported by a previous run.
+	if *optsFromFailures != "" {
+		os.Exit(rerunFailures(*optsFromFailures))
+	}
+
 	// command-line options
 	args := flag.Args()
 
@@ -105,9 +161,9 @@ func main() {
 		log.Fatalf("unknown project number: %v", args)
 	}
 
-	if len(args) >= 2 && *optsManager+*optsContributor+*optsViewer != "" {
+	if len(args) >= 2 && *optsManager+*optsContributor+*optsWriter+*optsViewer != "" {
 		flag.Usage()
-		log.Fatalf("use only one way to specify users: with or without role options (-m|-c|-u), not both.")
+		log.Fatalf("use only one way to specify users: with or without role options (-m|-c|-w|-u), not both.")
 	}
 
 	uidsAll := ""
@@ -125,17 +181,33 @@ func main() {
 	}
 
 	runner := acl.Runner{
-		RootPath:     ppathSym,
-		Managers:     strings.TrimPrefix(strings.TrimSuffix(strings.Join([]string{*optsManager, uidsAll}, ","), ","), ","),
-		Contributors: strings.TrimPrefix(strings.TrimSuffix(strings.Join([]string{*optsContributor, uidsAll}, ","), ","), ","),
-		Viewers:      strings.TrimPrefix(strings.TrimSuffix(strings.Join([]string{*optsViewer, uidsAll}, ","), ","), ","),
-		Traversers:   uidsAll,
-		FollowLink:   *optsFollowLink,
-		SkipFiles:    *optsSkipFiles,
-		Nthreads:     *optsNthreads,
-		Silence:      *optsSilence,
-		Traverse:     *optsTraverse,
-		Force:        *optsForce,
+		RootPath:      ppathSym,
+		Managers:      strings.TrimPrefix(strings.TrimSuffix(strings.Join([]string{*optsManager, uidsAll}, ","), ","), ","),
+		Contributors:  strings.TrimPrefix(strings.TrimSuffix(strings.Join([]string{*optsContributor, uidsAll}, ","), ","), ","),
+		Writers:       strings.TrimPrefix(strings.TrimSuffix(strings.Join([]string{*optsWriter, uidsAll}, ","), ","), ","),
+		Viewers:       strings.TrimPrefix(strings.TrimSuffix(strings.Join([]string{*optsViewer, uidsAll}, ","), ","), ","),
+		Traversers:    uidsAll,
+		FollowLink:    *optsFollowLink,
+		SkipFiles:     *optsSkipFiles,
+		Nthreads:      *optsNthreads,
+		DryRun:        *optsDryRun,
+		Journal:       *optsJournal,
+		Resume:        *optsResume,
+		LockTimeout:   *optsLockWait,
+		Retries:       *optsRetries,
+		RetryBackoff:  *optsRetryBackoff,
+		FailureReport: *optsFailures,
+		Silence:       *optsSilence,
+		Traverse:      *optsTraverse,
+		Force:         *optsForce,
+		Limiter:       ufp.NewRateLimiter(*optsRate, *optsMaxOps),
+		ControlFile:   *optsControl,
+	}
+	if *optsProgress > 0 {
+		runner.ProgressInterval = *optsProgress
+		if *optsProgressJSON {
+			runner.ProgressOutput = os.Stderr
+		}
 	}
 
 	exitcode, err := runner.RemoveRoles()
@@ -144,3 +216,35 @@ func main() {
 	}
 	os.Exit(exitcode)
 }
+
+// rerunFailures removes the roles again on the failed paths in the failure report `fpath`,
+// and returns the exit code.
+func rerunFailures(fpath string) int {
+	report, err := acl.LoadFailureReport(fpath)
+	if err != nil {
+		log.Fatalf("%s", err)
+	}
+	if report.Action != "delete" {
+		log.Fatalf("not a report of removing roles: %s", fpath)
+	}
+
+	runner := acl.Runner{
+		Nthreads:      *optsNthreads,
+		DryRun:        *optsDryRun,
+		LockTimeout:   *optsLockWait,
+		Retries:       *optsRetries,
+		RetryBackoff:  *optsRetryBackoff,
+		FailureReport: fpath,
+		Limiter:       ufp.NewRateLimiter(*optsRate, *optsMaxOps),
+		ControlFile:   *optsControl,
+	}
+	if *optsFailures != "" {
+		runner.FailureReport = *optsFailures
+	}
+
+	exitcode, err := runner.RerunFailures(*report)
+	if err != nil {
+		log.Fatalf("%s", err)
+	}
+	return exitcode
+}
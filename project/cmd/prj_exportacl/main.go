@@ -0,0 +1,120 @@
+// This program exports the ACLs of all files and directories in a project storage
+// into a snapshot file, which can be restored by `prj_importacl`.  It uses the linux
+// capability CAP_SYS_ADMIN for accessing the `trusted.managers` xattr when POSIX
+// ACL system is used on the filesystem (e.g. CephFs), and should be set in advance
+// with the following command.
+//
+// ```
+// $ sudo setcap cap_sys_admin+eip prj_exportacl
+// ```
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	log "github.com/Donders-Institute/tg-toolset-golang/pkg/logger"
+	ustr "github.com/Donders-Institute/tg-toolset-golang/pkg/strings"
+	"github.com/Donders-Institute/tg-toolset-golang/project/pkg/acl"
+)
+
+// global variables from command-line arguments
+var optsBase *string
+var optsConfig *string
+var optsPath *string
+var optsOutput *string
+var optsNthreads *int
+var optsVerbose *bool
+var optsSilence *bool
+
+func init() {
+	optsBase = flag.String("d", "", "set the root path of project storage, default to the project root of the default storage system")
+	optsConfig = flag.String("config", os.Getenv("TG_TOOLSET_CONFIG"), "`path` of the configuration file declaring the storage systems, default to the built-in storage systems")
+	optsPath = flag.String("p", "", "set path of a sub-directory in the project folder")
+	optsOutput = flag.String("o", "", "set the `file` to which the snapshot is written (default: stdout)")
+	optsNthreads = flag.Int("n", 4, "set number of concurrent processing threads")
+	optsVerbose = flag.Bool("v", false, "print `verbosed` messages")
+	optsSilence = flag.Bool("s", false, "set to `silence` mode")
+
+	flag.Usage = usage
+
+	flag.Parse()
+
+	cfg := log.Configuration{
+		EnableConsole:     true,
+		ConsoleJSONFormat: false,
+		ConsoleLevel:      log.Info,
+	}
+
+	if *optsVerbose {
+		cfg.ConsoleLevel = log.Debug
+	}
+
+	// initialize logger
+	log.NewLogger(cfg, log.InstanceLogrusLogger)
+
+	// load the storage systems on which the roles are managed.
+	storage, err := acl.LoadStorage(*optsConfig)
+	if err != nil {
+		log.Fatalf("%s", err)
+	}
+	if *optsBase == "" {
+		*optsBase = storage.ProjectRoot()
+	}
+}
+
+func usage() {
+	fmt.Printf("\nExporting the ACLs of a given project or a path into a snapshot file.\n")
+	fmt.Printf("\nUSAGE: %s [OPTIONS] projectId|path\n", os.Args[0])
+	fmt.Printf("\nOPTIONS:\n")
+	flag.PrintDefaults()
+	fmt.Printf("\nEXAMPLES:\n")
+	fmt.Printf("\n%s\n", ustr.StringWrap("Exporting the ACLs of project 3010000.01 into the snapshot file 3010000.01.acl.gz", 80))
+	fmt.Printf("\n  %s -o 3010000.01.acl.gz 3010000.01\n", os.Args[0])
+	fmt.Printf("\n")
+}
+
+func main() {
+
+	// command-line options
+	args := flag.Args()
+
+	if len(args) < 1 {
+		flag.Usage()
+		log.Fatalf("unknown project number: %v", args)
+	}
+
+	// the input argument starts with 7 digits (considered as project number)
+	ppath := args[0]
+	if matched, _ := regexp.MatchString("^[0-9]{7,}", ppath); matched {
+		ppath = filepath.Join(*optsBase, ppath, *optsPath)
+	} else {
+		ppath, _ = filepath.Abs(ppath)
+	}
+
+	w := os.Stdout
+	if *optsOutput != "" {
+		f, err := os.Create(*optsOutput)
+		if err != nil {
+			log.Fatalf("cannot create snapshot file: %s", err)
+		}
+		defer f.Close()
+		w = f
+	}
+
+	runner := acl.Runner{
+		RootPath: ppath,
+		Nthreads: *optsNthreads,
+		// the paths are logged to the stderr; keep the stdout for the snapshot.
+		Silence: *optsSilence || *optsOutput == "",
+	}
+
+	summary, err := runner.ExportACL(w)
+	log.Infof("%s", summary)
+	if err != nil {
+		log.Fatalf("%s", err)
+	}
+}
@@ -21,24 +21,39 @@ import (
 	"regexp"
 
 	log "github.com/Donders-Institute/tg-toolset-golang/pkg/logger"
+	ufp "github.com/Donders-Institute/tg-toolset-golang/pkg/filepath"
 	ustr "github.com/Donders-Institute/tg-toolset-golang/pkg/strings"
 	"github.com/Donders-Institute/tg-toolset-golang/project/pkg/acl"
 )
 
 var path *string
+var optsConfig *string
 var recursion *bool
 var nthreads *int
 var verbose *bool
 var optsFollowLink *bool
 var optsSkipFiles *bool
+var optsOutput acl.OutputFormat
+var optsInclude ufp.Patterns
+var optsExclude ufp.Patterns
+var optsMaxDepth *int
+var optsSameFs *bool
+var optsSnapshots *bool
 
 func init() {
-	path = flag.String("d", "/project", "root path of project storage")
+	path = flag.String("d", "", "root path of project storage, default to the project root of the default storage system")
+	optsConfig = flag.String("config", os.Getenv("TG_TOOLSET_CONFIG"), "`path` of the configuration file declaring the storage systems, default to the built-in storage systems")
 	recursion = flag.Bool("r", false, "get roles on files and directories recursively")
 	nthreads = flag.Int("n", 4, "number of concurrent processing threads")
 	verbose = flag.Bool("v", false, "print debug messages")
 	optsFollowLink = flag.Bool("l", false, "`follow` symlinks to set roles on referents")
 	optsSkipFiles = flag.Bool("k", false, "`skip` getting roles on existing files")
+	flag.Var(&optsOutput, "o", "output `format` of the roles: text, json, csv or yaml")
+	flag.Var(&optsInclude, "include", "comma-separated glob `patterns` of the files to walk through, other files are skipped")
+	flag.Var(&optsExclude, "exclude", "comma-separated glob `patterns` of the files and directories to skip, e.g. '*.tmp,derived/*'")
+	optsMaxDepth = flag.Int("max-depth", 0, "maximum number of directory `levels` to walk through, 0 for no limit")
+	optsSameFs = flag.Bool("xdev", false, "walk only through the filesystem of the project or path")
+	optsSnapshots = flag.Bool("snapshots", false, "walk also through the snapshot directories, e.g. '.snapshot', which are skipped by default")
 
 	flag.Usage = usage
 	flag.Parse()
@@ -55,6 +70,15 @@ func init() {
 
 	// initialize logger
 	log.NewLogger(cfg, log.InstanceLogrusLogger)
+
+	// load the storage systems on which the roles are managed.
+	storage, err := acl.LoadStorage(*optsConfig)
+	if err != nil {
+		log.Fatalf("%s", err)
+	}
+	if *path == "" {
+		*path = storage.ProjectRoot()
+	}
 }
 
 func usage() {
@@ -62,6 +86,7 @@ func usage() {
 	fmt.Printf("\nUSAGE: %s [OPTIONS] projectId|path\n", os.Args[0])
 	fmt.Printf("\nOPTIONS:\n")
 	flag.PrintDefaults()
+	fmt.Printf("\n%s\n", ustr.StringWrap("Groups are shown with the 'g:' prefix, e.g. 'g:tg' for the group 'tg'.", 80))
 	fmt.Printf("\nEXAMPLES:\n")
 	fmt.Printf("\n%s\n", ustr.StringWrap("Getting users with access permission on project 3010000.01", 80))
 	fmt.Printf("\n  %s 3010000.01\n", os.Args[0])
@@ -69,6 +94,10 @@ func usage() {
 	fmt.Printf("\n  %s -r 3010000.01\n", os.Args[0])
 	fmt.Printf("\n%s\n", ustr.StringWrap("Getting users with access permission on a specific file/directory", 80))
 	fmt.Printf("\n  %s /project/3010000.01/test.txt\n", os.Args[0])
+	fmt.Printf("\n%s\n", ustr.StringWrap("Getting users with access permission on all directories under project 3010000.01 as JSON lines", 80))
+	fmt.Printf("\n  %s -r -k -o json 3010000.01\n", os.Args[0])
+	fmt.Printf("\n%s\n", ustr.StringWrap("Getting users with access permission on all directories under project 3010000.01 up to two levels deep, skipping the 'derived' directory", 80))
+	fmt.Printf("\n  %s -r -k -max-depth 2 -exclude derived 3010000.01\n", os.Args[0])
 	fmt.Printf("\n")
 }
 
@@ -90,10 +119,16 @@ func main() {
 		ppath, _ = filepath.Abs(ppath)
 	}
 	runner := acl.Runner{
-		RootPath:   ppath,
-		FollowLink: *optsFollowLink,
-		SkipFiles:  *optsSkipFiles,
-		Nthreads:   *nthreads,
+		RootPath:       ppath,
+		FollowLink:     *optsFollowLink,
+		SkipFiles:      *optsSkipFiles,
+		Nthreads:       *nthreads,
+		Output:         optsOutput,
+		Include:        optsInclude,
+		Exclude:        optsExclude,
+		MaxDepth:       *optsMaxDepth,
+		SameFilesystem: *optsSameFs,
+		SkipSnapshots:  !*optsSnapshots,
 	}
 
 	if err := runner.PrintRoles(*recursion); err != nil {
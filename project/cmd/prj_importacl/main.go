@@ -0,0 +1,128 @@
+// This program restores the ACLs of a project storage from a snapshot file created
+// by `prj_exportacl`.  It uses the linux capabilities for operations granted to project
+// managers when POSIX ACL system is used on the filesystem (e.g. CephFs), and should be
+// set in advance with the following command.
+//
+// ```
+// $ sudo setcap cap_fowner,cap_sys_admin+eip prj_importacl
+// ```
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+
+	log "github.com/Donders-Institute/tg-toolset-golang/pkg/logger"
+	ustr "github.com/Donders-Institute/tg-toolset-golang/pkg/strings"
+	"github.com/Donders-Institute/tg-toolset-golang/project/pkg/acl"
+)
+
+// global variables from command-line arguments
+var optsBase *string
+var optsConfig *string
+var optsPath *string
+var optsNthreads *int
+var optsVerbose *bool
+var optsSilence *bool
+var optsVerify *bool
+var optsDryRun *bool
+var optsLockWait *time.Duration
+
+func init() {
+	optsBase = flag.String("d", "", "set the root path of project storage, default to the project root of the default storage system")
+	optsConfig = flag.String("config", os.Getenv("TG_TOOLSET_CONFIG"), "`path` of the configuration file declaring the storage systems, default to the built-in storage systems")
+	optsPath = flag.String("p", "", "set path of a sub-directory in the project folder")
+	optsNthreads = flag.Int("n", 4, "set number of concurrent processing threads")
+	optsVerbose = flag.Bool("v", false, "print `verbosed` messages")
+	optsSilence = flag.Bool("s", false, "set to `silence` mode")
+	optsVerify = flag.Bool("verify", true, "verify the ACL of every path after it is restored")
+	optsDryRun = flag.Bool("dry-run", false, "report the paths of which the ACL differs from the snapshot without restoring them")
+	optsLockWait = flag.Duration("lock-wait", 0, "maximum `duration` to wait for the lock held by another run on the same path")
+
+	flag.Usage = usage
+
+	flag.Parse()
+
+	cfg := log.Configuration{
+		EnableConsole:     true,
+		ConsoleJSONFormat: false,
+		ConsoleLevel:      log.Info,
+	}
+
+	if *optsVerbose {
+		cfg.ConsoleLevel = log.Debug
+	}
+
+	// initialize logger
+	log.NewLogger(cfg, log.InstanceLogrusLogger)
+
+	// load the storage systems on which the roles are managed.
+	storage, err := acl.LoadStorage(*optsConfig)
+	if err != nil {
+		log.Fatalf("%s", err)
+	}
+	if *optsBase == "" {
+		*optsBase = storage.ProjectRoot()
+	}
+}
+
+func usage() {
+	fmt.Printf("\nRestoring the ACLs of a given project or a path from a snapshot file.\n")
+	fmt.Printf("\nUSAGE: %s [OPTIONS] snapshot projectId|path\n", os.Args[0])
+	fmt.Printf("\nOPTIONS:\n")
+	flag.PrintDefaults()
+	fmt.Printf("\nEXAMPLES:\n")
+	fmt.Printf("\n%s\n", ustr.StringWrap("Restoring the ACLs of project 3010000.01 from the snapshot file 3010000.01.acl.gz", 80))
+	fmt.Printf("\n  %s 3010000.01.acl.gz 3010000.01\n", os.Args[0])
+	fmt.Printf("\n%s\n", ustr.StringWrap("Showing the paths of project 3010000.01 of which the ACL differs from the snapshot, without restoring them", 80))
+	fmt.Printf("\n  %s -dry-run 3010000.01.acl.gz 3010000.01\n", os.Args[0])
+	fmt.Printf("\n%s\n", ustr.StringWrap("Restoring the ACLs from the snapshot of project 3010000.01 on its copy migrated to another filer", 80))
+	fmt.Printf("\n  %s 3010000.01.acl.gz /project_cephfs/3010000.01\n", os.Args[0])
+	fmt.Printf("\n")
+}
+
+func main() {
+
+	// command-line options
+	args := flag.Args()
+
+	if len(args) < 2 {
+		flag.Usage()
+		log.Fatalf("missing snapshot file or project number: %v", args)
+	}
+
+	// the input argument starts with 7 digits (considered as project number)
+	ppath := args[1]
+	if matched, _ := regexp.MatchString("^[0-9]{7,}", ppath); matched {
+		ppath = filepath.Join(*optsBase, ppath, *optsPath)
+	} else {
+		ppath, _ = filepath.Abs(ppath)
+	}
+
+	f, err := os.Open(args[0])
+	if err != nil {
+		log.Fatalf("cannot open snapshot file: %s", err)
+	}
+	defer f.Close()
+
+	runner := acl.Runner{
+		RootPath:    ppath,
+		Nthreads:    *optsNthreads,
+		Silence:     *optsSilence,
+		DryRun:      *optsDryRun,
+		LockTimeout: *optsLockWait,
+	}
+
+	summary, err := runner.RestoreACL(f, *optsVerify)
+	log.Infof("%s", summary)
+	if err != nil {
+		log.Fatalf("%s", err)
+	}
+	if summary.Failed > 0 || summary.Mismatched > 0 {
+		os.Exit(1)
+	}
+}
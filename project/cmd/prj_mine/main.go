@@ -28,13 +28,17 @@ import (
 )
 
 var optsPath *string
+var optsConfig *string
 var nthreads *int
 var verbose *bool
+var optsOutput acl.OutputFormat
 
 func init() {
-	optsPath = flag.String("d", "/project", "root path of project storage")
+	optsPath = flag.String("d", "", "root path of project storage, default to the project root of the default storage system")
+	optsConfig = flag.String("config", os.Getenv("TG_TOOLSET_CONFIG"), "`path` of the configuration file declaring the storage systems, default to the built-in storage systems")
 	nthreads = flag.Int("n", 4, "number of concurrent processing threads")
 	verbose = flag.Bool("v", false, "print debug messages")
+	flag.Var(&optsOutput, "o", "output `format` of the roles: text, json, csv or yaml")
 
 	flag.Usage = usage
 	flag.Parse()
@@ -51,6 +55,15 @@ func init() {
 
 	// initialize logger
 	log.NewLogger(cfg, log.InstanceLogrusLogger)
+
+	// load the storage systems on which the roles are managed.
+	storage, err := acl.LoadStorage(*optsConfig)
+	if err != nil {
+		log.Fatalf("%s", err)
+	}
+	if *optsPath == "" {
+		*optsPath = storage.ProjectRoot()
+	}
 }
 
 func usage() {
@@ -105,20 +118,37 @@ func main() {
 	}(*optsPath)
 
 	// go routine printing user's membership.
+	printed := make(chan struct{})
 	go func() {
+		defer close(printed)
+		w := acl.NewRoleWriter(os.Stdout, optsOutput)
 		for member := range members {
-			fmt.Printf("%s: %s\n", member.projectID, member.role)
+			if optsOutput == acl.OutputText {
+				fmt.Printf("%s: %s\n", member.projectID, member.role)
+				continue
+			}
+			if err := w.Write(acl.RolePathMap{
+				Path:    member.path,
+				RoleMap: acl.RoleMap{member.role: {uid}},
+			}); err != nil {
+				log.Errorf("%s", err)
+			}
+		}
+		if err := w.Flush(); err != nil {
+			log.Errorf("%s", err)
 		}
 	}()
 
 	wg.Wait()
 
-	// close up members channel
+	// close up members channel and wait for the output to be printed
 	close(members)
+	<-printed
 }
 
 type projectRole struct {
 	projectID string
+	path      string
 	role      acl.Role
 }
 
@@ -152,6 +182,7 @@ func findUserMember(uid string, dirs chan string, members chan projectRole, wg *
 					if u == uid {
 						members <- projectRole{
 							projectID: filepath.Base(dir),
+							path:      dir,
 							role:      r,
 						}
 						break
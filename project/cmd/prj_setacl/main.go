@@ -5,8 +5,8 @@
 // - CAP_SYS_ADMIN: for accessing the `trusted.managers` xattr that maintains
 //                  a list of project managers.
 //
-// - CAP_FOWNER: for allowing managers to set ACLs via the `setfacl` command
-//               without being the owner of files and directories.
+// - CAP_FOWNER: for allowing managers to set ACLs on files and directories
+//               without being the owner.
 //
 // In order to allow this trick to work, this executable should be set in
 // advance to allow using the linux capability using the following command.
@@ -22,19 +22,23 @@ import (
 	"os"
 	"path/filepath"
 	"regexp"
+	"time"
 
+	"github.com/Donders-Institute/tg-toolset-golang/pkg/config"
 	log "github.com/Donders-Institute/tg-toolset-golang/pkg/logger"
+	ufp "github.com/Donders-Institute/tg-toolset-golang/pkg/filepath"
 	ustr "github.com/Donders-Institute/tg-toolset-golang/pkg/strings"
 	"github.com/Donders-Institute/tg-toolset-golang/project/pkg/acl"
+	"github.com/Donders-Institute/tg-toolset-golang/project/pkg/pdb"
 )
 
 // global variables from command-line arguments
 var optsBase *string
+var optsConfig *string
 var optsPath *string
 var optsManager *string
 var optsContributor *string
-
-//var optsWriter *string
+var optsWriter *string
 var optsViewer *string
 var optsTraverse *bool
 var optsNthreads *int
@@ -43,14 +47,36 @@ var optsVerbose *bool
 var optsSilence *bool
 var optsFollowLink *bool
 var optsSkipFiles *bool
+var optsDryRun *bool
+var optsJournal *bool
+var optsResume *bool
+var optsLockWait *time.Duration
+var optsRetries *int
+var optsRetryBackoff *time.Duration
+var optsFailures *string
+var optsFromFailures *string
+var optsProgress *time.Duration
+var optsProgressJSON *bool
+var optsRate *float64
+var optsMaxOps *int
+var optsControl *string
+var optsInclude ufp.Patterns
+var optsExclude ufp.Patterns
+var optsMaxDepth *int
+var optsSameFs *bool
+var optsSnapshots *bool
+var optsIncremental *bool
+var optsLastRunStore *string
+var optsCheckUsers pdb.UserCheck
 
 func init() {
-	optsManager = flag.String("m", "", "specify a comma-separated-list of users for the manager role")
-	optsContributor = flag.String("c", "", "specify a comma-separated-list of users for the contributor role")
-	// optsWriter = flag.String("w", "", "specify a comma-separated-list of users for the writer role")
-	optsViewer = flag.String("u", "", "specify a comma-separated-list of users for the viewer role")
+	optsManager = flag.String("m", "", "specify a comma-separated-list of users or groups (prefixed with g:) for the manager role")
+	optsContributor = flag.String("c", "", "specify a comma-separated-list of users or groups (prefixed with g:) for the contributor role")
+	optsWriter = flag.String("w", "", "specify a comma-separated-list of users or groups (prefixed with g:) for the writer role; on the POSIX and CephFS storage, writers can also delete and rename files")
+	optsViewer = flag.String("u", "", "specify a comma-separated-list of users or groups (prefixed with g:) for the viewer role")
 	optsTraverse = flag.Bool("t", true, "enable/disable role users to travel through parent directories")
-	optsBase = flag.String("d", "/project", "set the root path of project storage")
+	optsBase = flag.String("d", "", "set the root path of project storage, default to the project root of the default storage system")
+	optsConfig = flag.String("config", os.Getenv("TG_TOOLSET_CONFIG"), "`path` of the configuration file declaring the storage systems, default to the built-in storage systems")
 	optsPath = flag.String("p", "", "set path of a sub-directory in the project folder")
 	optsNthreads = flag.Int("n", 4, "set number of concurrent processing threads")
 	optsForce = flag.Bool("f", false, "force role setting regardlessly")
@@ -58,6 +84,27 @@ func init() {
 	optsSilence = flag.Bool("s", false, "set to `silence` mode")
 	optsFollowLink = flag.Bool("l", false, "`follow` symlink to set roles on its first non-symlink referent")
 	optsSkipFiles = flag.Bool("k", false, "`skip` setting roles on existing files")
+	optsDryRun = flag.Bool("dry-run", false, "report the role changes on every path without applying them")
+	optsJournal = flag.Bool("j", false, "record the progress in a `journal` so that an interrupted run can be resumed")
+	optsResume = flag.Bool("resume", false, "resume an interrupted run from its journal, skipping completed directories")
+	optsLockWait = flag.Duration("lock-wait", 0, "maximum `duration` to wait for the lock held by another run on the same path")
+	optsRetries = flag.Int("retries", 2, "number of `retries` on the paths on which the roles failed to be set")
+	optsRetryBackoff = flag.Duration("retry-backoff", time.Second, "`duration` to wait before the first retry, doubled after every retry")
+	optsFailures = flag.String("failures", "", "write the paths on which the roles failed to be set into a JSON `report`")
+	optsFromFailures = flag.String("from-failures", "", "set the roles again only on the failed paths in the JSON `report` written by -failures, updating the report with the remaining failures")
+	optsProgress = flag.Duration("progress", 0, "report the progress with throughput and ETA at every `interval`, e.g. 30s")
+	optsProgressJSON = flag.Bool("progress-json", false, "write the progress as JSON lines to the stderr instead of the log")
+	optsRate = flag.Float64("rate", 0, "maximum `number` of filesystem operations per second, 0 for no limit; send SIGUSR1 to halve it while running, and SIGUSR2 to revert")
+	optsMaxOps = flag.Int("max-ops", 0, "maximum `number` of concurrent filesystem operations, 0 for no limit")
+	optsControl = flag.String("control", "", "`path` of a control file with 'rate = N' and 'concurrency = N' lines, reloaded while running when it is modified")
+	flag.Var(&optsInclude, "include", "comma-separated glob `patterns` of the files to walk through, other files are skipped")
+	flag.Var(&optsExclude, "exclude", "comma-separated glob `patterns` of the files and directories to skip, e.g. '*.tmp,derived/*'")
+	optsMaxDepth = flag.Int("max-depth", 0, "maximum number of directory `levels` to walk through, 0 for no limit")
+	optsSameFs = flag.Bool("xdev", false, "walk only through the filesystem of the project or path")
+	optsSnapshots = flag.Bool("snapshots", false, "walk also through the snapshot directories, e.g. '.snapshot', which are skipped by default")
+	optsIncremental = flag.Bool("incremental", false, "set roles only on the files changed since the last incremental run of the same roles on the project or path; files moved in with 'mv' keep their times and are skipped, run without it after such a move")
+	optsLastRunStore = flag.String("last-run-store", acl.LastRunStorePath, "`path` of the store of the last-run timestamps of the incremental runs")
+	flag.Var(&optsCheckUsers, "check-users", "`check` of the users against the project database of the -config file before setting roles: none, warn or reject the users checked out, tentative or unknown")
 
 	flag.Usage = usage
 
@@ -75,6 +122,15 @@ func init() {
 
 	// initialize logger
 	log.NewLogger(cfg, log.InstanceLogrusLogger)
+
+	// load the storage systems on which the roles are managed.
+	storage, err := acl.LoadStorage(*optsConfig)
+	if err != nil {
+		log.Fatalf("%s", err)
+	}
+	if *optsBase == "" {
+		*optsBase = storage.ProjectRoot()
+	}
 }
 
 func usage() {
@@ -87,13 +143,44 @@ func usage() {
 	fmt.Printf("\n  %s -c honlee,edwger 3010000.01\n", os.Args[0])
 	fmt.Printf("\n%s\n", ustr.StringWrap("Adding or setting user 'honlee' to the 'manager' role, and 'edwger' to the 'viewer' role on project 3010000.01", 80))
 	fmt.Printf("\n  %s -m honlee -u edwger 3010000.01\n", os.Args[0])
+	fmt.Printf("\n%s\n", ustr.StringWrap("Adding or setting user 'edwger' to the 'writer' role, allowing to create and modify but not to delete files, on project 3010000.01.  On the POSIX and CephFS storage, the writer role has the same permission as the 'contributor' role, i.e. writers can also delete and rename files", 80))
+	fmt.Printf("\n  %s -w edwger 3010000.01\n", os.Args[0])
+	fmt.Printf("\n%s\n", ustr.StringWrap("Adding or setting the group 'tg' to the 'contributor' role on project 3010000.01", 80))
+	fmt.Printf("\n  %s -c g:tg 3010000.01\n", os.Args[0])
 	fmt.Printf("\n%s\n", ustr.StringWrap("Adding or setting users 'honlee' and 'edwger' to the 'contributor' role on a specific path, and allowing the two users to traverse through the parent directories", 80))
 	fmt.Printf("\n  %s -c honlee,edwger /project/3010000.01/data_dir\n", os.Args[0])
+	fmt.Printf("\n%s\n", ustr.StringWrap("Showing the role changes of adding user 'honlee' to the 'contributor' role on project 3010000.01, without applying them", 80))
+	fmt.Printf("\n  %s -dry-run -c honlee 3010000.01\n", os.Args[0])
+	fmt.Printf("\n%s\n", ustr.StringWrap("Adding user 'honlee' to the 'contributor' role on project 3010000.01 with the progress recorded in a journal, and resuming the run after it is interrupted", 80))
+	fmt.Printf("\n  %s -j -c honlee 3010000.01\n", os.Args[0])
+	fmt.Printf("\n  %s -resume -c honlee 3010000.01\n", os.Args[0])
+	fmt.Printf("\n%s\n", ustr.StringWrap("Adding user 'honlee' to the 'contributor' role on project 3010000.01 with the paths failed after the retries reported in 'report.json', and setting the role again only on the failed paths afterwards", 80))
+	fmt.Printf("\n  %s -failures report.json -c honlee 3010000.01\n", os.Args[0])
+	fmt.Printf("\n  %s -from-failures report.json\n", os.Args[0])
+	fmt.Printf("\n%s\n", ustr.StringWrap("Setting the roles as above, with the progress written as JSON lines to the stderr every minute", 80))
+	fmt.Printf("\n  %s -progress 1m -progress-json -failures report.json -c honlee 3010000.01\n", os.Args[0])
+	fmt.Printf("\n%s\n", ustr.StringWrap("Adding user 'honlee' to the 'contributor' role on the NIfTI files of project 3010000.01, skipping the temporary files and the directories on other filesystems", 80))
+	fmt.Printf("\n  %s -include '*.nii' -exclude '*.tmp' -xdev -c honlee 3010000.01\n", os.Args[0])
+	fmt.Printf("\n%s\n", ustr.StringWrap("Adding user 'honlee' to the 'contributor' role on project 3010000.01 nightly, with the role set only on the files changed since the previous night", 80))
+	fmt.Printf("\n  %s -incremental -c honlee 3010000.01\n", os.Args[0])
+	fmt.Printf("\n%s\n", ustr.StringWrap("Adding user 'honlee' to the 'contributor' role on project 3010000.01 with at most 200 filesystem operations per second, and slowing down the running job afterwards with a control file or by halving the rate with the SIGUSR1 signal", 80))
+	fmt.Printf("\n  %s -rate 200 -control /tmp/prj_setacl.ctl -c honlee 3010000.01\n", os.Args[0])
+	fmt.Printf("\n  echo 'rate = 50' > /tmp/prj_setacl.ctl\n")
+	fmt.Printf("\n  kill -USR1 $(pgrep prj_setacl)\n")
+	fmt.Printf("\n%s\n", ustr.StringWrap("Adding user 'honlee' to the 'contributor' role on project 3010000.01, only if the user is not checked out, tentative or unknown in the project database", 80))
+	fmt.Printf("\n  %s -config config.yml -check-users reject -c honlee 3010000.01\n", os.Args[0])
+	fmt.Printf("\nEXIT STATUS:\n")
+	fmt.Printf("\n%s\n", ustr.StringWrap("0 if the roles are set on all paths, 1 if the run fails, 2 if the roles fail to be set on some of the paths, or the signal number if the run is stopped by a signal.", 80))
 	fmt.Printf("\n")
 }
 
 func main() {
 
+	// rerun on the failed paths reported by a previous run.
+	if *optsFromFailures != "" {
+		os.Exit(rerunFailures(*optsFromFailures))
+	}
+
 	// command-line options
 	args := flag.Args()
 
@@ -111,16 +198,42 @@ func main() {
 	}
 
 	runner := acl.Runner{
-		Managers:     *optsManager,
-		Contributors: *optsContributor,
-		Viewers:      *optsViewer,
-		RootPath:     ppathSym,
-		Traverse:     *optsTraverse,
-		Force:        *optsForce,
-		FollowLink:   *optsFollowLink,
-		SkipFiles:    *optsSkipFiles,
-		Silence:      *optsSilence,
-		Nthreads:     *optsNthreads,
+		Managers:       *optsManager,
+		Contributors:   *optsContributor,
+		Writers:        *optsWriter,
+		Viewers:        *optsViewer,
+		RootPath:       ppathSym,
+		Traverse:       *optsTraverse,
+		Force:          *optsForce,
+		FollowLink:     *optsFollowLink,
+		SkipFiles:      *optsSkipFiles,
+		Silence:        *optsSilence,
+		Nthreads:       *optsNthreads,
+		DryRun:         *optsDryRun,
+		Journal:        *optsJournal,
+		Resume:         *optsResume,
+		LockTimeout:    *optsLockWait,
+		Retries:        *optsRetries,
+		RetryBackoff:   *optsRetryBackoff,
+		FailureReport:  *optsFailures,
+		Include:        optsInclude,
+		Exclude:        optsExclude,
+		MaxDepth:       *optsMaxDepth,
+		SameFilesystem: *optsSameFs,
+		SkipSnapshots:  !*optsSnapshots,
+		Incremental:    *optsIncremental,
+		LastRunStore:   *optsLastRunStore,
+		Limiter:        ufp.NewRateLimiter(*optsRate, *optsMaxOps),
+		ControlFile:    *optsControl,
+	}
+	if optsCheckUsers != pdb.UserCheckNone {
+		runner.ValidatePrincipal = userValidator()
+	}
+	if *optsProgress > 0 {
+		runner.ProgressInterval = *optsProgress
+		if *optsProgressJSON {
+			runner.ProgressOutput = os.Stderr
+		}
 	}
 
 	exitcode, err := runner.SetRoles()
@@ -129,3 +242,49 @@ func main() {
 	}
 	os.Exit(exitcode)
 }
+
+// userValidator returns the check of the users against the project database declared in
+// the configuration file.
+func userValidator() func(principal string) error {
+	conf, err := config.LoadConfig(*optsConfig)
+	if err != nil {
+		log.Fatalf("%s", err)
+	}
+	ipdb, err := pdb.New(conf.PDB)
+	if err != nil {
+		log.Fatalf("%s", err)
+	}
+	return optsCheckUsers.Validator(ipdb)
+}
+
+// rerunFailures sets the roles again on the failed paths in the failure report `fpath`,
+// and returns the exit code.
+func rerunFailures(fpath string) int {
+	report, err := acl.LoadFailureReport(fpath)
+	if err != nil {
+		log.Fatalf("%s", err)
+	}
+	if report.Action != "set" {
+		log.Fatalf("not a report of setting roles: %s", fpath)
+	}
+
+	runner := acl.Runner{
+		Nthreads:      *optsNthreads,
+		DryRun:        *optsDryRun,
+		LockTimeout:   *optsLockWait,
+		Retries:       *optsRetries,
+		RetryBackoff:  *optsRetryBackoff,
+		FailureReport: fpath,
+		Limiter:       ufp.NewRateLimiter(*optsRate, *optsMaxOps),
+		ControlFile:   *optsControl,
+	}
+	if *optsFailures != "" {
+		runner.FailureReport = *optsFailures
+	}
+
+	exitcode, err := runner.RerunFailures(*report)
+	if err != nil {
+		log.Fatalf("%s", err)
+	}
+	return exitcode
+}
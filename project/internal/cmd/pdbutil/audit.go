@@ -0,0 +1,514 @@
+package pdbutil
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	log "github.com/Donders-Institute/tg-toolset-golang/pkg/logger"
+	"github.com/Donders-Institute/tg-toolset-golang/project/pkg/acl"
+	"github.com/Donders-Institute/tg-toolset-golang/project/pkg/pdb"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
+)
+
+var (
+	auditSubdirs       bool
+	auditOutput        acl.OutputFormat
+	auditRepair        bool
+	auditRepairSubdirs bool
+	auditRepairDryRun  bool
+	auditMaxChanges    int
+	auditProjectThread int
+)
+
+func init() {
+	projectAuditCmd.Flags().IntVarP(&execNthreads, "nthreads", "n", 4,
+		"`number` of concurrent worker threads.")
+	projectAuditCmd.Flags().BoolVarP(&activeProjectOnly, "active-only", "a", false,
+		"only audit the active projects")
+	projectAuditCmd.Flags().BoolVarP(&auditSubdirs, "subdirs", "", false,
+		"also audit sub-directories for roles deviating from the project root")
+	projectAuditCmd.Flags().VarP(&auditOutput, "output", "o",
+		"output `format` of the audit report: text, json, csv or yaml")
+	projectAuditCmd.Flags().BoolVarP(&auditRepair, "repair", "", false,
+		"repair the deviations on the project root by setting/removing roles on the storage")
+	projectAuditCmd.Flags().BoolVarP(&auditRepairSubdirs, "repair-subdirs", "", false,
+		"with --repair and --subdirs, also repair the sub-directories, removing the extra roles granted on them")
+	projectAuditCmd.Flags().BoolVarP(&auditRepairDryRun, "dry-run", "", false,
+		"report the role changes of the repair without applying them")
+	projectAuditCmd.Flags().IntVarP(&auditMaxChanges, "max-changes", "", 10,
+		"maximum `number` of role changes per project; projects exceeding it are not repaired")
+	projectAuditCmd.Flags().IntVarP(&auditProjectThread, "project-threads", "", 4,
+		"`number` of concurrent worker threads walking through a project")
+
+	projectCmd.AddCommand(projectAuditCmd)
+}
+
+// projectAudit is the audit report of the data-access roles of a project.
+type projectAudit struct {
+	ProjectID string `json:"projectID" yaml:"projectID"`
+	Path      string `json:"path" yaml:"path"`
+	Error     string `json:"error,omitempty" yaml:"error,omitempty"`
+	// Root is the deviation of the roles on the project root from the project members in the PDB.
+	Root *acl.RoleDrift `json:"root,omitempty" yaml:"root,omitempty"`
+	// Subdirs are the deviations of the roles on sub-directories from the roles on the project root.
+	Subdirs []acl.RoleDrift `json:"subdirs,omitempty" yaml:"subdirs,omitempty"`
+	// Repair is the result of repairing the deviations.
+	Repair *projectRepair `json:"repair,omitempty" yaml:"repair,omitempty"`
+}
+
+// projectRepair is the result of repairing the deviations of the roles of a project.
+type projectRepair struct {
+	// Changes is the number of role changes for repairing the deviations.
+	Changes int `json:"changes" yaml:"changes"`
+	// Applied indicates whether the role changes are applied on the storage.
+	Applied bool `json:"applied" yaml:"applied"`
+	// Skipped is the reason why the role changes are not applied.
+	Skipped string `json:"skipped,omitempty" yaml:"skipped,omitempty"`
+	// Error is the error that occurred while applying the role changes.
+	Error string `json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+// hasDrift checks if the roles of the project deviate from the expected roles.
+func (a projectAudit) hasDrift() bool {
+	return (a.Root != nil && a.Root.HasDrift()) || len(a.Subdirs) > 0
+}
+
+// membersToRoleMap converts the project members in the PDB into the RoleMap.
+// Members with a role unknown to the `acl` package are ignored.
+func membersToRoleMap(members []pdb.Member) acl.RoleMap {
+	roles := make(acl.RoleMap)
+	for _, m := range members {
+		r, err := acl.ParseRole(m.Role)
+		if err != nil {
+			log.Warnf("ignore member %s: %s", m.UserID, err)
+			continue
+		}
+		roles[r] = append(roles[r], m.UserID)
+	}
+	return roles
+}
+
+// auditProject compares the roles on the root directory of the project with the project
+// members in the PDB.  If `subdirs` is true, it also compares the roles on every sub-directory
+// with the roles on the project root.
+func auditProject(prj *pdb.Project, subdirs bool, nthreads int) projectAudit {
+
+	ppath := filepath.Join(projectRoot(storSystem), prj.ID)
+
+	audit := projectAudit{ProjectID: prj.ID, Path: ppath}
+
+	runner := acl.Runner{
+		RootPath:  ppath,
+		SkipFiles: true,
+		Nthreads:  nthreads,
+	}
+
+	// roles on the project root
+	chanOut, err := runner.GetRoles(false)
+	if err != nil {
+		audit.Error = err.Error()
+		return audit
+	}
+	var root acl.RolePathMap
+	for o := range chanOut {
+		root = o
+	}
+	if root.RoleMap == nil {
+		audit.Error = fmt.Sprintf("cannot get roles: %s", ppath)
+		return audit
+	}
+
+	drift := acl.CompareRoles(root.Path, membersToRoleMap(prj.Members), root.RoleMap)
+	audit.Root = &drift
+
+	if !subdirs {
+		return audit
+	}
+
+	// roles on the sub-directories
+	chanOut, err = runner.GetRoles(true)
+	if err != nil {
+		audit.Error = err.Error()
+		return audit
+	}
+	for o := range chanOut {
+		if filepath.Clean(o.Path) == filepath.Clean(root.Path) {
+			continue
+		}
+		if d := acl.CompareRoles(o.Path, root.RoleMap, o.RoleMap); d.HasDrift() {
+			audit.Subdirs = append(audit.Subdirs, d)
+		}
+	}
+	sort.Slice(audit.Subdirs, func(i, j int) bool { return audit.Subdirs[i].Path < audit.Subdirs[j].Path })
+
+	return audit
+}
+
+// roleChange is a set of roles to be set and removed on a path.
+type roleChange struct {
+	path     string
+	set      acl.RoleMap
+	del      acl.RoleMap
+	traverse bool
+}
+
+// repairChanges converts the deviations in the audit report into the role changes on the
+// project root, and on the sub-directories if `subdirs` is true.  The roles on a sub-directory
+// deviating from the project root may be granted on purpose; they are therefore only changed
+// on explicit request.  Users whose roles are changed on the project root are left out from
+// the changes on the sub-directories, as the roles on the project root are applied recursively.
+func repairChanges(a projectAudit, subdirs bool) []roleChange {
+	set, del := a.Root.Changes(nil)
+	changes := []roleChange{{path: a.Root.Path, set: set, del: del}}
+
+	if !subdirs {
+		return changes
+	}
+
+	ignore := make(map[string]bool)
+	for _, m := range []acl.RoleMap{set, del} {
+		for _, users := range m {
+			for _, u := range users {
+				ignore[u] = true
+			}
+		}
+	}
+
+	for _, d := range a.Subdirs {
+		set, del := d.Changes(ignore)
+		// users set on a sub-directory need to traverse through the parent directories.
+		changes = append(changes, roleChange{path: d.Path, set: set, del: del, traverse: true})
+	}
+
+	return changes
+}
+
+// repairRoles are the roles set or removed by the repair.  Other roles (e.g. the traverse
+// role granted along with the roles on sub-directories) are not repaired.
+var repairRoles = []acl.Role{acl.Manager, acl.Contributor, acl.Writer, acl.Viewer}
+
+// countChanges returns the total number of role changes, counting only the `repairRoles`.
+func countChanges(changes []roleChange) int {
+	n := 0
+	for _, c := range changes {
+		for _, m := range []acl.RoleMap{c.set, c.del} {
+			for _, r := range repairRoles {
+				n += len(m[r])
+			}
+		}
+	}
+	return n
+}
+
+// newRepairRunner returns the acl.Runner for setting or removing the `roles` on the path.
+func newRepairRunner(path string, roles acl.RoleMap, traverse bool) acl.Runner {
+	for r, users := range roles {
+		switch r {
+		case acl.Manager, acl.Contributor, acl.Writer, acl.Viewer:
+		default:
+			log.Warnf("%s: role %s not supported for repair, ignored: %s", path, r, strings.Join(users, ","))
+		}
+	}
+	return acl.Runner{
+		RootPath:     path,
+		Managers:     strings.Join(roles[acl.Manager], ","),
+		Contributors: strings.Join(roles[acl.Contributor], ","),
+		Writers:      strings.Join(roles[acl.Writer], ","),
+		Viewers:      strings.Join(roles[acl.Viewer], ","),
+		Nthreads:     auditProjectThread,
+		Traverse:     traverse,
+		DryRun:       auditRepairDryRun,
+	}
+}
+
+// repairProject repairs the deviations in the audit report by setting/removing roles on
+// the storage; the deviations on the sub-directories are only repaired if `subdirs` is true.
+// The repair is skipped if the number of role changes exceeds `maxChanges`.  As the deviations
+// are re-evaluated on every audit, repairing a project without deviation is a no-op.  The
+// repair is stopped when the `ctx` is cancelled.
+func repairProject(ctx context.Context, a projectAudit, subdirs bool, maxChanges int) *projectRepair {
+
+	changes := repairChanges(a, subdirs)
+
+	repair := &projectRepair{Changes: countChanges(changes)}
+	if repair.Changes == 0 {
+		repair.Skipped = "no supported role change"
+		return repair
+	}
+	if repair.Changes > maxChanges {
+		repair.Skipped = fmt.Sprintf("number of changes exceeds the maximum: %d > %d", repair.Changes, maxChanges)
+		return repair
+	}
+
+	for _, c := range changes {
+		if len(c.set) > 0 {
+			runner := newRepairRunner(c.path, c.set, c.traverse)
+			if err := runnerErr(runner.SetRolesContext(ctx)); err != nil {
+				repair.Error = fmt.Sprintf("fail setting roles on %s: %s", c.path, err)
+				return repair
+			}
+		}
+		if len(c.del) > 0 {
+			runner := newRepairRunner(c.path, c.del, false)
+			if err := runnerErr(runner.RemoveRolesContext(ctx)); err != nil {
+				repair.Error = fmt.Sprintf("fail removing roles on %s: %s", c.path, err)
+				return repair
+			}
+		}
+	}
+
+	repair.Applied = !auditRepairDryRun
+
+	return repair
+}
+
+// auditWriter writes the projectAudit to an `io.Writer` in one of the acl.OutputFormat.
+type auditWriter struct {
+	w      io.Writer
+	format acl.OutputFormat
+	csv    *csv.Writer
+}
+
+// newAuditWriter returns an auditWriter writing to `w` in the given `format`.
+func newAuditWriter(w io.Writer, format acl.OutputFormat) *auditWriter {
+	aw := &auditWriter{w: w, format: format}
+	if format == acl.OutputCSV {
+		aw.csv = csv.NewWriter(w)
+		aw.csv.Write([]string{"projectID", "path", "drift", "user", "expected", "actual"})
+	}
+	return aw
+}
+
+// write writes the projectAudit `a` to the underlying `io.Writer`.
+func (aw *auditWriter) write(a projectAudit) error {
+	switch aw.format {
+	case acl.OutputJSON:
+		b, err := json.Marshal(a)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(aw.w, "%s\n", b)
+		return err
+	case acl.OutputYAML:
+		b, err := yaml.Marshal([]projectAudit{a})
+		if err != nil {
+			return err
+		}
+		_, err = aw.w.Write(b)
+		return err
+	case acl.OutputCSV:
+		if a.Error != "" {
+			return aw.csv.Write([]string{a.ProjectID, a.Path, "error", "", "", a.Error})
+		}
+		for _, d := range append([]acl.RoleDrift{*a.Root}, a.Subdirs...) {
+			for _, rec := range driftRecords(d) {
+				if err := aw.csv.Write(append([]string{a.ProjectID, d.Path}, rec...)); err != nil {
+					return err
+				}
+			}
+		}
+		if r := a.Repair; r != nil {
+			status := fmt.Sprintf("changes: %d, applied: %t, skipped: %s, error: %s", r.Changes, r.Applied, r.Skipped, r.Error)
+			return aw.csv.Write([]string{a.ProjectID, a.Path, "repair", "", "", status})
+		}
+		return nil
+	default:
+		if a.Error != "" {
+			_, err := fmt.Fprintf(aw.w, "%s: error: %s\n", a.ProjectID, a.Error)
+			return err
+		}
+		if _, err := fmt.Fprintf(aw.w, "%s:\n", a.ProjectID); err != nil {
+			return err
+		}
+		for _, d := range append([]acl.RoleDrift{*a.Root}, a.Subdirs...) {
+			if !d.HasDrift() {
+				continue
+			}
+			if _, err := fmt.Fprintf(aw.w, "  %s:\n", d.Path); err != nil {
+				return err
+			}
+			for _, rec := range driftRecords(d) {
+				if _, err := fmt.Fprintf(aw.w, "  %12s: %s (expected: %s, actual: %s)\n", rec[0], rec[1], rec[2], rec[3]); err != nil {
+					return err
+				}
+			}
+		}
+		if r := a.Repair; r != nil {
+			_, err := fmt.Fprintf(aw.w, "  repair: changes: %d, applied: %t, skipped: %s, error: %s\n", r.Changes, r.Applied, r.Skipped, r.Error)
+			return err
+		}
+		return nil
+	}
+}
+
+// flush writes any buffered data to the underlying `io.Writer`.
+func (aw *auditWriter) flush() error {
+	if aw.csv != nil {
+		aw.csv.Flush()
+		return aw.csv.Error()
+	}
+	return nil
+}
+
+// driftRecords converts the RoleDrift into records of drift type, user, expected role and
+// actual role.
+func driftRecords(d acl.RoleDrift) [][]string {
+	var recs [][]string
+	for _, m := range d.Missing {
+		recs = append(recs, []string{"missing", m.User, m.Role.String(), ""})
+	}
+	for _, m := range d.Extra {
+		recs = append(recs, []string{"extra", m.User, "", m.Role.String()})
+	}
+	for _, m := range d.Mismatched {
+		actual := make([]string, len(m.Actual))
+		for i, r := range m.Actual {
+			actual[i] = r.String()
+		}
+		recs = append(recs, []string{"mismatched", m.User, m.Expected.String(), strings.Join(actual, ",")})
+	}
+	return recs
+}
+
+// getAuditProjects returns the projects with the given ids from the PDB, or all the
+// projects if no id is given.
+func getAuditProjects(ipdb pdb.PDB, ids []string) ([]*pdb.Project, error) {
+	if len(ids) == 0 {
+		return ipdb.GetProjects(activeProjectOnly)
+	}
+
+	projects := make([]*pdb.Project, 0, len(ids))
+	for _, id := range ids {
+		p, err := ipdb.GetProject(id)
+		if err != nil {
+			return nil, fmt.Errorf("[%s] cannot get project: %s", id, err)
+		}
+		projects = append(projects, p)
+	}
+	return projects, nil
+}
+
+// goAuditProjects audits the given projects with `execNthreads` concurrent workers, each
+// works on a project.  It returns a channel of the audit reports, which is closed when all
+// projects are audited.  The remaining projects are skipped once the `ctx` is cancelled.
+func goAuditProjects(ctx context.Context, projects []*pdb.Project) chan projectAudit {
+
+	chanOut := make(chan projectAudit, execNthreads)
+
+	go func() {
+		var wg sync.WaitGroup
+		cprjs := make(chan *pdb.Project, execNthreads*2)
+		for w := 0; w < execNthreads; w++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for prj := range cprjs {
+					if ctx.Err() != nil {
+						continue
+					}
+					log.Debugf("[%s] auditing project roles", prj.ID)
+					a := auditProject(prj, auditSubdirs, auditProjectThread)
+					if auditRepair && a.Error == "" && a.hasDrift() {
+						log.Debugf("[%s] repairing project roles", prj.ID)
+						a.Repair = repairProject(ctx, a, auditRepairSubdirs, auditMaxChanges)
+					}
+					chanOut <- a
+				}
+			}()
+		}
+
+		for _, p := range projects {
+			cprjs <- p
+		}
+		close(cprjs)
+
+		// wait for all workers to finish
+		wg.Wait()
+		close(chanOut)
+	}()
+
+	return chanOut
+}
+
+// subcommand to audit project roles on the storage against the project database.
+var projectAuditCmd = &cobra.Command{
+	Use:   "audit [projectID]...",
+	Short: "Audits project roles on the storage against the project members in the project database",
+	Long: `Audits project roles on the storage against the project members in the project database.
+
+For every project, the roles on the project root directory are compared with the project
+members in the project database; users missing on the storage, users with extra roles on
+the storage, and users with mismatched roles are reported.  With the --subdirs flag,
+sub-directories with roles deviating from the project root are also reported.
+
+Only projects with deviations or errors are written to the report.
+
+With the --repair flag, the deviations are repaired by setting/removing roles on the
+storage.  Roles on the project root are set/removed recursively according to the project
+database.  The deviations on the sub-directories are only reported, as roles may be granted
+on sub-directories on purpose; with the --repair-subdirs flag, roles on the sub-directories
+are also set/removed according to the project root, including the removal of the extra
+roles.  Projects requiring more role changes than --max-changes are not repaired.  As the
+deviations are re-evaluated on every run, the repair can be run repeatedly.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		projects, err := getAuditProjects(loadPdb(), args)
+		if err != nil {
+			return err
+		}
+
+		log.Debugf("auditing roles for %d projects", len(projects))
+
+		ctx, cancel := signalContext()
+		defer cancel()
+
+		nDrift, nError := 0, 0
+		nRepaired, nSkipped, nFailed, nChanges := 0, 0, 0, 0
+		w := newAuditWriter(os.Stdout, auditOutput)
+		for a := range goAuditProjects(ctx, projects) {
+			switch {
+			case a.Error != "":
+				nError++
+			case a.hasDrift():
+				nDrift++
+			default:
+				log.Debugf("[%s] roles in sync", a.ProjectID)
+				continue
+			}
+			if r := a.Repair; r != nil {
+				switch {
+				case r.Error != "":
+					nFailed++
+				case r.Skipped != "":
+					nSkipped++
+				default:
+					nRepaired++
+					nChanges += r.Changes
+				}
+			}
+			if err := w.write(a); err != nil {
+				log.Errorf("[%s] cannot write audit report: %s", a.ProjectID, err)
+			}
+		}
+		if err := w.flush(); err != nil {
+			return err
+		}
+
+		log.Infof("projects audited: %d, with drift: %d, with error: %d", len(projects), nDrift, nError)
+		if auditRepair {
+			log.Infof("projects repaired: %d (role changes: %d, dry-run: %t), skipped: %d, failed: %d",
+				nRepaired, nChanges, auditRepairDryRun, nSkipped, nFailed)
+		}
+
+		return ctx.Err()
+	},
+}
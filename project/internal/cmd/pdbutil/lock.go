@@ -0,0 +1,124 @@
+package pdbutil
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	ufp "github.com/Donders-Institute/tg-toolset-golang/pkg/filepath"
+	log "github.com/Donders-Institute/tg-toolset-golang/pkg/logger"
+	"github.com/Donders-Institute/tg-toolset-golang/project/pkg/acl"
+	"github.com/spf13/cobra"
+)
+
+var (
+	lockRootPath   string
+	lockBreakForce bool
+)
+
+func init() {
+	lockCmd.PersistentFlags().StringVarP(&lockRootPath, "dir", "d", "",
+		"root `path` of the project storage.  Default to the project root of the default storage system.")
+
+	lockBreakCmd.Flags().BoolVarP(&lockBreakForce, "force", "f", false,
+		"break the lock even if it is held by a running process or created on another host")
+
+	lockCmd.AddCommand(lockListCmd, lockBreakCmd)
+	rootCmd.AddCommand(lockCmd)
+}
+
+// lockPath resolves the path of the lock file for the given project id or path.
+func lockPath(arg string) string {
+	ppath := arg
+	if matched, _ := regexp.MatchString("^[0-9]{7,}", ppath); matched {
+		root := lockRootPath
+		if root == "" {
+			root = projectRoot("")
+		}
+		ppath = filepath.Join(root, ppath)
+	} else {
+		ppath, _ = filepath.Abs(ppath)
+	}
+	return filepath.Join(ppath, acl.LockFile)
+}
+
+// lockState returns the state of the lock: `stale`, `active` or `remote`.
+func lockState(l *ufp.Lock) string {
+	switch {
+	case !l.IsLocal():
+		return "remote"
+	case l.IsStale():
+		return "stale"
+	default:
+		return "active"
+	}
+}
+
+var lockCmd = &cobra.Command{
+	Use:   "lock",
+	Short: "Utility for managing locks of the role setting/deleting operations",
+	Long:  ``,
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		loadStorage()
+		rootCmd.PersistentPreRun(cmd, args)
+	},
+}
+
+var lockListCmd = &cobra.Command{
+	Use:   "list [ projectID | path ]...",
+	Short: "List locks of the given projects or paths, or of all projects in the project storage",
+	Long:  ``,
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		var flocks []string
+		if len(args) == 0 {
+			dirs, err := ufp.ListDir(lockRootPath)
+			if err != nil {
+				return err
+			}
+			for _, d := range dirs {
+				flocks = append(flocks, filepath.Join(d, acl.LockFile))
+			}
+		} else {
+			for _, arg := range args {
+				flocks = append(flocks, lockPath(arg))
+			}
+		}
+
+		for _, flock := range flocks {
+			l, err := ufp.ReadLock(flock)
+			if os.IsNotExist(err) {
+				continue
+			}
+			if err != nil {
+				log.Errorf("%s", err)
+				continue
+			}
+			fmt.Printf("%-6s %s\n", lockState(l), l)
+		}
+
+		return nil
+	},
+}
+
+var lockBreakCmd = &cobra.Command{
+	Use:   "break [ projectID | path ]...",
+	Short: "Break locks of the given projects or paths",
+	Long: `Break locks of the given projects or paths.
+
+Only stale locks, i.e. locks left behind by a process no longer running on this host,
+are broken unless the --force flag is given.`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		for _, arg := range args {
+			flock := lockPath(arg)
+			if err := ufp.BreakLock(flock, lockBreakForce); err != nil {
+				log.Errorf("cannot break lock: %s", err)
+				continue
+			}
+			log.Infof("lock removed: %s", flock)
+		}
+		return nil
+	},
+}
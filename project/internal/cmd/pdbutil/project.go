@@ -1,6 +1,7 @@
 package pdbutil
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"os"
@@ -22,15 +23,10 @@ import (
 )
 
 var (
-	execNthreads      int
-	storSystem        string
-	useNetappCLI      bool
-	activeProjectOnly bool
-	projectRoots      map[string]string = map[string]string{
-		"netapp":  "/project",
-		"freenas": "/project_freenas",
-		"cephfs":  "/project_cephfs",
-	}
+	execNthreads          int
+	storSystem            string
+	useNetappCLI          bool
+	activeProjectOnly     bool
 	alertDbPath           string
 	ooqAlertTestProjectID string
 	ooqAlertSkipPI        bool
@@ -68,24 +64,19 @@ func ooqAlertFrequency(usage int) time.Duration {
 
 func init() {
 
-	// get supported storage systems from the `projectRoots`.
-	supportedStorSystems := make([]string, len(projectRoots))
-	i := 0
-	for sys := range projectRoots {
-		supportedStorSystems[i] = sys
-		i++
-	}
-
 	projectActionExecCmd.Flags().IntVarP(&execNthreads, "nthreads", "n", 4,
 		"`number` of concurrent worker threads.")
 	projectActionCmd.AddCommand(projectActionListCmd, projectActionExecCmd)
 
-	projectCmd.PersistentFlags().StringVarP(&storSystem, "sys", "s", "netapp",
-		fmt.Sprintf("storage `system`.  Supported systems: %s", strings.Join(supportedStorSystems, ",")))
+	projectCmd.PersistentFlags().StringVarP(&storSystem, "sys", "s", "",
+		"storage `system` declared in the storage section of the configuration file.  Default to the default storage system.")
 
 	projectCmd.PersistentFlags().BoolVarP(&useNetappCLI, "netapp-cli", "", false,
 		"use NetApp ONTAP CLI to apply changes on the NetApp filer. Only applicable for the netapp storage system.")
 
+	projectCmd.PersistentFlags().VarP(&checkUsers, "check-users", "",
+		"`check` of the members against the project database before setting roles: none, warn or reject the grants to the members checked out, tentative or unknown, leaving the rejected grants pending")
+
 	projectUpdateMembersCmd.Flags().BoolVarP(&activeProjectOnly, "active-only", "a", false,
 		"only update members on the active projects")
 
@@ -114,8 +105,12 @@ var projectCmd = &cobra.Command{
 	Short: "Utility for managing project storage",
 	Long:  ``,
 	PersistentPreRun: func(cmd *cobra.Command, args []string) {
-		if _, ok := projectRoots[storSystem]; !ok {
-			log.Fatalf("unsupported storage system: %s", storSystem)
+		storage := loadStorage()
+		if storSystem == "" {
+			storSystem = storage.Default
+		}
+		if _, err := storage.System(storSystem); err != nil {
+			log.Fatalf("%s", err)
 		}
 		rootCmd.PersistentPreRun(cmd, args)
 	},
@@ -139,7 +134,10 @@ var projectCreateCmd = &cobra.Command{
 			},
 		}
 
-		return actionExec(args[0], &data)
+		ctx, cancel := signalContext()
+		defer cancel()
+
+		return actionExec(ctx, args[0], &data)
 	},
 }
 
@@ -262,12 +260,19 @@ var projectActionExecCmd = &cobra.Command{
 			return err
 		}
 
+		ctx, cancel := signalContext()
+		defer cancel()
+
 		// perform pending actions sequencially as the NetApp API
 		// doesn't seem to be able to handle it concurrently.
 		for pid, action := range actions {
-			if err := actionExec(pid, action); err != nil {
+			if err := actionExec(ctx, pid, action); err != nil {
 				log.Errorf("%s", err)
 			}
+			// leave the remaining actions pending once interrupted.
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
 		}
 
 		// // perform pending actions with 4 concurrent workers,
@@ -279,7 +284,7 @@ var projectActionExecCmd = &cobra.Command{
 		// 	go func() {
 		// 		defer wg.Done()
 		// 		for pid := range pids {
-		// 			if err := actionExec(pid, actions[pid]); err != nil {
+		// 			if err := actionExec(ctx, pid, actions[pid]); err != nil {
 		// 				log.Errorf("%s", err)
 		// 			}
 		// 		}
@@ -566,7 +571,8 @@ func ooqAlert(ipdb pdb.PDB, prj *pdb.Project, info *pdb.DataProjectInfo, lastAle
 }
 
 // actionExec implements the logic of executing the pending actions concerning a project.
-func actionExec(pid string, act *pdb.DataProjectUpdate) error {
+// Setting the member roles is stopped when the `ctx` is cancelled.
+func actionExec(ctx context.Context, pid string, act *pdb.DataProjectUpdate) error {
 
 	// load project database interface
 	ipdb := loadPdb()
@@ -575,11 +581,17 @@ func actionExec(pid string, act *pdb.DataProjectUpdate) error {
 	log.Debugf("[%s] pending actions: %+v", pid, act)
 
 	// check if the action concerns creation of a new project.
-	// TODO: the project directory prefix should depends on storSystem
-	ppath := filepath.Join("/project", pid)
+	ppath := filepath.Join(projectRoot(storSystem), pid)
 	_, err := os.Stat(ppath)
 	newProject := os.IsNotExist(err)
 
+	// leave out the grants to the members failing the check; they are kept pending in the
+	// project database, while the removals and the other grants are performed.
+	if members, err := checkUsers.FilterMembers(ipdb, act.Members); err != nil {
+		log.Errorf("[%s] grants rejected: %s", pid, err)
+		act = &pdb.DataProjectUpdate{Members: members, Storage: act.Storage}
+	}
+
 	// extract member roles from the `act`
 	managers := []string{}
 	contributors := []string{}
@@ -648,8 +660,8 @@ func actionExec(pid string, act *pdb.DataProjectUpdate) error {
 			Force:        false,
 		}
 
-		if ec, err := runner.SetRoles(); err != nil {
-			return fmt.Errorf("[%s] fail setting member role (ec=%d): %s", pid, ec, err)
+		if err := runnerErr(runner.SetRolesContext(ctx)); err != nil {
+			return fmt.Errorf("[%s] fail setting member role: %s", pid, err)
 		}
 
 		// remove members from project (only meaningful for existing project)
@@ -667,8 +679,8 @@ func actionExec(pid string, act *pdb.DataProjectUpdate) error {
 				Force:        false,
 			}
 
-			if ec, err := runner.RemoveRoles(); err != nil {
-				return fmt.Errorf("[%s] fail removing acl (ec=%d): %s", pid, ec, err)
+			if err := runnerErr(runner.RemoveRolesContext(ctx)); err != nil {
+				return fmt.Errorf("[%s] fail removing acl: %s", pid, err)
 			}
 		}
 
@@ -789,3 +801,15 @@ func actionExec(pid string, act *pdb.DataProjectUpdate) error {
 
 	return nil
 }
+
+// runnerErr returns the error of a run of the `acl.Runner`, including the first error on
+// the paths the roles failed to be set or removed.
+func runnerErr(res acl.RunResult, err error) error {
+	if err != nil {
+		return err
+	}
+	if res.Failed > 0 {
+		return fmt.Errorf("%s, first error: %s", res, res.Errors[0])
+	}
+	return nil
+}
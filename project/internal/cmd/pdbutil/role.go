@@ -1,19 +1,25 @@
 package pdbutil
 
 import (
+	"fmt"
+	"os"
 	"path/filepath"
 	"regexp"
 	"strings"
+	"time"
 
+	ufp "github.com/Donders-Institute/tg-toolset-golang/pkg/filepath"
+	log "github.com/Donders-Institute/tg-toolset-golang/pkg/logger"
+	"github.com/Donders-Institute/tg-toolset-golang/pkg/mailer"
 	"github.com/Donders-Institute/tg-toolset-golang/project/pkg/acl"
+	"github.com/Donders-Institute/tg-toolset-golang/project/pkg/pdb"
 	"github.com/spf13/cobra"
 )
 
-const projectRootPath string = "/project"
-
 var (
 	uidsManager     string
 	uidsContributor string
+	uidsWriter      string
 	uidsViewer      string
 	uidsAll         string
 	forceFlag       bool
@@ -22,44 +28,83 @@ var (
 	skipFiles       bool
 	silenceFlag     bool
 	recursion       bool
+	dryRun          bool
+	journalFlag     bool
+	resumeFlag      bool
+	lockWait        time.Duration
+	outputFormat    acl.OutputFormat
+	expiryDate      string
+	grantRegistry   string
+	notifyManagers  bool
+	walkInclude     ufp.Patterns
+	walkExclude     ufp.Patterns
+	walkMaxDepth    int
+	walkSameFs      bool
+	walkSnapshots   bool
+	incremental     bool
+	lastRunStore    string
+	opsRate         float64
+	maxOps          int
+	controlFile     string
+	checkUsers      pdb.UserCheck
 )
 
 func init() {
 	roleSetCmd.PersistentFlags().StringVarP(
 		&uidsManager,
 		"manager", "m", "",
-		"comma-separated system uids to be set as project managers",
+		"comma-separated system uids or groups (prefixed with g:) to be set as project managers",
 	)
 	roleSetCmd.PersistentFlags().StringVarP(
 		&uidsContributor,
 		"contributor", "c", "",
-		"comma-separated system uids to be set as project contributors",
+		"comma-separated system uids or groups (prefixed with g:) to be set as project contributors",
+	)
+	roleSetCmd.PersistentFlags().StringVarP(
+		&uidsWriter,
+		"writer", "w", "",
+		"comma-separated system uids or groups (prefixed with g:) to be set as project writers; on the POSIX and CephFS storage, writers can also delete and rename files",
 	)
 	roleSetCmd.PersistentFlags().StringVarP(
 		&uidsViewer,
 		"viewer", "u", "",
-		"comma-separated system uids to be set as project viewers",
+		"comma-separated system uids or groups (prefixed with g:) to be set as project viewers",
+	)
+	roleSetCmd.PersistentFlags().StringVarP(
+		&expiryDate,
+		"expire", "e", "",
+		"`date` (YYYY-MM-DD) until which the roles are granted, the roles are removed by \"role expire\" afterwards",
+	)
+	roleSetCmd.PersistentFlags().VarP(
+		&checkUsers,
+		"check-users", "",
+		"`check` of the users against the project database before setting roles: none, warn or reject the users checked out, tentative or unknown",
 	)
 
 	roleRemoveCmd.PersistentFlags().StringVarP(
 		&uidsManager,
 		"manager", "m", "",
-		"comma-separated system uids to be removed from the project manager",
+		"comma-separated system uids or groups (prefixed with g:) to be removed from the project manager",
 	)
 	roleRemoveCmd.PersistentFlags().StringVarP(
 		&uidsContributor,
 		"contributor", "c", "",
-		"comma-separated system uids to be removed from the project contributor",
+		"comma-separated system uids or groups (prefixed with g:) to be removed from the project contributor",
+	)
+	roleRemoveCmd.PersistentFlags().StringVarP(
+		&uidsWriter,
+		"writer", "w", "",
+		"comma-separated system uids or groups (prefixed with g:) to be removed from the project writer",
 	)
 	roleRemoveCmd.PersistentFlags().StringVarP(
 		&uidsViewer,
 		"viewer", "u", "",
-		"comma-separated system uids to be removed from the project viewer",
+		"comma-separated system uids or groups (prefixed with g:) to be removed from the project viewer",
 	)
 	roleRemoveCmd.PersistentFlags().StringVarP(
 		&uidsAll,
 		"all", "a", "",
-		"comma-separated system uids to be removed from the project (regardless of the role)",
+		"comma-separated system uids or groups (prefixed with g:) to be removed from the project (regardless of the role)",
 	)
 
 	roleCmd.PersistentFlags().BoolVarP(
@@ -82,20 +127,109 @@ func init() {
 		"skip-files", "k", false,
 		"skip setting/deleting/getting roles on individual files",
 	)
+	roleCmd.PersistentFlags().BoolVarP(
+		&dryRun,
+		"dry-run", "", false,
+		"report the role changes on every path without applying them",
+	)
+	roleCmd.PersistentFlags().BoolVarP(
+		&journalFlag,
+		"journal", "j", false,
+		"record the progress in a journal so that an interrupted run can be resumed",
+	)
+	roleCmd.PersistentFlags().BoolVarP(
+		&resumeFlag,
+		"resume", "", false,
+		"resume an interrupted run from its journal, skipping completed directories",
+	)
+	roleCmd.PersistentFlags().DurationVarP(
+		&lockWait,
+		"lock-wait", "", 0,
+		"maximum `duration` to wait for the lock held by another run on the same path",
+	)
+	// the `-c` shorthand refers to the contributor flag of "role set" and "role remove"; the
+	// global `--config` flag is therefore redefined for the role commands without the shorthand.
+	roleCmd.PersistentFlags().StringVarP(&configFile, "config", "", "config.yml", "`path` of the configuration YAML file.")
 	roleCmd.PersistentFlags().IntVarP(
 		&numThreads,
 		"nthreads", "n", 8,
 		"number of parallel worker threads",
 	)
+	roleCmd.PersistentFlags().VarP(
+		&walkInclude,
+		"include", "",
+		"comma-separated glob `patterns` of the files to walk through, other files are skipped",
+	)
+	roleCmd.PersistentFlags().VarP(
+		&walkExclude,
+		"exclude", "",
+		"comma-separated glob `patterns` of the files and directories to skip, e.g. '*.tmp,derived/*'",
+	)
+	roleCmd.PersistentFlags().IntVarP(
+		&walkMaxDepth,
+		"max-depth", "", 0,
+		"maximum number of directory `levels` to walk through, 0 for no limit",
+	)
+	roleCmd.PersistentFlags().BoolVarP(
+		&walkSameFs,
+		"xdev", "", false,
+		"walk only through the filesystem of the project or path",
+	)
+	roleCmd.PersistentFlags().BoolVarP(
+		&walkSnapshots,
+		"snapshots", "", false,
+		"walk also through the snapshot directories, e.g. '.snapshot', which are skipped by default",
+	)
+	roleCmd.PersistentFlags().BoolVarP(
+		&incremental,
+		"incremental", "", false,
+		"set or remove roles only on the files changed since the last incremental run of the same roles; files moved in with 'mv' keep their times and are skipped, run without it after such a move",
+	)
+	roleCmd.PersistentFlags().StringVarP(
+		&lastRunStore,
+		"last-run-store", "", acl.LastRunStorePath,
+		"`path` of the store of the last-run timestamps of the incremental runs",
+	)
+	roleCmd.PersistentFlags().Float64VarP(
+		&opsRate,
+		"rate", "", 0,
+		"maximum `number` of filesystem operations per second, 0 for no limit; send SIGUSR1 to halve it while running, and SIGUSR2 to revert",
+	)
+	roleCmd.PersistentFlags().IntVarP(
+		&maxOps,
+		"max-ops", "", 0,
+		"maximum `number` of concurrent filesystem operations, 0 for no limit",
+	)
+	roleCmd.PersistentFlags().StringVarP(
+		&controlFile,
+		"control", "", "",
+		"`path` of a control file with 'rate = N' and 'concurrency = N' lines, reloaded while running when it is modified",
+	)
+	roleCmd.PersistentFlags().StringVarP(
+		&grantRegistry,
+		"registry", "", acl.GrantRegistryPath,
+		"`path` of the registry of the roles granted with an expiry date",
+	)
+
+	roleExpireCmd.PersistentFlags().BoolVarP(
+		&notifyManagers,
+		"notify", "", true,
+		"notify the project managers about the removed roles by email",
+	)
 
 	roleGetCmd.PersistentFlags().BoolVarP(
 		&recursion,
 		"recursive", "r", false,
 		"enable recursion for getting roles",
 	)
+	roleGetCmd.PersistentFlags().VarP(
+		&outputFormat,
+		"output", "o",
+		"output `format` of the roles: text, json, csv or yaml",
+	)
 
-	// roleCmd.AddCommand(roleGetCmd, roleSetCmd, roleRemoveCmd)
-	// rootCmd.AddCommand(roleCmd)
+	roleCmd.AddCommand(roleGetCmd, roleSetCmd, roleRemoveCmd, roleExpireCmd, roleGCTraverseCmd)
+	rootCmd.AddCommand(roleCmd)
 
 	// // administrator's CLI
 	// rolePdbCmd.PersistentFlags().IntVarP(
@@ -113,6 +247,10 @@ var roleCmd = &cobra.Command{
 	Use:   "role",
 	Short: "Manage data access role for projects",
 	Long:  ``,
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		loadStorage()
+		rootCmd.PersistentPreRun(cmd, args)
+	},
 }
 
 // roleGetCmd is the CLI command for setting project roles.
@@ -125,16 +263,22 @@ var roleGetCmd = &cobra.Command{
 		// the input argument starts with 7 digits (considered as project number)
 		ppathSym := args[0]
 		if matched, _ := regexp.MatchString("^[0-9]{7,}", ppathSym); matched {
-			ppathSym = filepath.Join(projectRootPath, ppathSym)
+			ppathSym = filepath.Join(projectRoot(""), ppathSym)
 		} else {
 			ppathSym, _ = filepath.Abs(ppathSym)
 		}
 
 		runner := acl.Runner{
-			RootPath:   ppathSym,
-			FollowLink: followSymlink,
-			SkipFiles:  skipFiles,
-			Nthreads:   numThreads,
+			RootPath:       ppathSym,
+			FollowLink:     followSymlink,
+			SkipFiles:      skipFiles,
+			Nthreads:       numThreads,
+			Output:         outputFormat,
+			Include:        walkInclude,
+			Exclude:        walkExclude,
+			MaxDepth:       walkMaxDepth,
+			SameFilesystem: walkSameFs,
+			SkipSnapshots:  !walkSnapshots,
 		}
 
 		return runner.PrintRoles(recursion)
@@ -151,23 +295,38 @@ var roleRemoveCmd = &cobra.Command{
 		// the input argument starts with 7 digits (considered as project number)
 		ppathSym := args[0]
 		if matched, _ := regexp.MatchString("^[0-9]{7,}", ppathSym); matched {
-			ppathSym = filepath.Join(projectRootPath, ppathSym)
+			ppathSym = filepath.Join(projectRoot(""), ppathSym)
 		} else {
 			ppathSym, _ = filepath.Abs(ppathSym)
 		}
 
 		runner := acl.Runner{
-			RootPath:     ppathSym,
-			Managers:     strings.Join([]string{uidsManager, uidsAll}, ","),
-			Contributors: strings.Join([]string{uidsContributor, uidsAll}, ","),
-			Viewers:      strings.Join([]string{uidsViewer, uidsAll}, ","),
-			Traversers:   uidsAll,
-			FollowLink:   followSymlink,
-			SkipFiles:    skipFiles,
-			Nthreads:     numThreads,
-			Silence:      silenceFlag,
-			Traverse:     false,
-			Force:        forceFlag,
+			RootPath:       ppathSym,
+			Managers:       strings.Join([]string{uidsManager, uidsAll}, ","),
+			Contributors:   strings.Join([]string{uidsContributor, uidsAll}, ","),
+			Writers:        strings.Join([]string{uidsWriter, uidsAll}, ","),
+			Viewers:        strings.Join([]string{uidsViewer, uidsAll}, ","),
+			Traversers:     uidsAll,
+			FollowLink:     followSymlink,
+			SkipFiles:      skipFiles,
+			Nthreads:       numThreads,
+			Silence:        silenceFlag,
+			Traverse:       false,
+			Force:          forceFlag,
+			DryRun:         dryRun,
+			Journal:        journalFlag,
+			Resume:         resumeFlag,
+			LockTimeout:    lockWait,
+			GrantRegistry:  grantRegistry,
+			Include:        walkInclude,
+			Exclude:        walkExclude,
+			MaxDepth:       walkMaxDepth,
+			SameFilesystem: walkSameFs,
+			SkipSnapshots:  !walkSnapshots,
+			Incremental:    incremental,
+			LastRunStore:   lastRunStore,
+			Limiter:        ufp.NewRateLimiter(opsRate, maxOps),
+			ControlFile:    controlFile,
 		}
 
 		_, err := runner.RemoveRoles()
@@ -185,25 +344,49 @@ var roleSetCmd = &cobra.Command{
 		// the input argument starts with 7 digits (considered as project number)
 		ppathSym := args[0]
 		if matched, _ := regexp.MatchString("^[0-9]{7,}", ppathSym); matched {
-			ppathSym = filepath.Join(projectRootPath, ppathSym)
+			ppathSym = filepath.Join(projectRoot(""), ppathSym)
 		} else {
 			ppathSym, _ = filepath.Abs(ppathSym)
 		}
 
+		expiry, err := parseExpiry(expiryDate)
+		if err != nil {
+			return err
+		}
+
 		runner := acl.Runner{
-			RootPath:     ppathSym,
-			Managers:     uidsManager,
-			Contributors: uidsContributor,
-			Viewers:      uidsViewer,
-			FollowLink:   followSymlink,
-			SkipFiles:    skipFiles,
-			Nthreads:     numThreads,
-			Silence:      silenceFlag,
-			Traverse:     true,
-			Force:        forceFlag,
-		}
-
-		_, err := runner.SetRoles()
+			RootPath:       ppathSym,
+			Managers:       uidsManager,
+			Contributors:   uidsContributor,
+			Writers:        uidsWriter,
+			Viewers:        uidsViewer,
+			FollowLink:     followSymlink,
+			SkipFiles:      skipFiles,
+			Nthreads:       numThreads,
+			Silence:        silenceFlag,
+			Traverse:       true,
+			Force:          forceFlag,
+			DryRun:         dryRun,
+			Journal:        journalFlag,
+			Resume:         resumeFlag,
+			LockTimeout:    lockWait,
+			Expiry:         expiry,
+			GrantRegistry:  grantRegistry,
+			Include:        walkInclude,
+			Exclude:        walkExclude,
+			MaxDepth:       walkMaxDepth,
+			SameFilesystem: walkSameFs,
+			SkipSnapshots:  !walkSnapshots,
+			Incremental:    incremental,
+			LastRunStore:   lastRunStore,
+			Limiter:        ufp.NewRateLimiter(opsRate, maxOps),
+			ControlFile:    controlFile,
+		}
+		if checkUsers != pdb.UserCheckNone {
+			runner.ValidatePrincipal = checkUsers.Validator(loadPdb())
+		}
+
+		_, err = runner.SetRoles()
 		return err
 	},
 }
@@ -244,3 +427,204 @@ var roleSetCmd = &cobra.Command{
 // }
 
 // var rolePdbGetPendingCmd = &cobra.Command{}
+
+// roleGCTraverseCmd is the CLI command for removing the obsolete traverse roles.
+var roleGCTraverseCmd = &cobra.Command{
+	Use:   "gc-traverse [ projectID | path ]",
+	Short: "Remove the obsolete traverse roles in a project or a path",
+	Long: `Remove the traverse roles of the users and groups that no longer have any other role below the directories.
+
+The traverse roles are set on the parent directories of the paths on which a role is set.  They are left behind
+after the roles on the paths are removed.  Use "--dry-run" to report the obsolete traverse roles without removing them.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// the input argument starts with 7 digits (considered as project number)
+		ppathSym := args[0]
+		if matched, _ := regexp.MatchString("^[0-9]{7,}", ppathSym); matched {
+			ppathSym = filepath.Join(projectRoot(""), ppathSym)
+		} else {
+			ppathSym, _ = filepath.Abs(ppathSym)
+		}
+
+		runner := acl.Runner{
+			RootPath:    ppathSym,
+			Nthreads:    numThreads,
+			DryRun:      dryRun,
+			LockTimeout: lockWait,
+			Limiter:     ufp.NewRateLimiter(opsRate, maxOps),
+			ControlFile: controlFile,
+		}
+
+		ctx, cancel := signalContext()
+		defer cancel()
+
+		res, err := runner.GCTraverse(ctx)
+		if err == nil {
+			log.Infof("%s", res)
+		}
+		return runnerErr(res, err)
+	},
+}
+
+// roleExpireCmd is the CLI command for removing the expired time-limited roles.
+var roleExpireCmd = &cobra.Command{
+	Use:   "expire",
+	Short: "Remove the expired time-limited roles and notify the project managers",
+	Long: `Remove the roles granted with an expiry date (i.e. "role set --expire") that have expired.
+
+The project managers are notified by email about the removed roles of their projects.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		reg, err := acl.OpenGrantRegistry(grantRegistry)
+		if err != nil {
+			return err
+		}
+		defer reg.Close()
+
+		grants, err := reg.Expired(time.Now())
+		if err != nil {
+			return err
+		}
+
+		if len(grants) == 0 {
+			log.Infof("no expired role")
+			return nil
+		}
+
+		// removed grants organized by project
+		removed := make(map[string][]mailer.ExpiredRole)
+
+		for _, g := range grants {
+
+			log.Infof("removing expired role %s of %s on %s", g.Role, g.Principal, g.Path)
+
+			if _, err := os.Stat(g.Path); os.IsNotExist(err) {
+				log.Warnf("path of expired role no longer exists: %s", g.Path)
+			} else if err := removeGrant(g); err != nil {
+				log.Errorf("cannot remove expired role %s of %s on %s: %s", g.Role, g.Principal, g.Path, err)
+				continue
+			}
+
+			if dryRun {
+				continue
+			}
+
+			if err := reg.Remove(g.Path, g.Principal); err != nil {
+				log.Errorf("%s", err)
+			}
+
+			if pid := grantProject(g); pid != "" {
+				removed[pid] = append(removed[pid], mailer.ExpiredRole{
+					Path:      g.Path,
+					Principal: g.Principal,
+					Role:      g.Role.String(),
+					Expiry:    g.Expiry,
+				})
+			}
+		}
+
+		if !notifyManagers || len(removed) == 0 {
+			return nil
+		}
+
+		conf := loadConfig()
+		ipdb, err := pdb.New(conf.PDB)
+		if err != nil {
+			return err
+		}
+
+		mailer := mailer.New(conf.SMTP)
+		for pid, grants := range removed {
+
+			p, err := ipdb.GetProject(pid)
+			if err != nil {
+				log.Errorf("[%s] fail getting project detail for notification: %s", pid, err)
+				continue
+			}
+
+			for _, m := range p.Members {
+				if m.Role != acl.Manager.String() {
+					continue
+				}
+
+				log.Debugf("[%s] sending notification to manager %s", pid, m.UserID)
+
+				u, err := ipdb.GetUser(m.UserID)
+				if err != nil {
+					log.Errorf("[%s] fail getting user profile of manager %s: %s", pid, m.UserID, err)
+					continue
+				}
+
+				if err := mailer.NotifyRoleGrantsExpired(*u, pid, p.Name, grants); err != nil {
+					log.Errorf("[%s] fail notifying manager %s: %s", pid, m.UserID, err)
+				}
+			}
+		}
+
+		return nil
+	},
+}
+
+// parseExpiry parses the `date` (YYYY-MM-DD) into the time at which the roles expire, i.e.
+// the end of the date in the local time zone.  The zero time is returned for an empty `date`.
+func parseExpiry(date string) (time.Time, error) {
+	if date == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.ParseInLocation("2006-01-02", date, time.Local)
+	if err != nil {
+		return t, fmt.Errorf("invalid expiry date %s: %s", date, err)
+	}
+	return t.AddDate(0, 0, 1), nil
+}
+
+// removeGrant removes the role of the grant `g` from the path of the grant.
+func removeGrant(g acl.Grant) error {
+
+	runner := acl.Runner{
+		RootPath:    g.Path,
+		FollowLink:  followSymlink,
+		SkipFiles:   skipFiles,
+		Nthreads:    numThreads,
+		Silence:     silenceFlag,
+		Force:       forceFlag,
+		DryRun:      dryRun,
+		LockTimeout: lockWait,
+	}
+
+	switch g.Role {
+	case acl.Manager:
+		runner.Managers = g.Principal
+	case acl.Contributor:
+		runner.Contributors = g.Principal
+	case acl.Writer:
+		runner.Writers = g.Principal
+	case acl.Viewer:
+		runner.Viewers = g.Principal
+	default:
+		return fmt.Errorf("unsupported role: %s", g.Role)
+	}
+
+	ec, err := runner.RemoveRoles()
+	if err == nil && ec != 0 {
+		err = fmt.Errorf("exit code %d", ec)
+	}
+	return err
+}
+
+// grantProject returns the id of the project in which the path of the grant `g` is located,
+// or an empty string if the path is not in a project directory of any storage system.
+func grantProject(g acl.Grant) string {
+	for _, sys := range storage.Systems {
+		rel, err := filepath.Rel(sys.ProjectRoot, g.Path)
+		if err != nil {
+			continue
+		}
+		pid := strings.Split(rel, string(os.PathSeparator))[0]
+		if matched, _ := regexp.MatchString("^[0-9]{7}\\.[0-9]{2}$", pid); matched {
+			return pid
+		}
+	}
+	return ""
+}
@@ -1,11 +1,16 @@
 package pdbutil
 
 import (
+	"context"
 	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/Donders-Institute/tg-toolset-golang/pkg/config"
 	log "github.com/Donders-Institute/tg-toolset-golang/pkg/logger"
+	"github.com/Donders-Institute/tg-toolset-golang/project/pkg/acl"
 	"github.com/Donders-Institute/tg-toolset-golang/project/pkg/pdb"
+	"github.com/Donders-Institute/tg-toolset-golang/project/pkg/vol"
 	"github.com/spf13/cobra"
 )
 
@@ -36,6 +41,54 @@ func loadConfig() config.Configuration {
 	return conf
 }
 
+// storage is the configuration of the storage systems loaded by `loadStorage`.
+var storage config.StorageConfiguration
+
+// loadStorage loads the storage systems from the configuration YAML file, and configures
+// the rolers and the volume managers accordingly.
+// This function fatals out if there is an error.
+func loadStorage() config.StorageConfiguration {
+	conf := loadConfig()
+	if err := acl.ConfigureRolers(conf.Storage); err != nil {
+		log.Fatalf("%s", err)
+	}
+	if err := vol.ConfigureVolumeManagers(conf.Storage); err != nil {
+		log.Fatalf("%s", err)
+	}
+	storage = conf.Storage
+	return storage
+}
+
+// projectRoot returns the project root of the storage system `sys` loaded by `loadStorage`.
+// The project root of the default storage system is returned if `sys` is an empty string.
+func projectRoot(sys string) string {
+	if sys == "" {
+		return storage.ProjectRoot()
+	}
+	s, _ := storage.System(sys)
+	return s.ProjectRoot
+}
+
+// signalContext returns a context cancelled upon the interrupt and termination signals,
+// for stopping the long-running actions gracefully.
+func signalContext() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	chanS := make(chan os.Signal, 1)
+	signal.Notify(chanS, syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		defer signal.Stop(chanS)
+		select {
+		case s := <-chanS:
+			log.Warnf("stopping due to received signal: %s", s)
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	return ctx, cancel
+}
+
 // loadPdb initializes the PDB interface package using the configuration YAML file.
 // This function fatals out if there is an error.
 func loadPdb() pdb.PDB {
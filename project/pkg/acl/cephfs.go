@@ -1,11 +1,11 @@
 package acl
 
 import (
-	"bufio"
 	"fmt"
-	"os/exec"
+	"os"
 	"os/user"
 	"path/filepath"
+	"runtime"
 	"strings"
 	"syscall"
 	"unsafe"
@@ -19,240 +19,41 @@ import (
 // file attribute for registering managers
 const fattrManagers string = "trusted.managers"
 
+// file attribute for registering writers
+const fattrWriters string = "trusted.writers"
+
 // CephFsRoler implements roler interface for the CephFS.
+//
+// The POSIX ACL does not distinguish the permission of deleting a file from the
+// permission of creating it.  The writer role is therefore approximated by the
+// same permission as the contributor role (i.e. `rwX`), with the writers registered
+// in the `trusted.writers` file attribute so that the role can be resolved.  On the
+// CephFS, a writer is NOT prevented from deleting files.
 type CephFsRoler struct{}
 
+// cephfsRoles is the role management of the CephFsRoler.
+var cephfsRoles = posixACLRoler{
+	fattrManagers: fattrManagers,
+	fattrWriters:  fattrWriters,
+	setACEs:       setPosixACEs,
+}
+
 // GetRoles implements interface for getting user roles on a given path mounted to
 // an endpoint of the CephFS.
 func (CephFsRoler) GetRoles(pinfo ufp.FilePathMode) (RoleMap, error) {
-
-	// make pinfo.Path "clean"
-	pinfo.Path = filepath.Clean(pinfo.Path)
-
-	rmap := map[Role][]string{
-		Manager:     {},
-		Contributor: {},
-		Viewer:      {},
-		Traverse:    {},
-	}
-
-	// skip the permission mask
-	aces, _, err := getfacl(pinfo.Path)
-	if err != nil {
-		return rmap, err
-	}
-
-	for _, ace := range aces {
-		log.Debugf("%s", ace)
-		r := ace.ToRole()
-		rmap[r] = append(rmap[r], ace.Qualifier)
-	}
-
-	return rmap, nil
+	return cephfsRoles.getRoles(pinfo)
 }
 
 // SetRoles implements interface for setting user roles to a given path mounted to
 // an endpoint of the CephFS.
-func (r CephFsRoler) SetRoles(pinfo ufp.FilePathMode, roles RoleMap, recursive bool, followLink bool) (RoleMap, error) {
-
-	// make pinfo.Path "clean"
-	pinfo.Path = filepath.Clean(pinfo.Path)
-
-	// don't recalculate the mask.
-	args := []string{"-n"}
-
-	// recursion
-	if recursive && pinfo.Mode.IsDir() {
-		args = append(args, "-R")
-	}
-
-	// compose the -m argument
-	marg := ""
-	noManagers := []string{}
-	for r, users := range roles {
-		switch r {
-		case Manager:
-			for _, u := range users {
-				if pinfo.Mode.IsDir() {
-					marg = fmt.Sprintf("u:%s:rwX,d:u:%s:rwX,%s", u, u, marg)
-				} else {
-					marg = fmt.Sprintf("u:%s:rwX,%s", u, marg)
-				}
-			}
-		case Contributor:
-			noManagers = append(noManagers, users...)
-			for _, u := range users {
-				if pinfo.Mode.IsDir() {
-					marg = fmt.Sprintf("u:%s:rwX,d:u:%s:rwX,%s", u, u, marg)
-				} else {
-					marg = fmt.Sprintf("u:%s:rwX,%s", u, marg)
-				}
-			}
-		case Viewer:
-			noManagers = append(noManagers, users...)
-			for _, u := range users {
-				if pinfo.Mode.IsDir() {
-					marg = fmt.Sprintf("u:%s:rX,d:u:%s:rX,%s", u, u, marg)
-				} else {
-					marg = fmt.Sprintf("u:%s:rX,%s", u, marg)
-				}
-			}
-		case Traverse:
-			noManagers = append(noManagers, users...)
-			for _, u := range users {
-				if pinfo.Mode.IsDir() {
-					marg = fmt.Sprintf("u:%s:--X,%s", u, marg)
-				}
-			}
-		default:
-			noManagers = append(noManagers, users...)
-		}
-	}
-
-	if marg == "" {
-		log.Debugf("empty -m argument, skip setfacl.")
-		return r.GetRoles(pinfo)
-	}
-
-	args = append(args, "-m", marg)
-	log.Debugf("setfacl -m arguments: %s", marg)
-
-	if err := setfacl(pinfo.Path, args); err != nil {
-		log.Errorf("%s", err)
-	} else {
-		// set fattrManagers for the newly added managers.
-		r.setManagers(pinfo.Path, roles[Manager])
-		// del fattrManagers in case managers are downgraded to other roles.
-		r.delManagers(pinfo.Path, noManagers)
-	}
-
-	return r.GetRoles(pinfo)
+func (CephFsRoler) SetRoles(pinfo ufp.FilePathMode, roles RoleMap, recursive bool, followLink bool) (RoleMap, error) {
+	return cephfsRoles.setRoles(pinfo, roles, recursive)
 }
 
 // DelRoles implements interface for removing users from the specified roles on a path
 // mounted to an endpoint of the CephFS.
-func (r CephFsRoler) DelRoles(pinfo ufp.FilePathMode, roles RoleMap, recursive bool, followLink bool) (RoleMap, error) {
-
-	// make pinfo.Path "clean"
-	pinfo.Path = filepath.Clean(pinfo.Path)
-
-	// don't recalculate the mask.
-	args := []string{"-n"}
-
-	// recursion
-	if recursive && pinfo.Mode.IsDir() {
-		args = append(args, "-R")
-	}
-
-	// compose the -x argument
-	marg := ""
-	noManagers := []string{}
-	for _, users := range roles {
-		log.Debugf("%+v", users)
-		noManagers = append(noManagers, users...)
-		for _, u := range users {
-			marg = fmt.Sprintf("u:%s,d:u:%s,%s", u, u, marg)
-		}
-	}
-	if marg == "" {
-		log.Debugf("empty -x argument, skip setfacl.")
-		return r.GetRoles(pinfo)
-	}
-
-	args = append(args, "-x", marg)
-	log.Debugf("setfacl -x arguments: %s", marg)
-
-	if err := setfacl(pinfo.Path, args); err != nil {
-		log.Errorf("%s", err)
-	} else {
-		// del fattrManagers in case managers are downgraded to other roles.
-		r.delManagers(pinfo.Path, noManagers)
-	}
-
-	return r.GetRoles(pinfo)
-}
-
-// setManagers sets list of `users` into the `user.project.managers` file
-// attribute of the `path`.
-func (r CephFsRoler) setManagers(path string, users []string) {
-
-	// get managers already in the user.project.managers file attribute.
-	d, err := xattr.Get(path, fattrManagers)
-	if err != nil {
-		// use debugf since it is fine that files/sub-directories do not have
-		// the `user.project.managers` attribute.
-		log.Debugf("cannot get manager list of %s: %s", path, err)
-	}
-	m := strings.Split(string(d), ",")
-
-	// construct a new list of managers to be set on this path.
-	// Note: if the user is already a manager of the parent path, it will not
-	// be added to the manager of this path.
-	for _, u := range users {
-		if !isManager(path, u) {
-			m = append(m, u)
-		}
-	}
-
-	// set fattrManagers file attribute with the new list of managers
-	if err := xattr.Set(path, fattrManagers, []byte(strings.Join(m, ","))); err != nil {
-		log.Errorf("cannot set manager list of %s: %s", path, err)
-	}
-
-	return
-}
-
-// delManagers removes list of `users` from the `user.project.managers` file
-// attribute of the `path` and its parents.
-func (r CephFsRoler) delManagers(path string, users []string) {
-
-	// get managers in the user.project.managers file attribute.
-	d, err := xattr.Get(path, fattrManagers)
-	if err != nil {
-		// use debugf since it is fine that files/sub-directories do not have
-		// the `user.project.managers` attribute.
-		log.Debugf("cannot get manager list of %s: %s", path, err)
-	}
-
-	m := make(map[string]bool)
-	for _, u := range strings.Split(string(d), ",") {
-		m[u] = true
-	}
-
-	// construct a new list of managers to be applied on this path
-	for _, u := range users {
-		if _, ok := m[u]; ok { // user to be deleted is found in the current manager list
-			delete(m, u)
-		}
-	}
-	nm := make([]string, 0, len(m))
-	for u := range m {
-		nm = append(nm, u)
-	}
-
-	// set fattrManagers file attribute with the new list of managers
-	if err := xattr.Set(path, fattrManagers, []byte(strings.Join(nm, ","))); err != nil {
-		log.Errorf("cannot set manager list of %s: %s", path, err)
-	}
-
-	// move to parent directory
-	path = filepath.Dir(path)
-
-	// path reaches one of the root directories in which projects
-	// are organized.
-	if _, ok := RolerMap[path]; ok {
-		return
-	}
-
-	// path reaches the absolute or relative root.
-	if path == "/" || path == "." || path == ".." {
-		return
-	}
-
-	// delete managers from the parent.
-	r.delManagers(path, users)
-
-	return
+func (CephFsRoler) DelRoles(pinfo ufp.FilePathMode, roles RoleMap, recursive bool, followLink bool) (RoleMap, error) {
+	return cephfsRoles.delRoles(pinfo, roles, recursive)
 }
 
 // PosixACE is the posix-style access-control entry
@@ -260,50 +61,50 @@ type PosixACE struct {
 	Tag        string
 	Qualifier  string
 	Permission string
-	path       string
+	// Default indicates whether the ACE is an entry of the default ACL.
+	Default bool
+	path    string
 }
 
-// ToRole maps the permission to project role.
-func (ace PosixACE) ToRole() Role {
-	var role Role
-
-	switch ace.Permission {
-	case "--x":
-		role = Traverse
-	case "r-x":
-		role = Viewer
-	case "r--":
-		role = Viewer
-	case "rwx":
-		role = Contributor
-		if isManager(ace.path, ace.Qualifier) {
-			role = Manager
-		}
-	case "rw-":
-		role = Contributor
-		if isManager(ace.path, ace.Qualifier) {
-			role = Manager
-		}
-	default:
+// newPosixACE constructs the PosixACE of the `principal` referring to a user or a group
+// (see `ParsePrincipal`) with the permission `perm`.  The `dflt` flag indicates whether the
+// ACE is an entry of the default ACL.
+func newPosixACE(principal, perm string, dflt bool) PosixACE {
+	name, group := ParsePrincipal(principal)
+	tag := "user"
+	if group {
+		tag = "group"
+	}
+	return PosixACE{Tag: tag, Qualifier: name, Permission: perm, Default: dflt}
+}
+
+// Principal returns the principal of the named user or group referred by the ACE.
+// The principal of a group is prefixed with `g:` (see `GroupPrincipal`).
+func (ace PosixACE) Principal() string {
+	if ace.Tag == "group" {
+		return GroupPrincipal(ace.Qualifier)
 	}
+	return ace.Qualifier
+}
 
-	return role
+// ToRole maps the permission to project role, with the managers and writers
+// registered for the CephFS.
+func (ace PosixACE) ToRole() Role {
+	return cephfsRoles.toRole(ace)
 }
 
-// isManager checks if the given `username` is listed as a manager in the extended attribute
-// `user.project.managers` of the given `path` and its predecending paths up to the
-// project's top directory.
+// isManager checks if the given `username`, or the principal of a group (see `ParsePrincipal`),
+// is listed as a manager in the extended attribute `user.project.managers` of the given `path`
+// and its predecending paths up to the project's top directory.
 //
 // It will check on current user if the `username` is an empty string.
 func isManager(path, username string) bool {
 
-	out := false
-
 	if username == "" {
 		me, err := user.Current()
 		if err != nil {
 			log.Errorf("cannot get current  user: %s", err)
-			return out
+			return false
 		}
 		username = me.Username
 	}
@@ -313,20 +114,30 @@ func isManager(path, username string) bool {
 		return true
 	}
 
+	return isListed(path, fattrManagers, username)
+}
+
+// isListed checks if the given `principal` is listed in the file attribute `fattr`
+// (i.e. `fattrManagers` or `fattrWriters`) of the given `path` and its predecending
+// paths up to the project's top directory.
+func isListed(path, fattr, principal string) bool {
+
+	out := false
+
 	for {
 
-		d, err := xattr.Get(path, fattrManagers)
-		//d, err := getfattr(path, fattrManagers)
+		d, err := xattr.Get(path, fattr)
+		//d, err := getfattr(path, fattr)
 		if err != nil {
 			// use debugf since it is fine that files/sub-directories do not have
-			// the `user.project.managers` attribute.
-			log.Debugf("cannot get manager list of %s: %s", path, err)
+			// the file attribute.
+			log.Debugf("cannot get %s list of %s: %s", fattr, path, err)
 		}
 
-		log.Debugf("manager list of %s: %s", path, d)
+		log.Debugf("%s list of %s: %s", fattr, path, d)
 
-		// found current user on the manager list.
-		if strings.Contains(string(d), username) {
+		// found the principal on the list.
+		if hasPrincipal(strings.Split(string(d), ","), principal) {
 			out = true
 			break
 		}
@@ -376,79 +187,32 @@ func isManager(path, username string) bool {
 // 	// return stdout, nil
 // }
 
-// getfacl is a wrapper of `getfacl` command and returns only the
-// non-default extended ACEs applied on the `path`.
-func getfacl(path string) ([]PosixACE, string, error) {
+// getPosixACEs returns only the non-default extended ACEs applied on the `path`,
+// together with the permission of the mask.  ACEs of users or groups unknown to
+// the system are ignored.
+func getPosixACEs(path string) ([]PosixACE, string, error) {
 
 	out := []PosixACE{}
 
 	mask := ""
 
-	cmd := exec.Command("getfacl", "--omit-header", path)
-
-	stdout, err := cmd.StdoutPipe()
+	acl, err := getPosixACL(path, false)
 	if err != nil {
 		return out, mask, err
 	}
 
-	if err = cmd.Start(); err != nil {
-		return out, mask, err
-	}
-
-	outScanner := bufio.NewScanner(stdout)
-	outScanner.Split(bufio.ScanLines)
-
-	for outScanner.Scan() {
-		l := outScanner.Text()
-
-		// skip lines starts with `#` or `default` or empty lines
-		if strings.HasPrefix(l, "#") || strings.HasPrefix(l, "default") || l == "" {
-			continue
-		}
-
-		// trim the effective permission and split the ACE fields
-		d := strings.Split(strings.Split(l, "\t")[0], ":")
-
-		// skip entry where the qualifier is empty or invalid
-		if len(d) < 3 {
-			log.Warnf("cannot parse ACL entry: %s", l)
-		}
-
-		if d[1] == "" {
-			continue
-		}
-
-		switch d[0] {
-		case "user":
-			if _, err := user.Lookup(d[1]); err != nil {
-				continue
-			}
-		case "group":
-			if _, err := user.LookupGroup(d[1]); err != nil {
-				continue
-			}
-		case "mask":
-			mask = d[2]
+	for _, e := range acl {
+		switch e.Tag {
+		case posixACLMask:
+			mask = posixPermString(e.Perm)
 			continue
+		case posixACLUser, posixACLGroup:
 		default:
+			// skip entries without qualifier
 			continue
 		}
-		out = append(out, PosixACE{
-			Tag:        d[0],
-			Qualifier:  d[1],
-			Permission: d[2],
-			path:       path,
-		})
-	}
 
-	if err = outScanner.Err(); err != nil {
-		log.Errorf("error reading output of command: %s", err)
-	}
-
-	// wait the cmd to finish and the IO pipes are closed.
-	// write out error if the command execution is failed.
-	if err = cmd.Wait(); err != nil {
-		log.Errorf("%s fail: %s", cmd.String(), err)
+		out = append(out, posixACEFromEntry(e, path))
 	}
 
 	return out, mask, nil
@@ -507,45 +271,150 @@ func getCaps() (caps, error) {
 // 	}
 // }
 
-// setfacl is a wrapper of executing the `setfacl` command on the given `path`
-// with the arguments `args`.
+// setPosixACEs sets (or removes if `remove` is true) the `aces` on the given `path`.
+// The existing mask is not recalculated.  If `recursive` is true, the `aces` are also
+// applied on all files and sub-directories under the `path`.
 //
-// It employees the Linux capability `CAP_OWNER` to allow managers of the `path`
+// It employees the Linux capability `CAP_FOWNER` to allow managers of the `path`
 // to modify the ACLs.
-func setfacl(path string, args []string) error {
+func setPosixACEs(path string, aces []PosixACE, remove bool, recursive bool) error {
 
 	if !isManager(path, "") {
 		return fmt.Errorf("permission denied: not a manager")
 	}
 
+	return withCapFowner(func() error {
+		return updatePosixACEs(path, aces, remove, recursive)
+	})
+}
+
+// updatePosixACEs applies (or removes if `remove` is true) the `aces` on the given `path`,
+// and on all files and sub-directories under the `path` if `recursive` is true.  The
+// recursive update continues on the paths on which the ACL fails to be updated.
+func updatePosixACEs(path string, aces []PosixACE, remove bool, recursive bool) error {
+	if !recursive {
+		return updatePosixACL(path, aces, remove)
+	}
+	return walkApply(path, false, func(p string) error {
+		return updatePosixACL(p, aces, remove)
+	})
+}
+
+// updatePosixACL applies the `aces` on the access and default ACL of the given `path`.
+// The ACEs are removed if `remove` is true; otherwise they are added or modified.
+func updatePosixACL(path string, aces []PosixACE, remove bool) error {
+
+	fi, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	// `X` permission resolves to execute permission for directories
+	// and files executable by someone.
+	exec := fi.IsDir() || fi.Mode()&0111 != 0
+
+	acl, err := getPosixACL(path, false)
+	if err != nil {
+		return fmt.Errorf("cannot get acl of %s: %s", path, err)
+	}
+
+	var dacl posixACL
+	if fi.IsDir() {
+		if dacl, err = getPosixACL(path, true); err != nil {
+			return fmt.Errorf("cannot get default acl of %s: %s", path, err)
+		}
+		// initialize the default ACL from the access ACL, as `setfacl` does.
+		if len(dacl) == 0 && !remove {
+			for _, e := range acl {
+				switch e.Tag {
+				case posixACLUserObj, posixACLGroupObj, posixACLOther:
+					dacl = append(dacl, e)
+				}
+			}
+		}
+	}
+
+	dchanged := false
+	for _, ace := range aces {
+		target := &acl
+		if ace.Default {
+			// default ACL only applies to directories.
+			if len(dacl) == 0 {
+				continue
+			}
+			target = &dacl
+			dchanged = true
+		}
+
+		e, err := posixEntryFromACE(ace, exec)
+		if err != nil {
+			return fmt.Errorf("invalid ACE %+v: %s", ace, err)
+		}
+
+		if remove {
+			target.remove(e.Tag, e.ID)
+		} else {
+			target.set(e.Tag, e.ID, e.Perm)
+		}
+	}
+
+	acl.ensureMask()
+	if err := setPosixACL(path, acl, false); err != nil {
+		return fmt.Errorf("cannot set acl of %s: %s", path, err)
+	}
+
+	if dchanged {
+		dacl.ensureMask()
+		if err := setPosixACL(path, dacl, true); err != nil {
+			return fmt.Errorf("cannot set default acl of %s: %s", path, err)
+		}
+	}
+
+	return nil
+}
+
+// withCapFowner runs the function `f` with the Linux capability `CAP_FOWNER` raised
+// in the effective capability set of the current thread.  The capability can only
+// be raised if it is in the permitted capability set of the process.
+func withCapFowner(f func() error) error {
+
+	// capabilities are per-thread attributes; make sure `f` runs on the same
+	// thread on which the capability is raised.
+	runtime.LockOSThread()
+
 	// get current user's linux capability
-	caps, err := getCaps()
+	c, err := getCaps()
 	if err != nil {
+		runtime.UnlockOSThread()
 		return fmt.Errorf("cannot get capability: %s", err)
 	}
 
-	// add CAP_FOWNER capability to the permitted and inheritable capability mask.
 	const capFowner = 3
-	caps.data[0].permitted |= 1 << uint(capFowner)
-	caps.data[0].inheritable |= 1 << uint(capFowner)
-	if _, _, errno := syscall.Syscall(syscall.SYS_CAPSET, uintptr(unsafe.Pointer(&caps.hdr)), uintptr(unsafe.Pointer(&caps.data[0])), 0); errno != 0 {
-		return fmt.Errorf("cannot set CAP_FOWNER capability: %v", errno)
+	if c.data[0].effective&(1<<uint(capFowner)) != 0 {
+		defer runtime.UnlockOSThread()
+		return f()
 	}
 
-	// execute the setfacl command
-	// try running the setfacl on a file the current user is not the owner
-	cmd := exec.Command("setfacl", append(args, path)...)
-	cmd.SysProcAttr = &syscall.SysProcAttr{
-		AmbientCaps: []uintptr{capFowner},
+	// add CAP_FOWNER capability to the effective capability mask.
+	cf := c
+	cf.data[0].effective |= 1 << uint(capFowner)
+	if _, _, errno := syscall.Syscall(syscall.SYS_CAPSET, uintptr(unsafe.Pointer(&cf.hdr)), uintptr(unsafe.Pointer(&cf.data[0])), 0); errno != 0 {
+		// continue without the capability, the kernel decides whether the
+		// current user is allowed to modify the ACL.
+		log.Debugf("cannot set CAP_FOWNER capability: %v", errno)
+		defer runtime.UnlockOSThread()
+		return f()
 	}
 
-	stdout, err := cmd.Output()
-	log.Debugf("setfacl stdout: %s", string(stdout))
-	if err != nil {
-		if ee, ok := err.(*exec.ExitError); ok {
-			log.Errorf("setfacl stderr: %s", string(ee.Stderr))
-		}
+	err = f()
+
+	// restore the capability; the thread is left locked and therefore terminated
+	// with the goroutine if the restoring fails.
+	if _, _, errno := syscall.Syscall(syscall.SYS_CAPSET, uintptr(unsafe.Pointer(&c.hdr)), uintptr(unsafe.Pointer(&c.data[0])), 0); errno != 0 {
+		log.Errorf("cannot restore capability: %v", errno)
+		return err
 	}
+	runtime.UnlockOSThread()
 
 	return err
 }
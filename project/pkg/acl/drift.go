@@ -0,0 +1,114 @@
+package acl
+
+import (
+	"sort"
+)
+
+// UserRole associates a user with a role.
+type UserRole struct {
+	User string `json:"user" yaml:"user"`
+	Role Role   `json:"role" yaml:"role"`
+}
+
+// RoleMismatch describes a user who has roles different from the expected one.
+type RoleMismatch struct {
+	User     string `json:"user" yaml:"user"`
+	Expected Role   `json:"expected" yaml:"expected"`
+	Actual   []Role `json:"actual" yaml:"actual"`
+}
+
+// RoleDrift is a data structure describing how the roles on a path deviate from
+// the expected roles.
+type RoleDrift struct {
+	Path string `json:"path" yaml:"path"`
+	// Missing contains users expected in a role but having no role on the path.
+	Missing []UserRole `json:"missing,omitempty" yaml:"missing,omitempty"`
+	// Extra contains users having a role on the path but not expected in any role.
+	Extra []UserRole `json:"extra,omitempty" yaml:"extra,omitempty"`
+	// Mismatched contains users having roles other than the expected one.
+	Mismatched []RoleMismatch `json:"mismatched,omitempty" yaml:"mismatched,omitempty"`
+}
+
+// HasDrift checks if there is any deviation from the expected roles.
+func (d RoleDrift) HasDrift() bool {
+	return len(d.Missing) > 0 || len(d.Extra) > 0 || len(d.Mismatched) > 0
+}
+
+// CompareRoles compares the `actual` roles on a path against the `expected` roles, and
+// returns the deviations as a RoleDrift.  The Traverse and System roles are not considered
+// as they are not project membership.  The entries of the RoleDrift are sorted by user.
+func CompareRoles(path string, expected, actual RoleMap) RoleDrift {
+
+	drift := RoleDrift{Path: path}
+
+	emap := userRoles(expected)
+	amap := userRoles(actual)
+
+	for u, eroles := range emap {
+		aroles, ok := amap[u]
+		if !ok {
+			for _, r := range eroles {
+				drift.Missing = append(drift.Missing, UserRole{User: u, Role: r})
+			}
+			continue
+		}
+		// a user is expected in only one role; the first one is taken if it is not the case.
+		if len(aroles) != 1 || aroles[0] != eroles[0] {
+			drift.Mismatched = append(drift.Mismatched, RoleMismatch{User: u, Expected: eroles[0], Actual: aroles})
+		}
+	}
+
+	for u, aroles := range amap {
+		if _, ok := emap[u]; ok {
+			continue
+		}
+		for _, r := range aroles {
+			drift.Extra = append(drift.Extra, UserRole{User: u, Role: r})
+		}
+	}
+
+	sort.Slice(drift.Missing, func(i, j int) bool { return drift.Missing[i].User < drift.Missing[j].User })
+	sort.Slice(drift.Extra, func(i, j int) bool { return drift.Extra[i].User < drift.Extra[j].User })
+	sort.Slice(drift.Mismatched, func(i, j int) bool { return drift.Mismatched[i].User < drift.Mismatched[j].User })
+
+	return drift
+}
+
+// userRoles converts the RoleMap into a map of user to the roles of the user, in the
+// order of `rolesInOrder`.  The Traverse and System roles are left out.
+func userRoles(m RoleMap) map[string][]Role {
+	umap := make(map[string][]Role)
+	for _, r := range rolesInOrder {
+		if r == Traverse {
+			continue
+		}
+		for _, u := range m[r] {
+			umap[u] = append(umap[u], r)
+		}
+	}
+	return umap
+}
+
+// Changes returns the role changes for repairing the drift: the roles to be set on the
+// path for the missing and mismatched users, and the roles to be removed from the path
+// for the extra users.  Users in `ignore` are left out.
+func (d RoleDrift) Changes(ignore map[string]bool) (set, del RoleMap) {
+	set = make(RoleMap)
+	del = make(RoleMap)
+	for _, m := range d.Missing {
+		if !ignore[m.User] {
+			set[m.Role] = append(set[m.Role], m.User)
+		}
+	}
+	for _, m := range d.Mismatched {
+		if !ignore[m.User] {
+			set[m.Expected] = append(set[m.Expected], m.User)
+		}
+	}
+	for _, m := range d.Extra {
+		if !ignore[m.User] {
+			del[m.Role] = append(del[m.Role], m.User)
+		}
+	}
+	return
+}
@@ -0,0 +1,61 @@
+package acl
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestCompareRoles(t *testing.T) {
+	expected := RoleMap{
+		Manager:     {"honlee"},
+		Contributor: {"edwger", "rendbru"},
+	}
+	actual := RoleMap{
+		Manager:  {"honlee"},
+		Viewer:   {"edwger", "dirkmol"},
+		Traverse: {"marvdhe"},
+		System:   {"OWNER@"},
+	}
+
+	d := CompareRoles("/project/3010000.01", expected, actual)
+
+	if !d.HasDrift() {
+		t.Errorf("expect drift")
+	}
+	if e := []UserRole{{User: "rendbru", Role: Contributor}}; !reflect.DeepEqual(d.Missing, e) {
+		t.Errorf("expect missing %v, got %v", e, d.Missing)
+	}
+	if e := []UserRole{{User: "dirkmol", Role: Viewer}}; !reflect.DeepEqual(d.Extra, e) {
+		t.Errorf("expect extra %v, got %v", e, d.Extra)
+	}
+	if e := []RoleMismatch{{User: "edwger", Expected: Contributor, Actual: []Role{Viewer}}}; !reflect.DeepEqual(d.Mismatched, e) {
+		t.Errorf("expect mismatched %v, got %v", e, d.Mismatched)
+	}
+
+	b, _ := json.Marshal(d.Mismatched)
+	if e := `[{"user":"edwger","expected":"contributor","actual":["viewer"]}]`; string(b) != e {
+		t.Errorf("expect json %s, got %s", e, b)
+	}
+
+	if d := CompareRoles("/project/3010000.01", expected, expected); d.HasDrift() {
+		t.Errorf("unexpected drift: %+v", d)
+	}
+}
+
+func TestRoleDriftChanges(t *testing.T) {
+	d := RoleDrift{
+		Missing:    []UserRole{{User: "rendbru", Role: Contributor}},
+		Extra:      []UserRole{{User: "dirkmol", Role: Viewer}, {User: "marvdhe", Role: Viewer}},
+		Mismatched: []RoleMismatch{{User: "edwger", Expected: Contributor, Actual: []Role{Viewer}}},
+	}
+
+	set, del := d.Changes(map[string]bool{"marvdhe": true})
+
+	if e := (RoleMap{Contributor: {"rendbru", "edwger"}}); !reflect.DeepEqual(set, e) {
+		t.Errorf("expect set %v, got %v", e, set)
+	}
+	if e := (RoleMap{Viewer: {"dirkmol"}}); !reflect.DeepEqual(del, e) {
+		t.Errorf("expect del %v, got %v", e, del)
+	}
+}
@@ -0,0 +1,226 @@
+package acl
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
+
+	ufp "github.com/Donders-Institute/tg-toolset-golang/pkg/filepath"
+	log "github.com/Donders-Institute/tg-toolset-golang/pkg/logger"
+)
+
+// FailureReport is the report of the paths on which the roles failed to be set or removed
+// by the Runner.  It is written in JSON, and can be fed back to the Runner for a rerun on
+// the failed paths (see `Runner.RerunFailures`).
+type FailureReport struct {
+	// Action is the action of the run: `set` or `delete`.
+	Action string `json:"action"`
+	// Root is the top-level path of the run.
+	Root string `json:"root"`
+	// Created is the time at which the report is created.
+	Created time.Time `json:"created"`
+	// Failures are the failed paths.
+	Failures []Failure `json:"failures"`
+}
+
+// Failure is a path on which the roles failed to be set or removed.
+type Failure struct {
+	// Path is the failed path.
+	Path string `json:"path"`
+	// Roles are the roles to be set on, or removed from, the path.
+	Roles RoleMap `json:"roles"`
+	// Error is the error message of the last attempt.
+	Error string `json:"error"`
+}
+
+// LoadFailureReport reads the FailureReport from the file `fpath`.
+func LoadFailureReport(fpath string) (*FailureReport, error) {
+	data, err := ioutil.ReadFile(fpath)
+	if err != nil {
+		return nil, err
+	}
+
+	var report FailureReport
+	if err := json.Unmarshal(data, &report); err != nil {
+		return nil, fmt.Errorf("invalid failure report %s: %s", fpath, err)
+	}
+
+	switch report.Action {
+	case "set", "delete":
+	default:
+		return nil, fmt.Errorf("invalid failure report %s: unknown action %q", fpath, report.Action)
+	}
+
+	return &report, nil
+}
+
+// writeFailureReport writes the failed paths in the `res` into the `Runner.FailureReport`,
+// or removes the report if there is no failure.  The `remove` flag indicates whether the
+// roles are removed by the run.
+func (r Runner) writeFailureReport(res RunResult, remove bool) error {
+
+	if r.FailureReport == "" {
+		return nil
+	}
+
+	if res.Failed == 0 {
+		if err := os.Remove(r.FailureReport); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("cannot remove failure report %s: %s", r.FailureReport, err)
+		}
+		return nil
+	}
+
+	report := FailureReport{
+		Action:   "set",
+		Root:     r.ppath,
+		Created:  time.Now(),
+		Failures: make([]Failure, 0, len(res.Errors)),
+	}
+	if remove {
+		report.Action = "delete"
+	}
+	for _, e := range res.Errors {
+		report.Failures = append(report.Failures, Failure{Path: e.Path, Roles: e.Roles, Error: e.Err.Error()})
+	}
+
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(r.FailureReport, data, 0600); err != nil {
+		return fmt.Errorf("cannot write failure report %s: %s", r.FailureReport, err)
+	}
+
+	log.Warnf("%d failed paths reported in %s", res.Failed, r.FailureReport)
+	return nil
+}
+
+// retryFailures retries setting, or removing if `remove` is true, the roles on the failed
+// paths for `Runner.Retries` times.  It waits for `Runner.RetryBackoff` before the first
+// retry, and the wait is doubled after every retry.  It stops when the `ctx` is cancelled.
+func (r Runner) retryFailures(ctx context.Context, remove bool) {
+
+	backoff := r.RetryBackoff
+	for i := 1; i <= r.Retries; i++ {
+
+		failures := r.collector.takeFailures()
+		if len(failures) == 0 {
+			return
+		}
+
+		log.Warnf("retrying %d failed paths in %s (%d/%d)", len(failures), backoff, i, r.Retries)
+		select {
+		case <-ctx.Done():
+			r.collector.putFailures(failures)
+			return
+		case <-time.After(backoff):
+		}
+
+		for j, f := range failures {
+			if ctx.Err() != nil {
+				r.collector.putFailures(failures[j:])
+				return
+			}
+
+			roler := GetRoler(f.path)
+			if roler == nil {
+				r.collector.retry(f.path, f.roles, fmt.Errorf("roler not found"))
+				continue
+			}
+
+			_, err := r.updateRoles(roler, f.path, f.roles, remove)
+			if err != nil {
+				log.Errorf("%s: %s", err, f.path.Path)
+			} else {
+				log.Infof("%s", f.path.Path)
+			}
+			r.collector.retry(f.path, f.roles, err)
+		}
+
+		backoff *= 2
+	}
+}
+
+// closeFailures retries the failed paths of the run (see `retryFailures`), and writes the
+// remaining failures into the failure report.  It returns the error of the `ctx` if the
+// run is cancelled.
+func (r Runner) closeFailures(ctx context.Context, remove bool) error {
+	r.retryFailures(ctx, remove)
+	if err := r.writeFailureReport(r.collector.get(), remove); err != nil {
+		return err
+	}
+	return ctx.Err()
+}
+
+// RerunFailures sets or removes the roles on the failed paths in the `report` again.
+// The action is stopped by the system signals, in which case the exit code is the
+// signal number; otherwise the exit code is derived from the `RunResult`.
+func (r *Runner) RerunFailures(report FailureReport) (exitcode int, err error) {
+	return runWithSignals(func(ctx context.Context) (RunResult, error) {
+		return r.RerunFailuresContext(ctx, report)
+	})
+}
+
+// RerunFailuresContext sets or removes the roles on the failed paths in the `report` again,
+// with the failures retried and reported according to the Runner.  The role attributes and
+// the RootPath of the Runner are ignored, and the grant registry is not updated.  The action
+// is stopped when the `ctx` is cancelled, in which case the error of the `ctx` is returned.
+func (r *Runner) RerunFailuresContext(ctx context.Context, report FailureReport) (result RunResult, err error) {
+
+	remove := report.Action == "delete"
+
+	r.ppath = report.Root
+
+	if r.DryRun {
+		for _, f := range report.Failures {
+			log.Infof("%s %s: %s", report.Action, f.Roles, f.Path)
+		}
+		return
+	}
+
+	if fpinfo, err := ufp.GetFilePathMode(r.ppath); err == nil && fpinfo.Mode.IsDir() {
+		var flock string
+		if flock, err = r.acquireLock(); err != nil {
+			return result, err
+		}
+		defer os.Remove(flock)
+	}
+
+	r.collector = &runCollector{}
+	defer func() { result = r.collector.get() }()
+	defer r.startThrottle()()
+
+	for _, f := range report.Failures {
+		if ctx.Err() != nil {
+			r.skip()
+			continue
+		}
+
+		fpinfo, err := ufp.GetFilePathMode(f.Path)
+		if err != nil {
+			r.visit(ufp.FilePathMode{Path: f.Path}, f.Roles, fmt.Errorf("path not found or unaccessible"))
+			continue
+		}
+
+		roler := GetRoler(*fpinfo)
+		if roler == nil {
+			log.Warnf("roler not found: %s", f.Path)
+			r.skip()
+			continue
+		}
+
+		_, err = r.updateRoles(roler, *fpinfo, f.Roles, remove)
+		r.visit(*fpinfo, f.Roles, err)
+		if err != nil {
+			log.Errorf("%s: %s", err, f.Path)
+			continue
+		}
+		log.Infof("%s", f.Path)
+	}
+
+	err = r.closeFailures(ctx, remove)
+	return
+}
@@ -0,0 +1,56 @@
+package acl
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	ufp "github.com/Donders-Institute/tg-toolset-golang/pkg/filepath"
+)
+
+func TestFailureReport(t *testing.T) {
+	dir, err := ioutil.TempDir("", "failure")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	fpath := filepath.Join(dir, "report.json")
+
+	c := &runCollector{}
+	c.visit(ufp.FilePathMode{Path: filepath.Join(dir, "a")}, RoleMap{Contributor: {"nobody"}}, fmt.Errorf("permission denied"))
+
+	r := Runner{FailureReport: fpath, ppath: dir, collector: c}
+
+	// the failed path is retried without success.
+	r.Retries = 2
+	if err := r.closeFailures(context.Background(), false); err != nil {
+		t.Fatal(err)
+	}
+	if res := c.get(); res.Failed != 1 || res.Retried != 2 {
+		t.Errorf("unexpected result: %s", res)
+	}
+
+	report, err := LoadFailureReport(fpath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Action != "set" || report.Root != dir || len(report.Failures) != 1 {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+	if f := report.Failures[0]; f.Path != filepath.Join(dir, "a") || len(f.Roles[Contributor]) != 1 || f.Error == "" {
+		t.Errorf("unexpected failure: %+v", f)
+	}
+
+	// the report is removed if there is no failure.
+	c.takeFailures()
+	if err := r.closeFailures(context.Background(), false); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(fpath); !os.IsNotExist(err) {
+		t.Errorf("expect report removed: %s", fpath)
+	}
+}
@@ -78,10 +78,10 @@ func (FreeNasRoler) GetRoles(pinfo ufp.FilePathMode) (RoleMap, error) {
 		r := ace.ToRole()
 		// exclude the same user appearing twice: one for file and one for directory
 		uname := getPrincipleName(ace)
-		if strings.Index(strings.Join(roles[r], ","), uname) >= 0 {
+		if hasPrincipal(roles[r], uname) {
 			continue
 		}
-		roles[r] = append(roles[r], getPrincipleName(ace))
+		roles[r] = append(roles[r], uname)
 	}
 	return roles, nil
 }
@@ -143,6 +143,16 @@ func (FreeNasRoler) DelRoles(pinfo ufp.FilePathMode, roles RoleMap,
 	return rolesNew, nil
 }
 
+// hasPrincipal checks if the `principal` is in the list of `principals`.
+func hasPrincipal(principals []string, principal string) bool {
+	for _, p := range principals {
+		if p == principal {
+			return true
+		}
+	}
+	return false
+}
+
 // isDenyAceForDeletion checks if the given ACE is the DENY ace specific for the
 // role that allows file writing and (sub-)directory creation; but not deletion.
 func isDenyAceForDeletion(ace ACE) bool {
@@ -150,12 +160,9 @@ func isDenyAceForDeletion(ace ACE) bool {
 }
 
 // newAcesFromRole constructs two ACEs from the given role for directory and file.
-func newAcesFromRole(role Role, userOrGroupName string, p ufp.FilePathMode) []ACE {
-	group := false
-	if strings.Index(userOrGroupName, "g:") == 0 {
-		group = true
-		userOrGroupName = strings.TrimLeft(userOrGroupName, "g:")
-	}
+// The `principal` refers to the system user or group (see `ParsePrincipal`).
+func newAcesFromRole(role Role, principal string, p ufp.FilePathMode) []ACE {
+	userOrGroupName, group := ParsePrincipal(principal)
 
 	flagD := strings.Replace(aceFlag[group], "f", "", 1)
 	flagF := strings.Replace(aceFlag[group], "d", "", 1)
@@ -0,0 +1,232 @@
+package acl
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	ufp "github.com/Donders-Institute/tg-toolset-golang/pkg/filepath"
+	log "github.com/Donders-Institute/tg-toolset-golang/pkg/logger"
+)
+
+// traverseGC resolves the obsolete traverse roles on the directories in a filesystem tree.
+// A traverse role of a principal on a directory is obsolete if the principal has no other
+// role than the traverse role on any of the paths below the directory.
+type traverseGC struct {
+	// root is the top-level directory of the tree.
+	root string
+	// traverse are the principals in the traverse role of the directories.
+	traverse map[string][]string
+	// below are the principals having a role other than the traverse role on any of the
+	// paths below the directories.
+	below map[string]map[string]bool
+	// unresolved are the directories above the paths of which the roles are unknown.  The
+	// traverse roles on them are kept.
+	unresolved map[string]bool
+}
+
+// newTraverseGC creates a traverseGC for the tree under the `root`.
+func newTraverseGC(root string) *traverseGC {
+	return &traverseGC{
+		root:       filepath.Clean(root),
+		traverse:   make(map[string][]string),
+		below:      make(map[string]map[string]bool),
+		unresolved: make(map[string]bool),
+	}
+}
+
+// add adds the `roles` on the `path` in the tree.  The `isDir` flag indicates whether the
+// path is a directory; the traverse role is only considered on directories.
+func (g *traverseGC) add(path string, roles RoleMap, isDir bool) {
+
+	path = filepath.Clean(path)
+
+	if isDir && len(roles[Traverse]) > 0 {
+		g.traverse[path] = append(g.traverse[path], roles[Traverse]...)
+	}
+
+	for r, users := range roles {
+		if r == Traverse || r == System {
+			continue
+		}
+		for _, u := range users {
+			g.addBelow(path, u)
+		}
+	}
+}
+
+// addBelow adds the principal `u` to the principals having a role below the parent
+// directories of the `path` up to the root.
+func (g *traverseGC) addBelow(path, u string) {
+	for path != g.root {
+		dir := filepath.Dir(path)
+		if dir == path {
+			return
+		}
+		path = dir
+
+		below, ok := g.below[path]
+		if !ok {
+			below = make(map[string]bool)
+			g.below[path] = below
+		}
+		// the principal is already added to this directory and therefore to all its parents.
+		if below[u] {
+			return
+		}
+		below[u] = true
+	}
+}
+
+// fail marks the parent directories of the `path` up to the root as unresolved, as the
+// roles on the `path` cannot be retrieved.
+func (g *traverseGC) fail(path string) {
+	for path = filepath.Clean(path); path != g.root; {
+		dir := filepath.Dir(path)
+		if dir == path {
+			return
+		}
+		path = dir
+		g.unresolved[path] = true
+	}
+}
+
+// obsolete returns the obsolete traverse roles on the directories, ordered by path.
+func (g *traverseGC) obsolete() []RolePathMap {
+
+	var obsolete []RolePathMap
+	for path, users := range g.traverse {
+		if g.unresolved[path] {
+			log.Warnf("traverse roles kept as roles below are unknown: %s", path)
+			continue
+		}
+		var rm []string
+		for _, u := range users {
+			if !g.below[path][u] {
+				rm = append(rm, u)
+			}
+		}
+		if len(rm) > 0 {
+			sort.Strings(rm)
+			obsolete = append(obsolete, RolePathMap{Path: path, RoleMap: RoleMap{Traverse: rm}})
+		}
+	}
+
+	sort.Slice(obsolete, func(i, j int) bool { return obsolete[i].Path < obsolete[j].Path })
+
+	return obsolete
+}
+
+// GCTraverse removes the obsolete traverse roles in the `Runner.RootPath`, i.e. the traverse
+// roles of the principals that no longer have any other role on the paths below the
+// directories.  It walks through the whole filesystem tree, regardless of the walk filters
+// of the Runner, to collect the roles; the traverse roles above the paths of which the roles
+// cannot be retrieved are kept.  In dry-run mode, the obsolete traverse roles are
+// only reported.  The action is stopped when the `ctx` is cancelled, in which case the
+// error of the `ctx` is returned and no traverse role is removed.
+func (r *Runner) GCTraverse(ctx context.Context) (result RunResult, err error) {
+
+	// resolve any symlinks on ppath
+	r.ppath, _ = filepath.EvalSymlinks(r.RootPath)
+
+	fpinfo, err := ufp.GetFilePathMode(r.ppath)
+	if err != nil {
+		err = fmt.Errorf("path not found or unaccessible: %s", r.RootPath)
+		return
+	}
+	if !fpinfo.Mode.IsDir() {
+		err = fmt.Errorf("not a directory: %s", r.RootPath)
+		return
+	}
+
+	if !r.DryRun {
+		var flock string
+		if flock, err = r.acquireLock(); err != nil {
+			return
+		}
+		defer os.Remove(flock)
+	}
+
+	r.collector = &runCollector{}
+	defer func() { result = r.collector.get() }()
+	defer r.startThrottle()()
+
+	// collect the roles on all paths in the tree; the walk filters would leave out the
+	// roles for which the traverse roles are still needed.
+	gc := newTraverseGC(r.ppath)
+	var mutex sync.Mutex
+
+	nthreads := r.Nthreads
+	if nthreads < 1 {
+		nthreads = 1
+	}
+	chanF := ufp.GoFastWalkWithOptions(r.ppath, withContext(ctx, ufp.WalkOptions{Limiter: r.Limiter}), nthreads*4)
+
+	var wg sync.WaitGroup
+	wg.Add(nthreads)
+	for i := 0; i < nthreads; i++ {
+		go func() {
+			defer wg.Done()
+			for f := range chanF {
+				if ctx.Err() != nil {
+					continue
+				}
+				roler := GetRoler(f)
+				if roler == nil {
+					log.Warnf("roler not found: %s", f.Path)
+					mutex.Lock()
+					gc.fail(f.Path)
+					mutex.Unlock()
+					continue
+				}
+				release := r.Limiter.Acquire()
+				roles, err := roler.GetRoles(f)
+				release()
+				mutex.Lock()
+				if err != nil {
+					log.Errorf("%s: %s", err, f.Path)
+					gc.fail(f.Path)
+				} else {
+					gc.add(f.Path, roles, f.Mode.IsDir())
+				}
+				mutex.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	// the roles are incomplete after the cancellation.
+	if err = ctx.Err(); err != nil {
+		return
+	}
+
+	for _, o := range gc.obsolete() {
+
+		if r.DryRun {
+			log.Infof("remove %s: %s", o.RoleMap, o.Path)
+			r.skip()
+			continue
+		}
+
+		fpm := ufp.FilePathMode{Path: o.Path, Mode: os.ModeDir}
+		roler := GetRoler(fpm)
+		if roler == nil {
+			log.Warnf("roler not found: %s", o.Path)
+			r.skip()
+			continue
+		}
+
+		_, err := r.updateRoles(roler, fpm, o.RoleMap, true)
+		r.visit(fpm, o.RoleMap, err)
+		if err != nil {
+			log.Errorf("%s: %s", err, o.Path)
+			continue
+		}
+		log.Infof("removed %s: %s", o.RoleMap, o.Path)
+	}
+
+	return
+}
@@ -0,0 +1,33 @@
+package acl
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTraverseGC(t *testing.T) {
+	gc := newTraverseGC("/project/3010000.01")
+
+	gc.add("/project/3010000.01", RoleMap{Manager: {"honlee"}, Traverse: {"edwger", "rendbru", "g:tg"}}, true)
+	gc.add("/project/3010000.01/raw", RoleMap{Traverse: {"edwger", "rendbru"}}, true)
+	gc.add("/project/3010000.01/raw/sub", RoleMap{Traverse: {"rendbru"}, System: {"root"}}, true)
+	gc.add("/project/3010000.01/raw/sub/a.nii", RoleMap{Viewer: {"edwger"}, Traverse: {"rendbru"}}, false)
+	gc.add("/project/3010000.01/derived", RoleMap{Contributor: {"g:tg"}}, true)
+
+	// rendbru has only the traverse role below the directories, the traverse role on the
+	// file is left out.
+	expected := []RolePathMap{
+		{Path: "/project/3010000.01", RoleMap: RoleMap{Traverse: {"rendbru"}}},
+		{Path: "/project/3010000.01/raw", RoleMap: RoleMap{Traverse: {"rendbru"}}},
+		{Path: "/project/3010000.01/raw/sub", RoleMap: RoleMap{Traverse: {"rendbru"}}},
+	}
+	if obsolete := gc.obsolete(); !reflect.DeepEqual(obsolete, expected) {
+		t.Errorf("expect %v but got %v", expected, obsolete)
+	}
+
+	// the traverse roles above a path with unknown roles are kept.
+	gc.fail("/project/3010000.01/raw/sub/b.nii")
+	if obsolete := gc.obsolete(); len(obsolete) != 0 {
+		t.Errorf("expect no obsolete traverse role but got %v", obsolete)
+	}
+}
@@ -0,0 +1,172 @@
+package acl
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// GrantRegistryPath is the default path of the local registry of the time-limited roles.
+const GrantRegistryPath string = "/var/lib/tg-toolset/grants.db"
+
+// grantBucket is the bucket of the grant registry containing the grants.
+const grantBucket string = "grants"
+
+// Grant is a role granted to a user or group on a path until an expiry time.
+type Grant struct {
+	// Path is the path on which the role is granted.
+	Path string `json:"path"`
+	// Principal is the user or group (prefixed with `g:`) to which the role is granted.
+	Principal string `json:"principal"`
+	// Role is the granted role.
+	Role Role `json:"role"`
+	// Granted is the time at which the role is granted.
+	Granted time.Time `json:"granted"`
+	// Expiry is the time at which the role expires.
+	Expiry time.Time `json:"expiry"`
+}
+
+// IsExpired checks whether the grant is expired at time `t`.
+func (g Grant) IsExpired(t time.Time) bool {
+	return !g.Expiry.After(t)
+}
+
+// grantKey returns the key of the grant of `principal` on `path` in the grant registry.
+// A principal has at most one role on a path.
+func grantKey(path, principal string) []byte {
+	return []byte(filepath.Clean(path) + "\x00" + principal)
+}
+
+// GrantRegistry is a local registry of the time-limited roles, backed by a bolt database.
+// The roles in the registry are removed by a sweep once they are expired.
+type GrantRegistry struct {
+	store *kvStore
+}
+
+// OpenGrantRegistry opens the grant registry at `path`.  The registry is created if it
+// doesn't exist.
+func OpenGrantRegistry(path string) (*GrantRegistry, error) {
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("cannot create grant registry %s: %s", path, err)
+	}
+
+	s, err := openKVStore(path, grantBucket)
+	if err != nil {
+		return nil, err
+	}
+
+	return &GrantRegistry{store: s}, nil
+}
+
+// Close closes the grant registry.
+func (g *GrantRegistry) Close() error {
+	return g.store.close()
+}
+
+// Add adds the `grants` into the registry, replacing the existing grants of the same
+// principals on the same paths.
+func (g *GrantRegistry) Add(grants ...Grant) error {
+	for _, gr := range grants {
+		gr.Path = filepath.Clean(gr.Path)
+		v, err := json.Marshal(gr)
+		if err != nil {
+			return err
+		}
+		if err := g.store.set(grantBucket, grantKey(gr.Path, gr.Principal), v); err != nil {
+			return fmt.Errorf("cannot register grant of %s on %s: %s", gr.Principal, gr.Path, err)
+		}
+	}
+	return nil
+}
+
+// Remove removes the grants of the `principals` on `path` from the registry.
+func (g *GrantRegistry) Remove(path string, principals ...string) error {
+	for _, p := range principals {
+		if err := g.store.delete(grantBucket, grantKey(path, p)); err != nil {
+			return fmt.Errorf("cannot unregister grant of %s on %s: %s", p, path, err)
+		}
+	}
+	return nil
+}
+
+// Grants returns all grants in the registry, ordered by the expiry time.
+func (g *GrantRegistry) Grants() ([]Grant, error) {
+
+	var grants []Grant
+	if err := g.store.forEach(grantBucket, func(k, v []byte) error {
+		var gr Grant
+		if err := json.Unmarshal(v, &gr); err != nil {
+			return fmt.Errorf("invalid grant %q: %s", k, err)
+		}
+		grants = append(grants, gr)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(grants, func(i, j int) bool { return grants[i].Expiry.Before(grants[j].Expiry) })
+
+	return grants, nil
+}
+
+// Expired returns the grants in the registry expired at time `t`.
+func (g *GrantRegistry) Expired(t time.Time) ([]Grant, error) {
+
+	grants, err := g.Grants()
+	if err != nil {
+		return nil, err
+	}
+
+	expired := make([]Grant, 0)
+	for _, gr := range grants {
+		if gr.IsExpired(t) {
+			expired = append(expired, gr)
+		}
+	}
+	return expired, nil
+}
+
+// updateGrants updates the grant registry after the `roles` are set on, or removed from
+// (i.e. `remove` is true), the path of the Runner.  The roles set with an Expiry are added
+// to the registry; the grants of other users in the `roles` are removed from the registry
+// as the roles are either permanent or removed.  The traverse role is not registered.
+func (r Runner) updateGrants(roles RoleMap, remove bool) error {
+
+	if r.GrantRegistry == "" {
+		return nil
+	}
+
+	// there is no grant to be removed from a registry that doesn't exist.
+	if _, err := os.Stat(r.GrantRegistry); os.IsNotExist(err) && (remove || r.Expiry.IsZero()) {
+		return nil
+	}
+
+	reg, err := OpenGrantRegistry(r.GrantRegistry)
+	if err != nil {
+		return err
+	}
+	defer reg.Close()
+
+	now := time.Now()
+	for role, users := range roles {
+		if role == Traverse {
+			continue
+		}
+		if remove || r.Expiry.IsZero() {
+			if err := reg.Remove(r.ppath, users...); err != nil {
+				return err
+			}
+			continue
+		}
+		for _, u := range users {
+			if err := reg.Add(Grant{Path: r.ppath, Principal: u, Role: role, Granted: now, Expiry: r.Expiry}); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
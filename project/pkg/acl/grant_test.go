@@ -0,0 +1,61 @@
+package acl
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestGrantRegistry(t *testing.T) {
+	dir, err := ioutil.TempDir("", "grants")
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	reg, err := OpenGrantRegistry(filepath.Join(dir, "grants.db"))
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	defer reg.Close()
+
+	now := time.Now()
+	grants := []Grant{
+		{Path: "/project/3010000.01", Principal: "honlee", Role: Viewer, Expiry: now.Add(time.Hour)},
+		{Path: "/project/3010000.01/raw/", Principal: "g:tg", Role: Writer, Expiry: now.Add(-time.Hour)},
+		{Path: "/project/3010000.02", Principal: "honlee", Role: Contributor, Expiry: now.Add(-2 * time.Hour)},
+	}
+	if err := reg.Add(grants...); err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	all, err := reg.Grants()
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if len(all) != 3 || all[0].Path != "/project/3010000.02" || all[2].Principal != "honlee" {
+		t.Errorf("unexpected grants: %+v", all)
+	}
+
+	// the grant of a principal on the same path is replaced.
+	if err := reg.Add(Grant{Path: "/project/3010000.01/raw", Principal: "g:tg", Role: Viewer, Expiry: now.Add(-time.Minute)}); err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	expired, err := reg.Expired(now)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if len(expired) != 2 || expired[1].Role != Viewer || expired[1].Path != "/project/3010000.01/raw" {
+		t.Errorf("unexpected expired grants: %+v", expired)
+	}
+
+	if err := reg.Remove("/project/3010000.01/raw", "g:tg"); err != nil {
+		t.Fatalf("%s", err)
+	}
+	if expired, _ := reg.Expired(now); len(expired) != 1 || expired[0].Path != "/project/3010000.02" {
+		t.Errorf("unexpected expired grants after removal: %+v", expired)
+	}
+}
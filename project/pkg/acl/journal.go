@@ -0,0 +1,221 @@
+package acl
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	ufp "github.com/Donders-Institute/tg-toolset-golang/pkg/filepath"
+	log "github.com/Donders-Institute/tg-toolset-golang/pkg/logger"
+)
+
+// buckets of the journal store.
+const (
+	// journalBucketMeta contains the specification of the action recorded by the journal.
+	journalBucketMeta string = "meta"
+	// journalBucketDone contains the directories of which the whole subtree is completed.
+	journalBucketDone string = "done"
+)
+
+// journalKeySpec is the key in the `meta` bucket referring to the action specification.
+var journalKeySpec = []byte("spec")
+
+// journal records the progress of a set/delete action on a directory tree, so that an
+// interrupted action can be resumed without re-applying roles on completed subtrees.
+//
+// A directory is completed when the roles are applied successfully on the directory
+// itself, on all the files in it, and on all of its sub-directories recursively.  The
+// progress is tracked with a counter per directory, using the `Visit` and `Leave` hooks
+// of the filesystem walk:
+//
+//   - the counter of a directory starts with 2 for the directory itself and for its
+//     on-going listing,
+//   - a file or sub-directory found in the directory increases the counter by 1,
+//   - the counter decreases by 1 when the directory listing is finished, or when
+//     the roles are applied on the directory itself, on a file in it, or when a
+//     sub-directory is completed.
+//
+// The directory is completed when its counter reaches 0.  Paths failed to be updated
+// never decrease the counter; their parent directories are therefore never recorded as
+// completed and will be visited again when resuming.
+type journal struct {
+	store   *kvStore
+	mutex   sync.Mutex
+	pending map[string]int
+	parent  map[string]string
+	closed  bool
+}
+
+// journalPath returns the path of the journal file of the set/delete action on `ppath`.
+func journalPath(ppath string) string {
+	return filepath.Join(ppath, ".prj_setacl.journal")
+}
+
+// journalSpec returns the specification of the `action` with `roles` recorded in the
+// journal.  The principals are sorted, so that the same action given with the principals
+// in a different order resumes the journal.
+func journalSpec(action string, roles RoleMap) string {
+	return fmt.Sprintf("%s %v", action, sortedRoles(roles))
+}
+
+// openJournal opens the journal at `path` for the action specified by `spec`.
+//
+// If `resume` is false, any existing journal is discarded.  Otherwise the completed
+// directories of the existing journal are kept, and an error is returned if the existing
+// journal is recorded for a different action.
+func openJournal(path, spec string, resume bool) (*journal, error) {
+
+	if !resume {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+
+	s, err := openKVStore(path, journalBucketMeta, journalBucketDone)
+	if err != nil {
+		return nil, err
+	}
+
+	if v := s.get(journalBucketMeta, journalKeySpec); v != nil {
+		if string(v) != spec {
+			s.close()
+			return nil, fmt.Errorf("journal %s is recorded for a different action: %s", path, v)
+		}
+	} else if err := s.set(journalBucketMeta, journalKeySpec, []byte(spec)); err != nil {
+		s.close()
+		return nil, err
+	}
+
+	return &journal{
+		store:   s,
+		pending: make(map[string]int),
+		parent:  make(map[string]string),
+	}, nil
+}
+
+// close closes the journal.  When `remove` is true, the journal file is removed.
+func (j *journal) close(remove bool) error {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	if j.closed {
+		return nil
+	}
+	j.closed = true
+
+	if err := j.store.close(); err != nil {
+		return err
+	}
+	if remove {
+		return os.Remove(j.store.path)
+	}
+	return nil
+}
+
+// isDone checks whether the subtree of the directory `dir` is completed.
+func (j *journal) isDone(dir string) bool {
+	return j.store.get(journalBucketDone, []byte(filepath.Clean(dir))) != nil
+}
+
+// walkOptions returns the WalkOptions for tracking the progress of the walk. When
+// `resume` is true, the completed directories are skipped.
+func (j *journal) walkOptions(followLink, skipFiles, resume bool) ufp.WalkOptions {
+	opts := ufp.WalkOptions{
+		FollowLink: followLink,
+		SkipFiles:  skipFiles,
+		Visit:      j.visit,
+		Leave:      j.leave,
+	}
+	if resume {
+		opts.SkipDir = j.isDone
+	}
+	return opts
+}
+
+// visit registers the path `p` found in directory `dir` as pending.
+func (j *journal) visit(p ufp.FilePathMode, dir string) {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	k := filepath.Clean(p.Path)
+	j.parent[k] = dir
+	if p.Mode.IsDir() {
+		j.pending[k] += 2
+	}
+	if dir != "" {
+		j.pending[dir]++
+	}
+}
+
+// hold keeps the directory `dir` from being recorded as completed until `unhold` is called,
+// e.g. to wait for the traverse roles being applied after the walk.
+func (j *journal) hold(dir string) {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	j.pending[filepath.Clean(dir)]++
+}
+
+// unhold releases the hold on the directory `dir` set by `hold`.
+func (j *journal) unhold(dir string) {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	j.release(filepath.Clean(dir))
+}
+
+// leave registers the completion of listing the directory `dir`.
+func (j *journal) leave(dir string) {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	j.release(dir)
+}
+
+// done registers the path `p` on which the roles are applied successfully.
+func (j *journal) done(p ufp.FilePathMode) {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	k := filepath.Clean(p.Path)
+	if p.Mode.IsDir() {
+		j.release(k)
+		return
+	}
+
+	dir, ok := j.parent[k]
+	if !ok {
+		return
+	}
+	delete(j.parent, k)
+	if dir != "" {
+		j.release(dir)
+	}
+}
+
+// release decreases the pending counter of directory `dir`.  When the counter reaches 0,
+// the directory is recorded as completed, and the counter of its parent is released.
+// It should be called with the mutex locked.
+func (j *journal) release(dir string) {
+	n, ok := j.pending[dir]
+	if !ok {
+		return
+	}
+	if n > 1 {
+		j.pending[dir] = n - 1
+		return
+	}
+
+	delete(j.pending, dir)
+	if !j.closed {
+		if err := j.store.set(journalBucketDone, []byte(dir), []byte(time.Now().Format(time.RFC3339))); err != nil {
+			log.Errorf("cannot record completed directory in journal: %s: %s", err, dir)
+		}
+	}
+	log.Debugf("completed directory: %s", dir)
+
+	parent := j.parent[dir]
+	delete(j.parent, dir)
+	if parent != "" {
+		j.release(parent)
+	}
+}
@@ -0,0 +1,146 @@
+package acl
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	ufp "github.com/Donders-Institute/tg-toolset-golang/pkg/filepath"
+	log "github.com/Donders-Institute/tg-toolset-golang/pkg/logger"
+)
+
+func init() {
+	logCfg := log.Configuration{
+		EnableConsole:     true,
+		ConsoleJSONFormat: false,
+		ConsoleLevel:      log.Info,
+	}
+
+	// initialize logger
+	log.NewLogger(logCfg, log.InstanceLogrusLogger)
+}
+
+// makeJournalTestTree creates a directory tree with sub-directories `a`, `a/c` and `b`,
+// each containing a file `f`.
+func makeJournalTestTree(t *testing.T) string {
+	root, err := ioutil.TempDir("", "journal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, d := range []string{"a/c", "b"} {
+		if err := os.MkdirAll(filepath.Join(root, d), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, d := range []string{"a", "a/c", "b"} {
+		if err := ioutil.WriteFile(filepath.Join(root, d, "f"), []byte{}, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+// walkJournal walks through the `root` with progress tracked by journal `j`, and marks
+// the walked paths as done, except the paths with suffix `fail`.  It returns the walked paths.
+func walkJournal(j *journal, root, fail string, resume bool) []string {
+	var paths []string
+	for p := range ufp.GoFastWalkWithOptions(root, j.walkOptions(false, false, resume), 4) {
+		paths = append(paths, filepath.Clean(p.Path))
+		if fail != "" && strings.HasSuffix(p.Path, fail) {
+			continue
+		}
+		j.done(p)
+	}
+	return paths
+}
+
+func TestJournalResume(t *testing.T) {
+	root := makeJournalTestTree(t)
+	defer os.RemoveAll(root)
+
+	jpath := filepath.Join(root, "..", filepath.Base(root)+".journal")
+	defer os.Remove(jpath)
+
+	// first run with failure on file `a/c/f`
+	j, err := openJournal(jpath, "set test", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(walkJournal(j, root, "a/c/f", false)); n != 7 {
+		t.Errorf("expect 7 paths walked, got %d", n)
+	}
+	for d, done := range map[string]bool{
+		root:                       false,
+		filepath.Join(root, "a"):   false,
+		filepath.Join(root, "a/c"): false,
+		filepath.Join(root, "b"):   true,
+	} {
+		if j.isDone(d) != done {
+			t.Errorf("expect %s done: %t", d, done)
+		}
+	}
+	j.close(false)
+
+	// journal of a different action cannot be resumed
+	if _, err := openJournal(jpath, "delete test", true); err == nil {
+		t.Errorf("expect error on resuming journal of a different action")
+	}
+
+	// resume skips completed directory `b`
+	j, err = openJournal(jpath, "set test", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range walkJournal(j, root, "", true) {
+		if strings.HasPrefix(p, filepath.Join(root, "b")) {
+			t.Errorf("unexpected walk into completed directory: %s", p)
+		}
+	}
+	if !j.isDone(root) {
+		t.Errorf("expect %s done", root)
+	}
+	j.close(true)
+
+	if _, err := os.Stat(jpath); !os.IsNotExist(err) {
+		t.Errorf("expect journal removed: %s", jpath)
+	}
+}
+
+func TestJournalHold(t *testing.T) {
+	root := makeJournalTestTree(t)
+	defer os.RemoveAll(root)
+
+	jpath := filepath.Join(root, "..", filepath.Base(root)+".journal")
+	defer os.Remove(jpath)
+
+	j, err := openJournal(jpath, "set test", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.close(true)
+
+	// the held root is not completed after the walk, while its sub-directories are.
+	j.hold(root)
+	walkJournal(j, root, "", false)
+	if j.isDone(root) {
+		t.Errorf("expect %s not done before unhold", root)
+	}
+	if !j.isDone(filepath.Join(root, "a")) {
+		t.Errorf("expect %s done", filepath.Join(root, "a"))
+	}
+
+	j.unhold(root)
+	if !j.isDone(root) {
+		t.Errorf("expect %s done after unhold", root)
+	}
+}
+
+func TestJournalSpec(t *testing.T) {
+	s1 := journalSpec("set", RoleMap{Writer: {"u1", "u2"}, Manager: {"u3"}})
+	s2 := journalSpec("set", RoleMap{Manager: {"u3"}, Writer: {"u2", "u1"}})
+	if s1 != s2 {
+		t.Errorf("expect same spec regardless of principal order: %s != %s", s1, s2)
+	}
+}
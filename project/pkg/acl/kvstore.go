@@ -0,0 +1,79 @@
+package acl
+
+import (
+	"fmt"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// kvStore is a local key-value store in a bolt database, used by the Runner for its
+// bookkeeping (e.g. the journal).  The `store.KVStore` is not used, as the store package
+// depends on this package through its tests.
+type kvStore struct {
+	path string
+	db   *bolt.DB
+}
+
+// openKVStore opens the bolt database at `path`, and creates the `buckets` in it if they
+// don't exist.  The database is created if it doesn't exist.
+func openKVStore(path string, buckets ...string) (*kvStore, error) {
+
+	db, err := bolt.Open(path, 0600, nil)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open %s: %s", path, err)
+	}
+
+	if err := db.Update(func(tx *bolt.Tx) error {
+		for _, b := range buckets {
+			if _, err := tx.CreateBucketIfNotExists([]byte(b)); err != nil {
+				return fmt.Errorf("create bucket: %s", err)
+			}
+		}
+		return nil
+	}); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &kvStore{path: path, db: db}, nil
+}
+
+// close closes the bolt database.
+func (s *kvStore) close() error {
+	return s.db.Close()
+}
+
+// get returns the value of the `key` in the `bucket`, or nil if the key doesn't exist.
+func (s *kvStore) get(bucket string, key []byte) []byte {
+	var v []byte
+	s.db.View(func(tx *bolt.Tx) error {
+		// the value is only valid within the transaction.
+		if d := tx.Bucket([]byte(bucket)).Get(key); d != nil {
+			v = append([]byte{}, d...)
+		}
+		return nil
+	})
+	return v
+}
+
+// set sets the `value` of the `key` in the `bucket`.
+func (s *kvStore) set(bucket string, key, value []byte) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(bucket)).Put(key, value)
+	})
+}
+
+// delete removes the `key` from the `bucket`.  It is not an error if the key doesn't exist.
+func (s *kvStore) delete(bucket string, key []byte) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(bucket)).Delete(key)
+	})
+}
+
+// forEach calls the function `f` on every key-value pair in the `bucket`.  The key and
+// value are only valid until `f` returns.
+func (s *kvStore) forEach(bucket string, f func(k, v []byte) error) error {
+	return s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(bucket)).ForEach(f)
+	})
+}
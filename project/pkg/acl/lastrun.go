@@ -0,0 +1,119 @@
+package acl
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	log "github.com/Donders-Institute/tg-toolset-golang/pkg/logger"
+)
+
+// LastRunStorePath is the default path of the local store of the last-run timestamps of
+// the incremental set/delete actions.
+const LastRunStorePath string = "/var/lib/tg-toolset/lastrun.db"
+
+// lastRunBucket is the bucket of the last-run store containing the timestamps.
+const lastRunBucket string = "lastrun"
+
+// lastRunMargin is subtracted from the last-run timestamp when walking through the files
+// changed since the last run, to allow for the clock skew between the host and the filer.
+const lastRunMargin = 5 * time.Minute
+
+// lastRunKey returns the key of the last-run timestamp of the `action` (i.e. `set` or
+// `delete`) of the `roles` on the `Runner.ppath`.  The timestamp is kept per action and per
+// walk options, as the files unchanged since the last run only have the roles in place if
+// they were walked through by the same action.  The key doesn't depend on the order of the
+// principals and of the patterns.
+func (r Runner) lastRunKey(action string, roles RoleMap) []byte {
+
+	spec := fmt.Sprintf("%s %v include=%q exclude=%q maxdepth=%d xdev=%t skipsnapshots=%t skipfiles=%t followlink=%t",
+		action, sortedRoles(roles), sortedStrings(r.Include), sortedStrings(r.Exclude), r.MaxDepth, r.SameFilesystem, r.SkipSnapshots, r.SkipFiles, r.FollowLink)
+
+	return []byte(filepath.Clean(r.ppath) + "\x00" + spec)
+}
+
+// sortedStrings returns a sorted copy of `s`.
+func sortedStrings(s []string) []string {
+	s = append([]string(nil), s...)
+	sort.Strings(s)
+	return s
+}
+
+// sortedRoles returns a copy of `roles` with the principals of each role sorted, so that
+// it is printed regardless of the order in which the principals are given.  Note that fmt
+// prints the map with the keys sorted.
+func sortedRoles(roles RoleMap) RoleMap {
+	rs := make(RoleMap, len(roles))
+	for role, users := range roles {
+		rs[role] = sortedStrings(users)
+	}
+	return rs
+}
+
+// openLastRunStore opens the last-run store at `path`.  The store is created if it doesn't
+// exist.
+func openLastRunStore(path string) (*kvStore, error) {
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("cannot create last-run store %s: %s", path, err)
+	}
+
+	return openKVStore(path, lastRunBucket)
+}
+
+// lastRunStore returns the path of the last-run store of the Runner.
+func (r Runner) lastRunStore() string {
+	if r.LastRunStore == "" {
+		return LastRunStorePath
+	}
+	return r.LastRunStore
+}
+
+// startIncremental starts the incremental `action` (i.e. `set` or `delete`) of the `roles` on
+// the `Runner.ppath`.  The files unchanged since the last run of the same action are left out
+// from the walk; all files are walked if there is no last run.  It returns a function to record
+// the start of the current action as the last run once it is completed without failure.
+func (r *Runner) startIncremental(action string, roles RoleMap) (commit func() error, err error) {
+
+	started := time.Now()
+
+	s, err := openLastRunStore(r.lastRunStore())
+	if err != nil {
+		return nil, err
+	}
+	defer s.close()
+
+	key := r.lastRunKey(action, roles)
+	if v := s.get(lastRunBucket, key); v != nil {
+		var last time.Time
+		if err := last.UnmarshalText(v); err != nil {
+			return nil, fmt.Errorf("invalid last run of %s: %s", r.ppath, err)
+		}
+		r.changedSince = last.Add(-lastRunMargin)
+		log.Infof("incremental run on paths changed since %s", r.changedSince.Format(time.RFC3339))
+	} else {
+		log.Infof("no last run found, walking through all paths")
+	}
+
+	commit = func() error {
+		v, err := started.MarshalText()
+		if err != nil {
+			return err
+		}
+
+		s, err := openLastRunStore(r.lastRunStore())
+		if err != nil {
+			return err
+		}
+		defer s.close()
+
+		if err := s.set(lastRunBucket, key, v); err != nil {
+			return fmt.Errorf("cannot record last run of %s: %s", r.ppath, err)
+		}
+		return nil
+	}
+
+	return commit, nil
+}
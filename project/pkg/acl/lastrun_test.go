@@ -0,0 +1,77 @@
+package acl
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestStartIncremental(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lastrun")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	r := Runner{LastRunStore: filepath.Join(dir, "lastrun.db"), ppath: dir}
+	roles := RoleMap{Viewer: {"nobody", "root"}}
+
+	// all files are walked without a last run.
+	commit, err := r.startIncremental("set", roles)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !r.changedSince.IsZero() {
+		t.Errorf("unexpected changed-since time without last run: %s", r.changedSince)
+	}
+
+	started := time.Now()
+	if err := commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = r.startIncremental("set", roles); err != nil {
+		t.Fatal(err)
+	}
+	if since := started.Add(-lastRunMargin); r.changedSince.After(since) {
+		t.Errorf("expect changed-since time before %s but got %s", since, r.changedSince)
+	}
+	if r.changedSince.IsZero() {
+		t.Errorf("expect changed-since time from the last run")
+	}
+
+	// the last run is kept per action.
+	r.changedSince = time.Time{}
+	if _, err = r.startIncremental("delete", roles); err != nil {
+		t.Fatal(err)
+	}
+	if !r.changedSince.IsZero() {
+		t.Errorf("unexpected changed-since time of another action: %s", r.changedSince)
+	}
+}
+
+func TestLastRunKey(t *testing.T) {
+	r := Runner{ppath: "/project/3010000.01"}
+
+	key := r.lastRunKey("set", RoleMap{Viewer: {"nobody", "root"}, Manager: {"honlee"}})
+
+	// the key doesn't depend on the order of the principals.
+	if k := r.lastRunKey("set", RoleMap{Manager: {"honlee"}, Viewer: {"root", "nobody"}}); string(k) != string(key) {
+		t.Errorf("expect key %q but got %q", key, k)
+	}
+
+	// the key depends on the walk options.
+	for _, o := range []Runner{
+		{ppath: r.ppath, Include: []string{"*.nii"}},
+		{ppath: r.ppath, Exclude: []string{"raw"}},
+		{ppath: r.ppath, MaxDepth: 1},
+		{ppath: r.ppath, SameFilesystem: true},
+		{ppath: r.ppath, SkipFiles: true},
+	} {
+		if k := o.lastRunKey("set", RoleMap{Viewer: {"nobody", "root"}, Manager: {"honlee"}}); string(k) == string(key) {
+			t.Errorf("expect different key with walk options %+v", o)
+		}
+	}
+}
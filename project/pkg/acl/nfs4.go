@@ -2,10 +2,10 @@ package acl
 
 import (
 	"fmt"
-	"os/exec"
 	"os/user"
 	"strings"
 
+	ufp "github.com/Donders-Institute/tg-toolset-golang/pkg/filepath"
 	log "github.com/Donders-Institute/tg-toolset-golang/pkg/logger"
 	ustr "github.com/Donders-Institute/tg-toolset-golang/pkg/strings"
 	"github.com/pkg/errors"
@@ -51,6 +51,11 @@ type ACE struct {
 	Flag      string
 	Principle string
 	Mask      string
+
+	// flagBits and maskBits are the flag and mask bits read from the filesystem that have
+	// no letter in the ACE string.  They are kept for writing the ACE back unchanged.
+	flagBits uint32
+	maskBits uint32
 }
 
 // String implements the string formation of the ACE.
@@ -111,9 +116,12 @@ func (ace ACE) ToRole() Role {
 		return System
 	}
 
+	// iterate over roles in a fixed order so that the closest mask is resolved
+	// consistently, e.g. the Writer mask is not mistaken for a Contributor.
 	var role Role
 	lm := 99
-	for r, m := range aceMask {
+	for _, r := range rolesInOrder {
+		m := aceMask[r]
 		if _lm := len(ustr.StringXOR(ace.Mask, m)); _lm < lm {
 			lm = _lm
 			role = r
@@ -122,52 +130,39 @@ func (ace ACE) ToRole() Role {
 	return role
 }
 
-// getACL gets the ACL of the given path as a ACE list by calling the "nfs4_getacl" command.
-// It assumes that the "nfs4_getacl" is available in the $PATH environment.
+// getACL gets the ACL of the given path as a ACE list by reading the NFSv4 ACL
+// from the `system.nfs4_acl` extended attribute.
 func getACL(path string) ([]ACE, error) {
-	cmdNfs4Getfacl := "nfs4_getfacl"
-	out, err := exec.Command(cmdNfs4Getfacl, path).Output()
+	aces, err := getNfs4ACL(path)
 	if err != nil {
-		return nil, errors.Wrap(err, fmt.Sprintf("%s exec failure", cmdNfs4Getfacl))
-	}
-	var aces []ACE
-	for _, line := range strings.Split(string(out), "\n") {
-		if line == "" || strings.HasPrefix(line, "#") {
-			// an empty line or a line stars with "#" is ok to ignore
-			continue
-		}
-		ace, err := parseAce(line)
-		if err != nil {
-			// print a warning and continue
-			log.Warnf("%s", err)
-			continue
-		}
-		aces = append(aces, *ace)
+		return nil, errors.Wrap(err, "cannot get nfs4 acl")
 	}
 	return aces, nil
 }
 
-// setACL sets a list of ACEs to the given path by calling the "nfs4_setfacl" command.
-// It assumes that the "nfs4_setacl" is available in the $PATH environment.
+// setACL sets a list of ACEs to the given path by writing the NFSv4 ACL to the
+// `system.nfs4_acl` extended attribute.
+//
+// If `recursive` is true, the ACEs are also set on all files and sub-directories
+// under the path; and `followLink` specifies whether the symbolic links are followed
+// while walking through the sub-directories.
 func setACL(path string, aces []ACE, recursive bool, followLink bool) error {
-	cmdNfs4Setfacl := "nfs4_setfacl"
 
-	var naces []string // domain user ACEs
-	var acess []string // system default ACEs
-	var cmdArgs []string
+	var naces []ACE // domain user ACEs
+	var acess []ACE // system default ACEs
 
 	// extract valid ACEs
 	for _, ace := range aces {
 
 		// ignore System principles
 		if ace.IsSysPermission() {
-			acess = append(acess, fmt.Sprintf("%s", ace))
+			acess = append(acess, ace)
 			continue
 		}
 
 		// ignore invalid principles
 		if ace.IsValidPrinciple() {
-			naces = append(naces, fmt.Sprintf("%s", ace))
+			naces = append(naces, ace)
 		} else {
 			log.Warnf("invalid user or group: %s %s", ace.Principle, path)
 		}
@@ -176,27 +171,37 @@ func setACL(path string, aces []ACE, recursive bool, followLink bool) error {
 	// put system default ACEs at the end of the list
 	naces = append(naces, acess...)
 
-	// create the full command-line arguments for nfs4_setfacl
-	if recursive {
-		cmdArgs = append(cmdArgs, "-R")
-	}
-	if followLink {
-		cmdArgs = append(cmdArgs, "-L")
+	log.Debugf("set nfs4 acl on %s: %s", path, naces)
+
+	if !recursive {
+		return errors.Wrap(setNfs4ACL(path, naces), "cannot set nfs4 acl")
 	}
-	cmdArgs = append(cmdArgs, "-s")
-	cmdArgs = append(cmdArgs, strings.Join(naces[:], ","))
-	cmdArgs = append(cmdArgs, path)
 
-	log.Debugf("%s %s", cmdNfs4Setfacl, strings.Join(cmdArgs, " "))
+	return errors.Wrap(walkApply(path, followLink, func(p string) error {
+		return setNfs4ACL(p, naces)
+	}), "cannot set nfs4 acl")
+}
 
-	_, err := exec.Command(cmdNfs4Setfacl, cmdArgs...).Output()
-	return errors.Wrap(err, fmt.Sprintf("%s exec failure", cmdNfs4Setfacl))
+// walkApply applies the function `f` on the `path` and on all files and sub-directories
+// under it.  The walk continues on the paths on which `f` fails, and the errors are
+// returned together once the walk is completed.
+func walkApply(path string, followLink bool, f func(path string) error) error {
+	var errs []string
+	for p := range ufp.GoFastWalk(path, followLink, false, 16) {
+		if err := f(p.Path); err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %s", p.Path, err))
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("failed on %d paths: %s", len(errs), strings.Join(errs, "; "))
+	}
+	return nil
 }
 
 // getPrincipleName transforms the ACE's Principle into the valid system user or group name.
 func getPrincipleName(ace ACE) string {
 	if strings.Index(ace.Flag, "g") >= 0 {
-		return "g:" + strings.TrimSuffix(ace.Principle, "@"+userDomain)
+		return GroupPrincipal(strings.TrimSuffix(ace.Principle, "@"+userDomain))
 	}
 	return strings.TrimSuffix(ace.Principle, "@"+userDomain)
 }
@@ -215,13 +220,11 @@ func parseAce(ace string) (*ACE, error) {
 	}, nil
 }
 
-// newAceFromRole constructs a ACE from the given role and the system user (or group) name.
-func newAceFromRole(role Role, userOrGroupName string) (*ACE, error) {
-	group := false
-	if strings.Index(userOrGroupName, "g:") == 0 {
-		group = true
-		userOrGroupName = strings.TrimLeft(userOrGroupName, "g:")
-	}
+// newAceFromRole constructs a ACE from the given role and the principal referring to
+// the system user or group (see `ParsePrincipal`).  The ACE of the Writer role has no
+// delete permissions (i.e. the `d` and `D` bits).
+func newAceFromRole(role Role, principal string) (*ACE, error) {
+	userOrGroupName, group := ParsePrincipal(principal)
 
 	return &ACE{
 		Type:      "A",
@@ -1,6 +1,11 @@
 package acl
 
 import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -28,3 +33,49 @@ func TestIsValidPrinciple(t *testing.T) {
 		t.Errorf("principle not valid: %s", ace.Principle)
 	}
 }
+
+func TestNewAceFromGroup(t *testing.T) {
+	ace, _ := newAceFromRole(Contributor, GroupPrincipal("geeks"))
+	if ace.Principle != "geeks@dccn.nl" || ace.Flag != "fdg" {
+		t.Errorf("unexpected group ACE: %s", ace)
+	}
+	if pn := getPrincipleName(*ace); pn != "g:geeks" {
+		t.Errorf("Expected principle name %s but got %s", "g:geeks", pn)
+	}
+
+	ace, _ = newAceFromRole(Viewer, "geeks")
+	if ace.Principle != "geeks@dccn.nl" || ace.Flag != "fd" {
+		t.Errorf("unexpected user ACE: %s", ace)
+	}
+}
+
+func TestWalkApply(t *testing.T) {
+	dir, err := ioutil.TempDir("", "walkapply")
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, f := range []string{"a", "b", "c"} {
+		if err := ioutil.WriteFile(filepath.Join(dir, f), []byte("test"), 0644); err != nil {
+			t.Fatalf("%s", err)
+		}
+	}
+
+	visited := 0
+	err = walkApply(dir, false, func(p string) error {
+		visited++
+		if filepath.Base(p) == "a" || filepath.Base(p) == "c" {
+			return fmt.Errorf("failure")
+		}
+		return nil
+	})
+
+	// the walk continues after the failures.
+	if visited != 4 {
+		t.Errorf("expect 4 visited paths but got %d", visited)
+	}
+	if err == nil || !strings.HasPrefix(err.Error(), "failed on 2 paths") {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
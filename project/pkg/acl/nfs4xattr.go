@@ -0,0 +1,195 @@
+package acl
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/pkg/xattr"
+)
+
+// xattrNfs4ACL is the extended attribute through which the Linux NFS client
+// exposes the NFSv4 ACL of a file or directory.  The value is the XDR encoding
+// of the `fattr4_acl` attribute defined in RFC 7530.
+const xattrNfs4ACL string = "system.nfs4_acl"
+
+// aceTypeBits maps the ACE type letters used in the ACE string into the
+// `acetype4` values.
+var aceTypeBits = map[string]uint32{
+	"A": 0x0, // ACCESS_ALLOWED
+	"D": 0x1, // ACCESS_DENIED
+	"U": 0x2, // SYSTEM_AUDIT
+	"L": 0x3, // SYSTEM_ALARM
+}
+
+// aceLetterBit associates an ACE flag (or mask) letter with its `aceflag4`
+// (or `acemask4`) bit.
+type aceLetterBit struct {
+	letter byte
+	bit    uint32
+}
+
+// aceFlagBits lists the ACE flag letters in the order they are presented
+// in the ACE string.
+var aceFlagBits = []aceLetterBit{
+	{'f', 0x00000001}, // FILE_INHERIT
+	{'d', 0x00000002}, // DIRECTORY_INHERIT
+	{'n', 0x00000004}, // NO_PROPAGATE_INHERIT
+	{'i', 0x00000008}, // INHERIT_ONLY
+	{'S', 0x00000010}, // SUCCESSFUL_ACCESS
+	{'F', 0x00000020}, // FAILED_ACCESS
+	{'g', 0x00000040}, // IDENTIFIER_GROUP
+	{'I', 0x00000080}, // INHERITED_ACE
+}
+
+// aceMaskBits lists the ACE mask letters in the order they are presented
+// in the ACE string.
+var aceMaskBits = []aceLetterBit{
+	{'r', 0x00000001}, // READ_DATA, LIST_DIRECTORY
+	{'w', 0x00000002}, // WRITE_DATA, ADD_FILE
+	{'a', 0x00000004}, // APPEND_DATA, ADD_SUBDIRECTORY
+	{'D', 0x00000040}, // DELETE_CHILD
+	{'d', 0x00010000}, // DELETE
+	{'x', 0x00000020}, // EXECUTE
+	{'t', 0x00000080}, // READ_ATTRIBUTES
+	{'T', 0x00000100}, // WRITE_ATTRIBUTES
+	{'n', 0x00000008}, // READ_NAMED_ATTRS
+	{'N', 0x00000010}, // WRITE_NAMED_ATTRS
+	{'c', 0x00020000}, // READ_ACL
+	{'C', 0x00040000}, // WRITE_ACL
+	{'o', 0x00080000}, // WRITE_OWNER
+	{'y', 0x00100000}, // SYNCHRONIZE
+}
+
+// lettersToBits converts the `letters` into a bitmask using the given letter-bit table.
+func lettersToBits(letters string, table []aceLetterBit) (uint32, error) {
+	var bits uint32
+	for _, l := range []byte(letters) {
+		found := false
+		for _, lb := range table {
+			if lb.letter == l {
+				bits |= lb.bit
+				found = true
+				break
+			}
+		}
+		if !found {
+			return 0, fmt.Errorf("unknown letter: %c", l)
+		}
+	}
+	return bits, nil
+}
+
+// bitsToLetters converts the bitmask into letters using the given letter-bit table.  The
+// bits that are not in the table are returned as `unknown`.
+func bitsToLetters(bits uint32, table []aceLetterBit) (letters string, unknown uint32) {
+	var l []byte
+	for _, lb := range table {
+		if bits&lb.bit != 0 {
+			l = append(l, lb.letter)
+			bits &^= lb.bit
+		}
+	}
+	return string(l), bits
+}
+
+// encodeNfs4ACL encodes the list of ACEs into the XDR representation of the
+// `fattr4_acl` attribute.
+func encodeNfs4ACL(aces []ACE) ([]byte, error) {
+	var buf bytes.Buffer
+
+	binary.Write(&buf, binary.BigEndian, uint32(len(aces)))
+
+	for _, ace := range aces {
+		t, ok := aceTypeBits[ace.Type]
+		if !ok {
+			return nil, fmt.Errorf("invalid ACE type: %s", ace)
+		}
+		flag, err := lettersToBits(ace.Flag, aceFlagBits)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ACE flag, %s: %s", err, ace)
+		}
+		mask, err := lettersToBits(ace.Mask, aceMaskBits)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ACE mask, %s: %s", err, ace)
+		}
+
+		binary.Write(&buf, binary.BigEndian, []uint32{t, flag | ace.flagBits, mask | ace.maskBits, uint32(len(ace.Principle))})
+		buf.WriteString(ace.Principle)
+		// XDR opaque data is padded to a multiple of 4 bytes
+		buf.Write(make([]byte, (4-len(ace.Principle)%4)%4))
+	}
+
+	return buf.Bytes(), nil
+}
+
+// decodeNfs4ACL decodes the XDR representation of the `fattr4_acl` attribute
+// into a list of ACEs.
+func decodeNfs4ACL(data []byte) ([]ACE, error) {
+	r := bytes.NewReader(data)
+
+	var n uint32
+	if err := binary.Read(r, binary.BigEndian, &n); err != nil {
+		return nil, fmt.Errorf("cannot read number of ACEs: %s", err)
+	}
+
+	// every ACE takes at least 16 bytes
+	if int64(n)*16 > int64(r.Len()) {
+		return nil, fmt.Errorf("invalid number of ACEs: %d", n)
+	}
+
+	aces := make([]ACE, 0, n)
+	for i := uint32(0); i < n; i++ {
+
+		var hdr [4]uint32 // type, flag, mask and length of principle
+		if err := binary.Read(r, binary.BigEndian, &hdr); err != nil {
+			return nil, fmt.Errorf("cannot read ACE %d: %s", i, err)
+		}
+
+		if int64(hdr[3]) > int64(r.Len()) {
+			return nil, fmt.Errorf("invalid principle length of ACE %d: %d", i, hdr[3])
+		}
+		who := make([]byte, hdr[3]+(4-hdr[3]%4)%4)
+		if _, err := io.ReadFull(r, who); err != nil {
+			return nil, fmt.Errorf("cannot read principle of ACE %d: %s", i, err)
+		}
+
+		ace := ACE{Principle: string(who[:hdr[3]])}
+		for l, t := range aceTypeBits {
+			if t == hdr[0] {
+				ace.Type = l
+			}
+		}
+		if ace.Type == "" {
+			return nil, fmt.Errorf("invalid type of ACE %d: %d", i, hdr[0])
+		}
+
+		// the bits unknown to the ACE string are kept aside, e.g. the flags and masks
+		// of the later NFSv4 minor versions.
+		ace.Flag, ace.flagBits = bitsToLetters(hdr[1], aceFlagBits)
+		ace.Mask, ace.maskBits = bitsToLetters(hdr[2], aceMaskBits)
+
+		aces = append(aces, ace)
+	}
+
+	return aces, nil
+}
+
+// getNfs4ACL reads the ACEs of the given path from the `system.nfs4_acl` extended attribute.
+func getNfs4ACL(path string) ([]ACE, error) {
+	data, err := xattr.Get(path, xattrNfs4ACL)
+	if err != nil {
+		return nil, err
+	}
+	return decodeNfs4ACL(data)
+}
+
+// setNfs4ACL writes the ACEs to the `system.nfs4_acl` extended attribute of the given path.
+func setNfs4ACL(path string, aces []ACE) error {
+	data, err := encodeNfs4ACL(aces)
+	if err != nil {
+		return err
+	}
+	return xattr.Set(path, xattrNfs4ACL, data)
+}
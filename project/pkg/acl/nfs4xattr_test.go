@@ -0,0 +1,123 @@
+package acl
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestNfs4ACLRoundTrip(t *testing.T) {
+	// ACE strings in the format of the "nfs4_getfacl" output
+	aceStrs := []string{
+		"A:fd:kelvdun@dccn.nl:rwaDdxtTnNcCoy",
+		"A:fdg:tg@dccn.nl:rwaDdxtTnNcy",
+		"D:f:edwger@dccn.nl:d",
+		"A:fd:OWNER@:rwaDxtTnNcCy",
+		"A::EVERYONE@:rtncy",
+	}
+
+	var aces []ACE
+	for _, s := range aceStrs {
+		ace, err := parseAce(s)
+		if err != nil {
+			t.Fatalf("%s", err)
+		}
+		aces = append(aces, *ace)
+	}
+
+	data, err := encodeNfs4ACL(aces)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	acesOut, err := decodeNfs4ACL(data)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	if len(acesOut) != len(aceStrs) {
+		t.Fatalf("expect %d ACEs but got %d", len(aceStrs), len(acesOut))
+	}
+	for i, ace := range acesOut {
+		if ace.String() != aceStrs[i] {
+			t.Errorf("expect ACE %s but got %s", aceStrs[i], ace)
+		}
+	}
+}
+
+func TestNfs4ACLEncoding(t *testing.T) {
+	ace, _ := parseAce("D:fdg:abc@:rd")
+
+	data, err := encodeNfs4ACL([]ACE{*ace})
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	expected := []byte{
+		0, 0, 0, 1, // number of ACEs
+		0, 0, 0, 1, // type: DENY
+		0, 0, 0, 0x43, // flag: FILE_INHERIT|DIRECTORY_INHERIT|IDENTIFIER_GROUP
+		0, 0x01, 0, 0x01, // mask: READ_DATA|DELETE
+		0, 0, 0, 4, // length of principle
+		'a', 'b', 'c', '@',
+	}
+	if !bytes.Equal(data, expected) {
+		t.Errorf("expect %v but got %v", expected, data)
+	}
+
+	// principle padded to a multiple of 4 bytes
+	ace.Principle = "ab@"
+	data, _ = encodeNfs4ACL([]ACE{*ace})
+	if len(data) != len(expected) {
+		t.Errorf("expect %d bytes but got %d", len(expected), len(data))
+	}
+
+	// truncated data
+	if _, err := decodeNfs4ACL(data[:len(data)-2]); err == nil {
+		t.Errorf("expect error on truncated data")
+	}
+}
+
+func TestNfs4ACLUnknownBits(t *testing.T) {
+	data := []byte{
+		0, 0, 0, 1, // number of ACEs
+		0, 0, 0, 0, // type: ALLOW
+		0, 0, 0x01, 0x03, // flag: FILE_INHERIT|DIRECTORY_INHERIT and an unknown bit
+		0x10, 0, 0, 0x01, // mask: READ_DATA and an unknown bit
+		0, 0, 0, 4, // length of principle
+		'a', 'b', 'c', '@',
+	}
+
+	aces, err := decodeNfs4ACL(data)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if aces[0].String() != "A:fd:abc@:r" {
+		t.Errorf("unexpected ACE: %s", aces[0])
+	}
+
+	// the unknown bits are written back.
+	dataOut, err := encodeNfs4ACL(aces)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if !bytes.Equal(data, dataOut) {
+		t.Errorf("expect %v but got %v", data, dataOut)
+	}
+}
+
+func TestNfs4ACLRoles(t *testing.T) {
+	for _, r := range []Role{Manager, Contributor, Writer, Viewer, Traverse} {
+		ace, _ := newAceFromRole(r, "honlee")
+		data, err := encodeNfs4ACL([]ACE{*ace})
+		if err != nil {
+			t.Fatalf("%s: %s", r, err)
+		}
+		aces, err := decodeNfs4ACL(data)
+		if err != nil {
+			t.Fatalf("%s: %s", r, err)
+		}
+		if aces[0].ToRole() != r {
+			t.Errorf("expect role %s but got %s: %s", r, aces[0].ToRole(), aces[0])
+		}
+	}
+}
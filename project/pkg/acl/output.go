@@ -0,0 +1,145 @@
+package acl
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// OutputFormat is an enumerator for the formats in which the RolePathMap is written.
+type OutputFormat int
+
+const (
+	// OutputText is the human-readable text format.
+	OutputText OutputFormat = iota
+	// OutputJSON is the JSON lines format, one JSON object per path.
+	OutputJSON
+	// OutputCSV is the CSV format with columns `path`, `role` and `users`.
+	OutputCSV
+	// OutputYAML is the YAML format, one sequence item per path.
+	OutputYAML
+)
+
+var outputFormatStrings = map[OutputFormat]string{
+	OutputText: "text",
+	OutputJSON: "json",
+	OutputCSV:  "csv",
+	OutputYAML: "yaml",
+}
+
+// Set implements the interface for flag.Var().
+func (f *OutputFormat) Set(v string) error {
+	for k, s := range outputFormatStrings {
+		if s == strings.ToLower(v) {
+			*f = k
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown output format: %s", v)
+}
+
+// String implements the interface for flag.Var().  It returns the
+// name of the output format.
+func (f *OutputFormat) String() string {
+	return outputFormatStrings[*f]
+}
+
+// Type implements the interface for pflag.Var() used by the cobra commands.
+func (f *OutputFormat) Type() string {
+	return "format"
+}
+
+// rolesInOrder is the order in which the roles are written out.
+var rolesInOrder = []Role{Manager, Contributor, Writer, Viewer, Traverse}
+
+// rolePathRecord is the serializable representation of the RolePathMap.
+type rolePathRecord struct {
+	Path  string              `json:"path" yaml:"path"`
+	Roles map[string][]string `json:"roles" yaml:"roles"`
+}
+
+// RoleWriter writes RolePathMap to an `io.Writer` in one of the OutputFormat.
+type RoleWriter struct {
+	w      io.Writer
+	format OutputFormat
+	csv    *csv.Writer
+}
+
+// NewRoleWriter returns a RoleWriter writing to `w` in the given `format`.
+func NewRoleWriter(w io.Writer, format OutputFormat) *RoleWriter {
+	rw := &RoleWriter{w: w, format: format}
+	if format == OutputCSV {
+		rw.csv = csv.NewWriter(w)
+		rw.csv.Write([]string{"path", "role", "users"})
+	}
+	return rw
+}
+
+// Write writes the RolePathMap `m` to the underlying `io.Writer`. The System role is
+// not written.
+func (rw *RoleWriter) Write(m RolePathMap) error {
+	switch rw.format {
+	case OutputJSON:
+		b, err := json.Marshal(newRolePathRecord(m))
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(rw.w, "%s\n", b)
+		return err
+	case OutputYAML:
+		b, err := yaml.Marshal([]rolePathRecord{newRolePathRecord(m)})
+		if err != nil {
+			return err
+		}
+		_, err = rw.w.Write(b)
+		return err
+	case OutputCSV:
+		for _, r := range rolesInOrder {
+			if users, ok := m.RoleMap[r]; ok {
+				if err := rw.csv.Write([]string{m.Path, r.String(), strings.Join(users, ",")}); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	default:
+		if _, err := fmt.Fprintf(rw.w, "%s:\n", m.Path); err != nil {
+			return err
+		}
+		for _, r := range rolesInOrder {
+			if users, ok := m.RoleMap[r]; ok {
+				if _, err := fmt.Fprintf(rw.w, "%12s: %s\n", r, strings.Join(users, ",")); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+}
+
+// Flush writes any buffered data to the underlying `io.Writer`.
+func (rw *RoleWriter) Flush() error {
+	if rw.csv != nil {
+		rw.csv.Flush()
+		return rw.csv.Error()
+	}
+	return nil
+}
+
+// newRolePathRecord converts the RolePathMap into the rolePathRecord.
+func newRolePathRecord(m RolePathMap) rolePathRecord {
+	rec := rolePathRecord{
+		Path:  m.Path,
+		Roles: make(map[string][]string),
+	}
+	for _, r := range rolesInOrder {
+		if users, ok := m.RoleMap[r]; ok {
+			rec.Roles[r.String()] = users
+		}
+	}
+	return rec
+}
@@ -0,0 +1,48 @@
+package acl
+
+import (
+	"bytes"
+	"testing"
+)
+
+var testRolePathMap = RolePathMap{
+	Path: "/project/3010000.01/",
+	RoleMap: RoleMap{
+		Manager:     {"honlee"},
+		Contributor: {"edwger", "rendbru"},
+		System:      {"OWNER@"},
+	},
+}
+
+func TestOutputFormatSet(t *testing.T) {
+	var f OutputFormat
+	if err := f.Set("JSON"); err != nil || f != OutputJSON {
+		t.Errorf("expect format %s but got %s: %v", "json", f.String(), err)
+	}
+	if err := f.Set("xml"); err == nil {
+		t.Errorf("expect error on unknown format")
+	}
+}
+
+func TestRoleWriter(t *testing.T) {
+	expected := map[OutputFormat]string{
+		OutputText: "/project/3010000.01/:\n     manager: honlee\n contributor: edwger,rendbru\n",
+		OutputJSON: `{"path":"/project/3010000.01/","roles":{"contributor":["edwger","rendbru"],"manager":["honlee"]}}` + "\n",
+		OutputCSV:  "path,role,users\n/project/3010000.01/,manager,honlee\n/project/3010000.01/,contributor,\"edwger,rendbru\"\n",
+		OutputYAML: "- path: /project/3010000.01/\n  roles:\n    contributor:\n    - edwger\n    - rendbru\n    manager:\n    - honlee\n",
+	}
+
+	for f, out := range expected {
+		var buf bytes.Buffer
+		w := NewRoleWriter(&buf, f)
+		if err := w.Write(testRolePathMap); err != nil {
+			t.Errorf("%s: %s", f.String(), err)
+		}
+		if err := w.Flush(); err != nil {
+			t.Errorf("%s: %s", f.String(), err)
+		}
+		if buf.String() != out {
+			t.Errorf("%s: expect\n%s\nbut got\n%s", f.String(), out, buf.String())
+		}
+	}
+}
@@ -0,0 +1,274 @@
+package acl
+
+import (
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	ufp "github.com/Donders-Institute/tg-toolset-golang/pkg/filepath"
+	log "github.com/Donders-Institute/tg-toolset-golang/pkg/logger"
+)
+
+// RoleDiff is a data structure describing the role changes that would be
+// applied on a path by a set or delete action.
+type RoleDiff struct {
+	Path string
+	// Added contains users to be added to the role.
+	Added RoleMap
+	// Removed contains users to be removed from the role.
+	Removed RoleMap
+	// Unchanged contains users for whom the role stays the same.
+	Unchanged RoleMap
+}
+
+// HasChanges checks if there is any role to be added or removed.
+func (d RoleDiff) HasChanges() bool {
+	return len(d.Added) > 0 || len(d.Removed) > 0
+}
+
+// PlanSummary contains the counters of a planned set or delete action.
+type PlanSummary struct {
+	// Paths is the number of visited paths.
+	Paths int
+	// PathsChanged is the number of visited paths on which roles would be changed.
+	PathsChanged int
+	// Added is the total number of role entries to be added.
+	Added int
+	// Removed is the total number of role entries to be removed.
+	Removed int
+	// Unchanged is the total number of role entries that stay the same.
+	Unchanged int
+}
+
+// String returns a single-line representation of the summary.
+func (s PlanSummary) String() string {
+	return fmt.Sprintf("paths visited: %d, paths to change: %d, roles added: %d, removed: %d, unchanged: %d",
+		s.Paths, s.PathsChanged, s.Added, s.Removed, s.Unchanged)
+}
+
+// diffRoles calculates the role changes on a path with roles `rolesNow` when
+// the `roles` are set (`delFlag` is false) or deleted (`delFlag` is true).
+//
+// The calculation follows how the rolers apply the changes: setting a role
+// for a user replaces the user's current role; deleting a role for a user only
+// takes effect if the user is currently in that role.  The traverse and system
+// roles are not replaced, and setting the traverse role replaces no role.
+func diffRoles(path string, rolesNow, roles RoleMap, delFlag bool) RoleDiff {
+
+	diff := RoleDiff{
+		Path:      path,
+		Added:     make(RoleMap),
+		Removed:   make(RoleMap),
+		Unchanged: make(RoleMap),
+	}
+
+	// map of user to the current roles for faster lookup
+	umap := make(map[string][]Role)
+	for r, users := range rolesNow {
+		if r == System {
+			continue
+		}
+		for _, u := range users {
+			umap[u] = append(umap[u], r)
+		}
+	}
+
+	for r, users := range roles {
+		for _, u := range users {
+			if delFlag {
+				if hasRole(umap[u], r) {
+					diff.Removed[r] = append(diff.Removed[r], u)
+				}
+				continue
+			}
+
+			if hasRole(umap[u], r) {
+				diff.Unchanged[r] = append(diff.Unchanged[r], u)
+			} else {
+				diff.Added[r] = append(diff.Added[r], u)
+			}
+
+			// other roles of the user are replaced
+			if r == Traverse {
+				continue
+			}
+			for _, rn := range umap[u] {
+				if rn != r && rn != Traverse {
+					diff.Removed[rn] = append(diff.Removed[rn], u)
+				}
+			}
+		}
+	}
+
+	// remove empty entries
+	for _, m := range []RoleMap{diff.Added, diff.Removed, diff.Unchanged} {
+		for r, users := range m {
+			if len(users) == 0 {
+				delete(m, r)
+			}
+		}
+	}
+
+	return diff
+}
+
+// hasRole checks if the role `r` is in the list of `roles`.
+func hasRole(roles []Role, r Role) bool {
+	for _, rr := range roles {
+		if rr == r {
+			return true
+		}
+	}
+	return false
+}
+
+// countRoleMap returns the total number of users in the RoleMap.
+func countRoleMap(m RoleMap) int {
+	n := 0
+	for _, users := range m {
+		n += len(users)
+	}
+	return n
+}
+
+// goPlanRoles calculates the role changes on paths provided through the `chanF` channel,
+// using a go routine. Nothing is changed on the filesystem. It returns a channel
+// containing the `RoleDiff` of every visited path.
+func (r Runner) goPlanRoles(roles RoleMap, chanF chan ufp.FilePathMode, nthreads int, delFlag bool) chan RoleDiff {
+
+	// output channel
+	chanOut := make(chan RoleDiff)
+
+	// launch parallel go routines for calculating role changes
+	go func() {
+		var wg sync.WaitGroup
+		wg.Add(nthreads)
+		for i := 0; i < nthreads; i++ {
+			go func() {
+				defer wg.Done()
+				for f := range chanF {
+					roler := GetRoler(f)
+					if roler == nil {
+						log.Warnf("roler not found: %s", f.Path)
+						continue
+					}
+					log.Debugf("path: %s %s", f.Path, reflect.TypeOf(roler))
+					rolesNow, err := roler.GetRoles(f)
+					if err != nil {
+						log.Errorf("%s: %s", err, f.Path)
+						continue
+					}
+					chanOut <- diffRoles(f.Path, rolesNow, roles, delFlag)
+				}
+			}()
+		}
+		wg.Wait()
+		close(chanOut)
+	}()
+
+	return chanOut
+}
+
+// goTraversePaths resolves the parent directories of the `paths` on which the traverse role
+// would be set (`delFlag` is false) or deleted (`delFlag` is true).  Each parent directory is
+// pushed to the returned channel only once.
+func (r Runner) goTraversePaths(paths []string, rolesT RoleMap, buffer int, delFlag bool) chan ufp.FilePathMode {
+	chanFt := make(chan ufp.FilePathMode, buffer)
+	go func() {
+		defer close(chanFt)
+
+		chanP := make(chan ufp.FilePathMode, buffer)
+		go func() {
+			defer close(chanP)
+			for _, p := range paths {
+				if delFlag {
+					GetPathsForDelTraverse(p, rolesT, &chanP)
+				} else {
+					GetPathsForSetTraverse(p, rolesT, &chanP)
+				}
+			}
+		}()
+
+		seen := make(map[string]bool)
+		for p := range chanP {
+			if k := filepath.Clean(p.Path); !seen[k] {
+				seen[k] = true
+				chanFt <- p
+			}
+		}
+	}()
+	return chanFt
+}
+
+// planRoles walks through the `Runner.RootPath` and prints the role changes that would be
+// made by setting (`delFlag` is false) or deleting (`delFlag` is true) the `roles`, without
+// touching the filesystem.  If `Runner.Traverse` is true, the traverse roles in `rolesT` are
+// planned on the parent directories of the walked paths deviating from the `Runner.RootPath`
+// from the project storage perspective, and of the `Runner.RootPath` itself; as the roles
+// are applied by `SetRoles` and `RemoveRoles`.
+func (r Runner) planRoles(roles, rolesT RoleMap, delFlag bool) PlanSummary {
+
+	var summary PlanSummary
+
+	// paths of which the parent directories are considered for the traverse roles.
+	var pathsT []string
+
+	opts := ufp.WalkOptions{FollowLink: r.FollowLink, SkipFiles: r.SkipFiles}
+	chanF := ufp.GoFastWalkWithOptions(r.ppath, r.walkFilter(opts), r.Nthreads*4)
+	for d := range r.goPlanRoles(roles, chanF, r.Nthreads, delFlag) {
+		if r.Traverse && !IsSameProjectPath(d.Path, r.ppath) {
+			pathsT = append(pathsT, d.Path)
+		}
+		r.printDiff(d, &summary)
+	}
+
+	if r.Traverse {
+		pathsT = append(pathsT, r.ppath)
+		if r.ppath != r.RootPath {
+			pathsT = append(pathsT, r.RootPath)
+		}
+		chanFt := r.goTraversePaths(pathsT, rolesT, r.Nthreads*4, delFlag)
+		for d := range r.goPlanRoles(rolesT, chanFt, r.Nthreads, delFlag) {
+			r.printDiff(d, &summary)
+		}
+	}
+
+	fmt.Printf("%s\n", summary)
+
+	return summary
+}
+
+// printDiff prints the role changes `d` on a path, and counts them into the `summary`.
+func (r Runner) printDiff(d RoleDiff, summary *PlanSummary) {
+	summary.Paths++
+	summary.Added += countRoleMap(d.Added)
+	summary.Removed += countRoleMap(d.Removed)
+	summary.Unchanged += countRoleMap(d.Unchanged)
+
+	if !d.HasChanges() {
+		log.Debugf("%s: no change", d.Path)
+		return
+	}
+	summary.PathsChanged++
+
+	if r.Silence {
+		return
+	}
+	fmt.Printf("%s:\n", d.Path)
+	printRoleMap("+", d.Added)
+	printRoleMap("-", d.Removed)
+}
+
+// printRoleMap prints users of the RoleMap in a fixed role order, each line is
+// prefixed with the given `prefix`.
+func printRoleMap(prefix string, m RoleMap) {
+	for _, r := range rolesInOrder {
+		if users, ok := m[r]; ok {
+			sort.Strings(users)
+			fmt.Printf("%s %12s: %s\n", prefix, r, strings.Join(users, ","))
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package acl
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiffRolesSet(t *testing.T) {
+	rolesNow := RoleMap{
+		Manager:     {"honlee"},
+		Contributor: {"edwger"},
+		System:      {"OWNER@"},
+	}
+
+	roles := RoleMap{
+		Manager: {"honlee"},
+		Viewer:  {"edwger", "rendbru"},
+	}
+
+	d := diffRoles("/project/3010000.01/", rolesNow, roles, false)
+
+	if !reflect.DeepEqual(d.Added, RoleMap{Viewer: {"edwger", "rendbru"}}) {
+		t.Errorf("unexpected added roles: %+v", d.Added)
+	}
+	if !reflect.DeepEqual(d.Removed, RoleMap{Contributor: {"edwger"}}) {
+		t.Errorf("unexpected removed roles: %+v", d.Removed)
+	}
+	if !reflect.DeepEqual(d.Unchanged, RoleMap{Manager: {"honlee"}}) {
+		t.Errorf("unexpected unchanged roles: %+v", d.Unchanged)
+	}
+	if !d.HasChanges() {
+		t.Errorf("expect changes on %s", d.Path)
+	}
+}
+
+func TestDiffRolesDelete(t *testing.T) {
+	rolesNow := RoleMap{
+		Manager:     {"honlee"},
+		Contributor: {"edwger"},
+	}
+
+	roles := RoleMap{
+		Manager:     {"edwger"},
+		Contributor: {"edwger"},
+	}
+
+	d := diffRoles("/project/3010000.01/", rolesNow, roles, true)
+
+	if len(d.Added) != 0 {
+		t.Errorf("unexpected added roles: %+v", d.Added)
+	}
+	if !reflect.DeepEqual(d.Removed, RoleMap{Contributor: {"edwger"}}) {
+		t.Errorf("unexpected removed roles: %+v", d.Removed)
+	}
+
+	d = diffRoles("/project/3010000.01/", rolesNow, RoleMap{Viewer: {"honlee"}}, true)
+	if d.HasChanges() {
+		t.Errorf("expect no changes on %s: %+v", d.Path, d)
+	}
+}
+
+func TestDiffRolesTraverse(t *testing.T) {
+	rolesNow := RoleMap{
+		Viewer:   {"honlee"},
+		Traverse: {"edwger"},
+	}
+
+	// setting the traverse role replaces no role.
+	d := diffRoles("/project/3010000.01/", rolesNow, RoleMap{Traverse: {"honlee"}}, false)
+	if !reflect.DeepEqual(d.Added, RoleMap{Traverse: {"honlee"}}) {
+		t.Errorf("unexpected added roles: %+v", d.Added)
+	}
+	if len(d.Removed) != 0 {
+		t.Errorf("unexpected removed roles: %+v", d.Removed)
+	}
+
+	// the traverse role is not replaced.
+	d = diffRoles("/project/3010000.01/", rolesNow, RoleMap{Writer: {"edwger"}}, false)
+	if !reflect.DeepEqual(d.Added, RoleMap{Writer: {"edwger"}}) {
+		t.Errorf("unexpected added roles: %+v", d.Added)
+	}
+	if len(d.Removed) != 0 {
+		t.Errorf("unexpected removed roles: %+v", d.Removed)
+	}
+}
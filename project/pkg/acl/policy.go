@@ -0,0 +1,277 @@
+package acl
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/user"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	ufp "github.com/Donders-Institute/tg-toolset-golang/pkg/filepath"
+	log "github.com/Donders-Institute/tg-toolset-golang/pkg/logger"
+	"gopkg.in/yaml.v2"
+)
+
+// Policy declares the desired roles on a project root and on selected sub-directories
+// of it.  It is loaded from a YAML file, for example:
+//
+//	project: "3010000.01"
+//	roles:
+//	  manager: [honlee]
+//	  contributor: [edwger, rendbru]
+//	subdirs:
+//	  - path: raw
+//	    roles:
+//	      viewer: [rendbru]
+//	  - path: private
+//	    exclusive: true
+//	    roles:
+//	      manager: [honlee]
+//
+// The users in the roles of a sub-directory get the traverse role on the parent directories
+// so that they can reach the sub-directory.
+type Policy struct {
+	// Project is the id of the project, resolved into a directory under the root path of
+	// the project storage.  It is ignored if Path is specified.
+	Project string `yaml:"project"`
+	// Path is the path of the project root.
+	Path string `yaml:"path"`
+	// Roles are the desired roles on the project root, applied recursively.
+	Roles RoleMap `yaml:"roles"`
+	// Traverse specifies whether the users should get the traverse role on the parent
+	// directories of the project root.  It is enabled by default.
+	Traverse *bool `yaml:"traverse"`
+	// Subdirs are the desired roles on sub-directories of the project root.
+	Subdirs []SubdirPolicy `yaml:"subdirs"`
+}
+
+// SubdirPolicy declares the desired roles on a sub-directory of the project root.
+type SubdirPolicy struct {
+	// Path is the path of the sub-directory relative to the project root.
+	Path string `yaml:"path"`
+	// Roles are the desired roles on the sub-directory, applied recursively.  Unless the
+	// sub-directory is exclusive, they are on top of the roles of the project root; a user
+	// in the roles of the sub-directory replaces the user's role inherited from the project root.
+	Roles RoleMap `yaml:"roles"`
+	// Exclusive specifies whether the sub-directory is only accessible to the users in its
+	// own roles, not inheriting the roles of the project root.
+	Exclusive bool `yaml:"exclusive"`
+}
+
+// PolicyTarget is the desired roles on a path derived from a Policy.
+type PolicyTarget struct {
+	Path  string
+	Roles RoleMap
+}
+
+// LoadPolicy reads the Policy from the YAML file `fpath`.
+func LoadPolicy(fpath string) (*Policy, error) {
+	data, err := ioutil.ReadFile(fpath)
+	if err != nil {
+		return nil, err
+	}
+
+	var p Policy
+	if err := yaml.UnmarshalStrict(data, &p); err != nil {
+		return nil, fmt.Errorf("invalid policy %s: %s", fpath, err)
+	}
+
+	if err := p.validate(); err != nil {
+		return nil, fmt.Errorf("invalid policy %s: %s", fpath, err)
+	}
+
+	return &p, nil
+}
+
+// validate checks the roles and the sub-directory paths of the policy.
+func (p Policy) validate() error {
+
+	if p.Project == "" && p.Path == "" {
+		return fmt.Errorf("neither project nor path is specified")
+	}
+
+	if err := validatePolicyRoles(p.Roles); err != nil {
+		return err
+	}
+
+	subdirs := make(map[string]bool)
+	for _, s := range p.Subdirs {
+		spath := filepath.Clean(s.Path)
+		if s.Path == "" || filepath.IsAbs(spath) || spath == "." || strings.HasPrefix(spath, "..") {
+			return fmt.Errorf("subdir path not relative to the project root: %s", s.Path)
+		}
+		if subdirs[spath] {
+			return fmt.Errorf("subdir specified more than once: %s", s.Path)
+		}
+		subdirs[spath] = true
+
+		if err := validatePolicyRoles(s.Roles); err != nil {
+			return fmt.Errorf("%s: %s", s.Path, err)
+		}
+	}
+
+	return nil
+}
+
+// validatePolicyRoles checks that only the roles supported by the Runner are used, and that
+// a user is not in more than one role.
+func validatePolicyRoles(roles RoleMap) error {
+	users := make(map[string]bool)
+	for r, us := range roles {
+		switch r {
+		case Manager, Contributor, Writer, Viewer:
+		default:
+			return fmt.Errorf("role not supported in policy: %s", r)
+		}
+		for _, u := range us {
+			if users[u] {
+				return fmt.Errorf("user specified more than once: %s", u)
+			}
+			users[u] = true
+		}
+	}
+	return nil
+}
+
+// RootPath returns the path of the project root.  The `base` is the root path of the
+// project storage, in which the project directory is resolved if the Path is not specified.
+func (p Policy) RootPath(base string) string {
+	if p.Path != "" {
+		return filepath.Clean(p.Path)
+	}
+	return filepath.Join(base, p.Project)
+}
+
+// Targets returns the desired roles on the project root and its sub-directories, in which
+// the project root is resolved in `base` (see `RootPath`).  The targets are ordered so that
+// a parent directory comes before its sub-directories, as roles are applied recursively.
+func (p Policy) Targets(base string) []PolicyTarget {
+
+	root := p.RootPath(base)
+
+	targets := []PolicyTarget{{Path: root, Roles: p.Roles}}
+	for _, s := range p.Subdirs {
+		roles := s.Roles
+		if !s.Exclusive {
+			roles = mergeRoles(p.Roles, s.Roles)
+		}
+		targets = append(targets, PolicyTarget{Path: filepath.Join(root, filepath.Clean(s.Path)), Roles: roles})
+	}
+
+	sort.SliceStable(targets, func(i, j int) bool {
+		return strings.Count(targets[i].Path, string(os.PathSeparator)) < strings.Count(targets[j].Path, string(os.PathSeparator))
+	})
+
+	return targets
+}
+
+// mergeRoles returns the roles in `base` overridden by the roles in `override`.  A user
+// in `override` is removed from the roles in `base`.
+func mergeRoles(base, override RoleMap) RoleMap {
+	users := make(map[string]bool)
+	for _, us := range override {
+		for _, u := range us {
+			users[u] = true
+		}
+	}
+
+	merged := make(RoleMap)
+	for r, us := range base {
+		for _, u := range us {
+			if !users[u] {
+				merged[r] = append(merged[r], u)
+			}
+		}
+	}
+	for r, us := range override {
+		merged[r] = append(merged[r], us...)
+	}
+	return merged
+}
+
+// ApplyPolicy converges the roles on the project root and its sub-directories to the
+// Policy `p`.  The project root is resolved in `base` (see `Policy.RootPath`).
+//
+// The targets are processed one after another.  The actual roles on the top of each target
+// are compared with the desired roles, and the deviations are fixed by setting and removing
+// roles recursively.  A target without deviation is skipped unless `Runner.Force` is set.
+// Other attributes of the Runner (e.g. `Nthreads`, `DryRun`) apply to every target; the
+// `RootPath` and the role attributes are taken from the Policy.
+func (r *Runner) ApplyPolicy(p Policy, base string) (exitcode int, err error) {
+
+	traverse := p.Traverse == nil || *p.Traverse
+
+	// the current user cannot change the own role, see `Runner.parseRoles`.
+	ignore := make(map[string]bool)
+	if me, err := user.Current(); err == nil {
+		ignore[me.Username] = true
+	}
+
+	for _, t := range p.Targets(base) {
+
+		fpinfo, err := ufp.GetFilePathMode(t.Path)
+		if err != nil {
+			return 1, fmt.Errorf("path not found or unaccessible: %s", t.Path)
+		}
+
+		roler := GetRoler(*fpinfo)
+		if roler == nil {
+			return 1, fmt.Errorf("roler not found for path: %s", t.Path)
+		}
+
+		rolesNow, err := roler.GetRoles(*fpinfo)
+		if err != nil {
+			return 1, fmt.Errorf("%s: %s", err, t.Path)
+		}
+
+		set, del := CompareRoles(t.Path, t.Roles, rolesNow).Changes(ignore)
+		if r.Force {
+			set = make(RoleMap)
+			for role, users := range t.Roles {
+				for _, u := range users {
+					if !ignore[u] {
+						set[role] = append(set[role], u)
+					}
+				}
+			}
+		}
+
+		if len(set) == 0 && len(del) == 0 {
+			log.Infof("%s: roles in place", t.Path)
+			continue
+		}
+
+		if len(set) > 0 {
+			rr := r.policyRunner(t.Path, set, traverse)
+			if ec, err := rr.SetRoles(); err != nil || ec != 0 {
+				return ec, err
+			}
+		}
+
+		if len(del) > 0 {
+			rr := r.policyRunner(t.Path, del, false)
+			if ec, err := rr.RemoveRoles(); err != nil || ec != 0 {
+				return ec, err
+			}
+		}
+	}
+
+	return
+}
+
+// policyRunner returns a copy of the Runner for setting or removing the `roles` on `path`.
+func (r Runner) policyRunner(path string, roles RoleMap, traverse bool) Runner {
+	rr := r
+	rr.RootPath = path
+	rr.Managers = strings.Join(roles[Manager], ",")
+	rr.Contributors = strings.Join(roles[Contributor], ",")
+	rr.Writers = strings.Join(roles[Writer], ",")
+	rr.Viewers = strings.Join(roles[Viewer], ",")
+	rr.Traversers = ""
+	rr.Traverse = traverse
+	// the deviations are calculated already.
+	rr.Force = true
+	return rr
+}
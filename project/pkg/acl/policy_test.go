@@ -0,0 +1,57 @@
+package acl
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLoadPolicy(t *testing.T) {
+	p, err := LoadPolicy("testdata/policy.yml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if e := (RoleMap{Manager: {"honlee"}, Contributor: {"edwger", "rendbru"}}); !reflect.DeepEqual(p.Roles, e) {
+		t.Errorf("expect roles %v, got %v", e, p.Roles)
+	}
+
+	targets := p.Targets("/project")
+	expected := []PolicyTarget{
+		{Path: "/project/3010000.01", Roles: RoleMap{Manager: {"honlee"}, Contributor: {"edwger", "rendbru"}}},
+		{Path: "/project/3010000.01/raw", Roles: RoleMap{Manager: {"honlee"}, Contributor: {"edwger", "rendbru"}, Viewer: {"dirkmol"}}},
+		{Path: "/project/3010000.01/private", Roles: RoleMap{Manager: {"honlee"}}},
+		{Path: "/project/3010000.01/raw/meg", Roles: RoleMap{Manager: {"honlee"}, Contributor: {"edwger"}, Viewer: {"rendbru"}}},
+	}
+	if !reflect.DeepEqual(targets, expected) {
+		t.Errorf("expect targets %+v, got %+v", expected, targets)
+	}
+}
+
+func TestLoadPolicyInvalid(t *testing.T) {
+	dir, err := ioutil.TempDir("", "policy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, data := range []string{
+		"roles:\n  manager: [honlee]\n",
+		"project: \"3010000.01\"\nroles:\n  owner: [honlee]\n",
+		"project: \"3010000.01\"\nroles:\n  traverse: [honlee]\n",
+		"project: \"3010000.01\"\nroles:\n  manager: [honlee]\n  viewer: [honlee]\n",
+		"project: \"3010000.01\"\nsubdirs:\n  - path: ../3010000.02\n",
+		"project: \"3010000.01\"\nsubdirs:\n  - path: /project/3010000.01/raw\n",
+		"project: \"3010000.01\"\nmembers: [honlee]\n",
+	} {
+		f := filepath.Join(dir, "policy.yml")
+		if err := ioutil.WriteFile(f, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := LoadPolicy(f); err == nil {
+			t.Errorf("expect error for policy:\n%s", data)
+		}
+	}
+}
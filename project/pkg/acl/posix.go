@@ -0,0 +1,365 @@
+package acl
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/pkg/xattr"
+
+	ufp "github.com/Donders-Institute/tg-toolset-golang/pkg/filepath"
+	log "github.com/Donders-Institute/tg-toolset-golang/pkg/logger"
+)
+
+// file attribute for registering managers on the plain POSIX filesystems
+const fattrUserManagers string = "user.project.managers"
+
+// file attribute for registering writers on the plain POSIX filesystems
+const fattrUserWriters string = "user.project.writers"
+
+// PosixRoler implements roler interface for the plain POSIX filesystems with the
+// POSIX ACL support, such as ext4, XFS, Lustre or tmpfs.
+//
+// The roles are mapped to the access and default ACLs in the same way as the
+// CephFsRoler, with the managers and writers registered in the user-namespace file
+// attributes `user.project.managers` and `user.project.writers`.  The writer role
+// has the same approximation as in the CephFsRoler.
+//
+// Unlike the CephFsRoler, no capability is raised for modifying the ACLs.  The roles
+// on a path can only be changed if the current user is `root`, the owner of the path
+// or a manager of the path, and the filesystem allows the user to modify the ACLs.
+type PosixRoler struct{}
+
+// posixRoles is the role management of the PosixRoler.
+var posixRoles = posixACLRoler{
+	fattrManagers: fattrUserManagers,
+	fattrWriters:  fattrUserWriters,
+	setACEs:       setPlainPosixACEs,
+}
+
+// GetRoles implements interface for getting user roles on a given path of a plain
+// POSIX filesystem.
+func (PosixRoler) GetRoles(pinfo ufp.FilePathMode) (RoleMap, error) {
+	return posixRoles.getRoles(pinfo)
+}
+
+// SetRoles implements interface for setting user roles to a given path of a plain
+// POSIX filesystem.
+func (PosixRoler) SetRoles(pinfo ufp.FilePathMode, roles RoleMap, recursive bool, followLink bool) (RoleMap, error) {
+	return posixRoles.setRoles(pinfo, roles, recursive)
+}
+
+// DelRoles implements interface for removing users from the specified roles on a path
+// of a plain POSIX filesystem.
+func (PosixRoler) DelRoles(pinfo ufp.FilePathMode, roles RoleMap, recursive bool, followLink bool) (RoleMap, error) {
+	return posixRoles.delRoles(pinfo, roles, recursive)
+}
+
+// setPlainPosixACEs sets (or removes if `remove` is true) the `aces` on the given `path`
+// of a plain POSIX filesystem, see `updatePosixACEs`.  It checks whether the current user
+// is allowed to change the roles on the `path`, see `isPosixManager`.
+func setPlainPosixACEs(path string, aces []PosixACE, remove bool, recursive bool) error {
+
+	if !isPosixManager(path) {
+		return fmt.Errorf("permission denied: not a manager")
+	}
+
+	return updatePosixACEs(path, aces, remove, recursive)
+}
+
+// isPosixManager checks if the current user is `root`, the owner of the `path`, or listed
+// in the `user.project.managers` file attribute of the `path` and its predecending paths.
+func isPosixManager(path string) bool {
+
+	me, err := user.Current()
+	if err != nil {
+		log.Errorf("cannot get current user: %s", err)
+		return false
+	}
+
+	if me.Uid == "0" {
+		return true
+	}
+
+	if fi, err := os.Stat(path); err == nil {
+		if st, ok := fi.Sys().(*syscall.Stat_t); ok && strconv.FormatUint(uint64(st.Uid), 10) == me.Uid {
+			return true
+		}
+	}
+
+	return isListed(path, fattrUserManagers, me.Username)
+}
+
+// posixACLRoler implements the role management with the POSIX ACL, shared by the
+// CephFsRoler and the PosixRoler.  The rolers differ in the file attributes in which
+// the managers and writers are registered, and in how the ACEs are applied.
+type posixACLRoler struct {
+	// fattrManagers is the file attribute for registering managers.
+	fattrManagers string
+	// fattrWriters is the file attribute for registering writers.
+	fattrWriters string
+	// setACEs sets (or removes if `remove` is true) the ACEs on a path.
+	setACEs func(path string, aces []PosixACE, remove bool, recursive bool) error
+}
+
+// toRole maps the permission of the `ace` to project role, with the managers and
+// writers resolved from the file attributes of the roler.
+func (r posixACLRoler) toRole(ace PosixACE) Role {
+	var role Role
+
+	switch ace.Permission {
+	case "--x":
+		role = Traverse
+	case "r-x":
+		role = Viewer
+	case "r--":
+		role = Viewer
+	case "rwx", "rw-":
+		role = Contributor
+		// user `root` is always a manager.
+		if p := ace.Principal(); p == "root" || isListed(ace.path, r.fattrManagers, p) {
+			role = Manager
+		} else if isListed(ace.path, r.fattrWriters, p) {
+			role = Writer
+		}
+	default:
+	}
+
+	return role
+}
+
+// getRoles gets user roles on the given path.
+func (r posixACLRoler) getRoles(pinfo ufp.FilePathMode) (RoleMap, error) {
+
+	// make pinfo.Path "clean"
+	pinfo.Path = filepath.Clean(pinfo.Path)
+
+	rmap := map[Role][]string{
+		Manager:     {},
+		Contributor: {},
+		Writer:      {},
+		Viewer:      {},
+		Traverse:    {},
+	}
+
+	// skip the permission mask
+	aces, _, err := getPosixACEs(pinfo.Path)
+	if err != nil {
+		return rmap, err
+	}
+
+	for _, ace := range aces {
+		log.Debugf("%s", ace)
+		role := r.toRole(ace)
+		rmap[role] = append(rmap[role], ace.Principal())
+	}
+
+	return rmap, nil
+}
+
+// setRoles sets user roles on the given path.
+func (r posixACLRoler) setRoles(pinfo ufp.FilePathMode, roles RoleMap, recursive bool) (RoleMap, error) {
+
+	// make pinfo.Path "clean"
+	pinfo.Path = filepath.Clean(pinfo.Path)
+
+	// recursion
+	recursive = recursive && pinfo.Mode.IsDir()
+
+	// compose the ACEs to be added or modified
+	aces := []PosixACE{}
+	noManagers := []string{}
+	noWriters := []string{}
+	for role, users := range roles {
+		perm := ""
+		switch role {
+		case Manager:
+			noWriters = append(noWriters, users...)
+			perm = "rwX"
+		case Contributor:
+			noManagers = append(noManagers, users...)
+			noWriters = append(noWriters, users...)
+			perm = "rwX"
+		case Writer:
+			// approximated by the contributor permission, see `CephFsRoler`.
+			noManagers = append(noManagers, users...)
+			perm = "rwX"
+		case Viewer:
+			noManagers = append(noManagers, users...)
+			noWriters = append(noWriters, users...)
+			perm = "r-X"
+		case Traverse:
+			noManagers = append(noManagers, users...)
+			noWriters = append(noWriters, users...)
+			// traverse role is only applicable to directories, and is not inherited.
+			if pinfo.Mode.IsDir() {
+				for _, u := range users {
+					aces = append(aces, newPosixACE(u, "--X", false))
+				}
+			}
+			continue
+		default:
+			noManagers = append(noManagers, users...)
+			noWriters = append(noWriters, users...)
+			continue
+		}
+		for _, u := range users {
+			aces = append(aces, newPosixACE(u, perm, false))
+			if pinfo.Mode.IsDir() {
+				aces = append(aces, newPosixACE(u, perm, true))
+			}
+		}
+	}
+
+	if len(aces) == 0 {
+		log.Debugf("no ACE to set, skip setting acl.")
+		return r.getRoles(pinfo)
+	}
+
+	log.Debugf("set ACEs: %+v", aces)
+
+	if err := r.setACEs(pinfo.Path, aces, false, recursive); err != nil {
+		return nil, err
+	}
+
+	// register the newly added managers and writers.
+	setListed(pinfo.Path, r.fattrManagers, roles[Manager])
+	setListed(pinfo.Path, r.fattrWriters, roles[Writer])
+	// unregister managers and writers in case they are changed to other roles.
+	delListed(pinfo.Path, r.fattrManagers, noManagers)
+	delListed(pinfo.Path, r.fattrWriters, noWriters)
+
+	return r.getRoles(pinfo)
+}
+
+// delRoles removes users from the specified roles on the given path.
+func (r posixACLRoler) delRoles(pinfo ufp.FilePathMode, roles RoleMap, recursive bool) (RoleMap, error) {
+
+	// make pinfo.Path "clean"
+	pinfo.Path = filepath.Clean(pinfo.Path)
+
+	// recursion
+	recursive = recursive && pinfo.Mode.IsDir()
+
+	// compose the ACEs to be removed
+	aces := []PosixACE{}
+	noManagers := []string{}
+	for _, users := range roles {
+		log.Debugf("%+v", users)
+		noManagers = append(noManagers, users...)
+		for _, u := range users {
+			aces = append(aces, newPosixACE(u, "", false), newPosixACE(u, "", true))
+		}
+	}
+	if len(aces) == 0 {
+		log.Debugf("no ACE to remove, skip setting acl.")
+		return r.getRoles(pinfo)
+	}
+
+	log.Debugf("remove ACEs: %+v", aces)
+
+	if err := r.setACEs(pinfo.Path, aces, true, recursive); err != nil {
+		return nil, err
+	}
+
+	// unregister the removed users from the managers and writers.
+	delListed(pinfo.Path, r.fattrManagers, noManagers)
+	delListed(pinfo.Path, r.fattrWriters, noManagers)
+
+	return r.getRoles(pinfo)
+}
+
+// setListed sets list of `users` into the file attribute `fattr` (e.g. `fattrManagers`
+// or `fattrWriters`) of the `path`.
+func setListed(path, fattr string, users []string) {
+
+	if len(users) == 0 {
+		return
+	}
+
+	// get users already in the file attribute.
+	d, err := xattr.Get(path, fattr)
+	if err != nil {
+		// use debugf since it is fine that files/sub-directories do not have
+		// the file attribute.
+		log.Debugf("cannot get %s list of %s: %s", fattr, path, err)
+	}
+	m := strings.Split(string(d), ",")
+
+	// construct a new list of users to be set on this path.
+	// Note: if the user is already listed on the parent path, it will not
+	// be added to the list of this path.
+	for _, u := range users {
+		if !isListed(path, fattr, u) {
+			m = append(m, u)
+		}
+	}
+
+	// set file attribute with the new list of users
+	if err := xattr.Set(path, fattr, []byte(strings.Join(m, ","))); err != nil {
+		log.Errorf("cannot set %s list of %s: %s", fattr, path, err)
+	}
+
+	return
+}
+
+// delListed removes list of `users` from the file attribute `fattr` (e.g. `fattrManagers`
+// or `fattrWriters`) of the `path` and its parents.
+func delListed(path, fattr string, users []string) {
+
+	if len(users) == 0 {
+		return
+	}
+
+	// get users in the file attribute.
+	d, err := xattr.Get(path, fattr)
+	if err != nil {
+		// use debugf since it is fine that files/sub-directories do not have
+		// the file attribute.
+		log.Debugf("cannot get %s list of %s: %s", fattr, path, err)
+	}
+
+	m := make(map[string]bool)
+	for _, u := range strings.Split(string(d), ",") {
+		m[u] = true
+	}
+
+	// construct a new list of users to be applied on this path
+	for _, u := range users {
+		if _, ok := m[u]; ok { // user to be deleted is found in the current list
+			delete(m, u)
+		}
+	}
+	nm := make([]string, 0, len(m))
+	for u := range m {
+		nm = append(nm, u)
+	}
+
+	// set file attribute with the new list of users
+	if err := xattr.Set(path, fattr, []byte(strings.Join(nm, ","))); err != nil {
+		log.Errorf("cannot set %s list of %s: %s", fattr, path, err)
+	}
+
+	// move to parent directory
+	path = filepath.Dir(path)
+
+	// path reaches one of the root directories in which projects
+	// are organized.
+	if _, ok := RolerMap[path]; ok {
+		return
+	}
+
+	// path reaches the absolute or relative root.
+	if path == "/" || path == "." || path == ".." {
+		return
+	}
+
+	// delete users from the parent.
+	delListed(path, fattr, users)
+
+	return
+}
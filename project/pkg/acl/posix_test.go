@@ -0,0 +1,82 @@
+package acl
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/pkg/xattr"
+
+	ufp "github.com/Donders-Institute/tg-toolset-golang/pkg/filepath"
+)
+
+// TestPosixRoler sets, gets and removes roles on a scratch directory with the PosixRoler.
+// It is skipped if the filesystem does not support POSIX ACL or user file attributes.
+func TestPosixRoler(t *testing.T) {
+	dir, err := ioutil.TempDir(os.Getenv("TG_TOOLSET_SCRATCH"), "posixroler")
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	acl, err := getPosixACL(dir, false)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if err := setPosixACL(dir, acl, false); err != nil {
+		if e, ok := err.(*xattr.Error); ok && e.Err == syscall.EOPNOTSUPP {
+			t.Skipf("posix acl not supported: %s", dir)
+		}
+		t.Fatalf("%s", err)
+	}
+	if err := xattr.Set(dir, fattrUserManagers, []byte("")); err != nil {
+		t.Skipf("file attribute %s not supported: %s", fattrUserManagers, err)
+	}
+
+	// stop looking up the file attributes at the parent of the scratch directory.
+	base := filepath.Dir(dir)
+	RolerMap[base] = PosixRoler{}
+	defer delete(RolerMap, base)
+
+	pinfo, err := ufp.GetFilePathMode(dir)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	roler := GetRoler(*pinfo)
+	if _, ok := roler.(PosixRoler); !ok {
+		t.Fatalf("expect PosixRoler but got %T", roler)
+	}
+
+	roles, err := roler.SetRoles(*pinfo, RoleMap{Manager: {"nobody"}}, true, false)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if us := roles[Manager]; len(us) != 1 || us[0] != "nobody" {
+		t.Errorf("expect manager nobody but got %v", roles)
+	}
+
+	// changing the manager to viewer unregisters the manager.
+	roles, err = roler.SetRoles(*pinfo, RoleMap{Viewer: {"nobody"}}, true, false)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if us := roles[Viewer]; len(us) != 1 || us[0] != "nobody" || len(roles[Manager]) != 0 {
+		t.Errorf("expect viewer nobody but got %v", roles)
+	}
+
+	// the failure of setting the ACL is returned.
+	if _, err := roler.SetRoles(*pinfo, RoleMap{Viewer: {"no-such-user-123"}}, true, false); err == nil {
+		t.Errorf("expect error on setting role of unknown user")
+	}
+
+	roles, err = roler.DelRoles(*pinfo, RoleMap{Viewer: {"nobody"}}, true, false)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if len(roles[Viewer]) != 0 {
+		t.Errorf("expect no viewer but got %v", roles)
+	}
+}
@@ -0,0 +1,348 @@
+package acl
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"os/user"
+	"sort"
+	"strconv"
+
+	"github.com/pkg/xattr"
+)
+
+// extended attributes in which the Linux kernel stores the POSIX ACLs of a
+// file or directory.
+const (
+	xattrPosixACLAccess  string = "system.posix_acl_access"
+	xattrPosixACLDefault string = "system.posix_acl_default"
+)
+
+// posixACLVersion is the version of the extended attribute representation
+// of the POSIX ACL.
+const posixACLVersion uint32 = 2
+
+// posixACLUndefinedID is the qualifier of entries without a user or group id.
+const posixACLUndefinedID uint32 = 0xffffffff
+
+// POSIX ACL entry tags.
+const (
+	posixACLUserObj  uint16 = 0x01
+	posixACLUser     uint16 = 0x02
+	posixACLGroupObj uint16 = 0x04
+	posixACLGroup    uint16 = 0x08
+	posixACLMask     uint16 = 0x10
+	posixACLOther    uint16 = 0x20
+)
+
+// posixACLTagNames maps the POSIX ACL entry tags into the tag names used by
+// the `getfacl` output and the `PosixACE`.
+var posixACLTagNames = map[uint16]string{
+	posixACLUserObj:  "user",
+	posixACLUser:     "user",
+	posixACLGroupObj: "group",
+	posixACLGroup:    "group",
+	posixACLMask:     "mask",
+	posixACLOther:    "other",
+}
+
+// posixACLEntry is an entry of the extended attribute representation of the POSIX ACL.
+type posixACLEntry struct {
+	Tag  uint16
+	Perm uint16
+	ID   uint32
+}
+
+// posixACL is a list of POSIX ACL entries.
+type posixACL []posixACLEntry
+
+// encodePosixACL encodes the POSIX ACL into the representation of the extended attribute.
+// The entries are sorted by tag and id as required by the kernel.
+func encodePosixACL(acl posixACL) []byte {
+	acl.sort()
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, posixACLVersion)
+	binary.Write(&buf, binary.LittleEndian, []posixACLEntry(acl))
+	return buf.Bytes()
+}
+
+// decodePosixACL decodes the representation of the extended attribute into the POSIX ACL.
+func decodePosixACL(data []byte) (posixACL, error) {
+	if len(data) < 4 || (len(data)-4)%8 != 0 {
+		return nil, fmt.Errorf("invalid posix acl size: %d", len(data))
+	}
+
+	r := bytes.NewReader(data)
+
+	var version uint32
+	binary.Read(r, binary.LittleEndian, &version)
+	if version != posixACLVersion {
+		return nil, fmt.Errorf("unsupported posix acl version: %d", version)
+	}
+
+	acl := make(posixACL, (len(data)-4)/8)
+	if err := binary.Read(r, binary.LittleEndian, []posixACLEntry(acl)); err != nil {
+		return nil, err
+	}
+
+	for _, e := range acl {
+		if _, ok := posixACLTagNames[e.Tag]; !ok {
+			return nil, fmt.Errorf("invalid posix acl tag: 0x%x", e.Tag)
+		}
+	}
+
+	return acl, nil
+}
+
+// sort sorts the entries by tag and id.
+func (acl posixACL) sort() {
+	sort.Slice(acl, func(i, j int) bool {
+		if acl[i].Tag != acl[j].Tag {
+			return acl[i].Tag < acl[j].Tag
+		}
+		return acl[i].ID < acl[j].ID
+	})
+}
+
+// find returns the index of the entry with the given tag and id, or -1 if the entry is not found.
+func (acl posixACL) find(tag uint16, id uint32) int {
+	for i, e := range acl {
+		if e.Tag == tag && e.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// set adds or replaces the entry with the given tag and id.
+func (acl *posixACL) set(tag uint16, id uint32, perm uint16) {
+	if i := acl.find(tag, id); i >= 0 {
+		(*acl)[i].Perm = perm
+		return
+	}
+	*acl = append(*acl, posixACLEntry{Tag: tag, Perm: perm, ID: id})
+}
+
+// remove removes the entry with the given tag and id.
+func (acl *posixACL) remove(tag uint16, id uint32) {
+	if i := acl.find(tag, id); i >= 0 {
+		*acl = append((*acl)[:i], (*acl)[i+1:]...)
+	}
+}
+
+// hasNamedEntries checks if the ACL contains entries of named users or groups.
+func (acl posixACL) hasNamedEntries() bool {
+	for _, e := range acl {
+		if e.Tag == posixACLUser || e.Tag == posixACLGroup {
+			return true
+		}
+	}
+	return false
+}
+
+// ensureMask adds the mask entry if the ACL contains named entries but no mask.
+// The mask is calculated as the union of the permissions in the group class.
+// An existing mask is never recalculated.
+func (acl *posixACL) ensureMask() {
+	if !acl.hasNamedEntries() || acl.find(posixACLMask, posixACLUndefinedID) >= 0 {
+		return
+	}
+	var perm uint16
+	for _, e := range *acl {
+		switch e.Tag {
+		case posixACLUser, posixACLGroupObj, posixACLGroup:
+			perm |= e.Perm
+		}
+	}
+	acl.set(posixACLMask, posixACLUndefinedID, perm)
+}
+
+// posixACLFromMode constructs the minimal POSIX ACL equivalent to the permission bits.
+func posixACLFromMode(mode os.FileMode) posixACL {
+	return posixACL{
+		{Tag: posixACLUserObj, Perm: uint16(mode>>6) & 7, ID: posixACLUndefinedID},
+		{Tag: posixACLGroupObj, Perm: uint16(mode>>3) & 7, ID: posixACLUndefinedID},
+		{Tag: posixACLOther, Perm: uint16(mode) & 7, ID: posixACLUndefinedID},
+	}
+}
+
+// getPosixACL reads the access ACL (`dflt` is false) or the default ACL (`dflt` is true)
+// of the given path from the extended attribute.
+//
+// For a path without access ACL, the ACL is constructed from the permission bits.  For a
+// path without default ACL, an empty ACL is returned.
+func getPosixACL(path string, dflt bool) (posixACL, error) {
+	name := xattrPosixACLAccess
+	if dflt {
+		name = xattrPosixACLDefault
+	}
+
+	data, err := xattr.Get(path, name)
+	if e, ok := err.(*xattr.Error); ok && e.Err == xattr.ENOATTR {
+		if dflt {
+			return posixACL{}, nil
+		}
+		fi, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		return posixACLFromMode(fi.Mode()), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return decodePosixACL(data)
+}
+
+// setPosixACL writes the access ACL (`dflt` is false) or the default ACL (`dflt` is true)
+// to the extended attribute of the given path.
+func setPosixACL(path string, acl posixACL, dflt bool) error {
+	name := xattrPosixACLAccess
+	if dflt {
+		name = xattrPosixACLDefault
+	}
+	return xattr.Set(path, name, encodePosixACL(acl))
+}
+
+// parsePosixPerm converts the permission string (e.g. `rwX`) into the permission bits.
+// The `X` permission is resolved into execute permission if `exec` is true.
+func parsePosixPerm(perm string, exec bool) (uint16, error) {
+	var bits uint16
+	for _, c := range perm {
+		switch c {
+		case 'r':
+			bits |= 4
+		case 'w':
+			bits |= 2
+		case 'x':
+			bits |= 1
+		case 'X':
+			if exec {
+				bits |= 1
+			}
+		case '-':
+		default:
+			return 0, fmt.Errorf("invalid permission: %s", perm)
+		}
+	}
+	return bits, nil
+}
+
+// posixPermString converts the permission bits into the permission string (e.g. `rw-`).
+func posixPermString(bits uint16) string {
+	perm := []byte("---")
+	for i, c := range []byte("rwx") {
+		if bits&(4>>uint(i)) != 0 {
+			perm[i] = c
+		}
+	}
+	return string(perm)
+}
+
+// lookupPosixID resolves the user (or group if `group` is true) name into the numerical id.
+// As in `setfacl`, a name that cannot be resolved is taken as the numerical id if it is a number.
+func lookupPosixID(name string, group bool) (uint32, error) {
+	var id string
+	if group {
+		g, err := user.LookupGroup(name)
+		if err != nil {
+			return parsePosixID(name, err)
+		}
+		id = g.Gid
+	} else {
+		u, err := user.Lookup(name)
+		if err != nil {
+			return parsePosixID(name, err)
+		}
+		id = u.Uid
+	}
+	n, err := strconv.ParseUint(id, 10, 32)
+	return uint32(n), err
+}
+
+// parsePosixID parses the numerical id of a user or group that cannot be resolved by name.
+// The lookup error `lerr` is returned if `name` is not a number.
+func parsePosixID(name string, lerr error) (uint32, error) {
+	n, err := strconv.ParseUint(name, 10, 32)
+	if err != nil {
+		return 0, lerr
+	}
+	return uint32(n), nil
+}
+
+// lookupPosixName resolves the numerical user (or group if `group` is true) id into the name.
+// As in `getfacl`, the id is returned as a number if it cannot be resolved.
+func lookupPosixName(id uint32, group bool) string {
+	sid := strconv.FormatUint(uint64(id), 10)
+	if group {
+		g, err := user.LookupGroupId(sid)
+		if err != nil {
+			return sid
+		}
+		return g.Name
+	}
+	u, err := user.LookupId(sid)
+	if err != nil {
+		return sid
+	}
+	return u.Username
+}
+
+// posixEntryFromACE converts the PosixACE into the POSIX ACL entry.
+// The `X` permission is resolved into execute permission if `exec` is true.
+func posixEntryFromACE(ace PosixACE, exec bool) (posixACLEntry, error) {
+	perm, err := parsePosixPerm(ace.Permission, exec)
+	if err != nil {
+		return posixACLEntry{}, err
+	}
+
+	e := posixACLEntry{Perm: perm, ID: posixACLUndefinedID}
+
+	switch ace.Tag {
+	case "user", "u":
+		e.Tag = posixACLUserObj
+		if ace.Qualifier != "" {
+			e.Tag = posixACLUser
+			if e.ID, err = lookupPosixID(ace.Qualifier, false); err != nil {
+				return e, err
+			}
+		}
+	case "group", "g":
+		e.Tag = posixACLGroupObj
+		if ace.Qualifier != "" {
+			e.Tag = posixACLGroup
+			if e.ID, err = lookupPosixID(ace.Qualifier, true); err != nil {
+				return e, err
+			}
+		}
+	case "mask", "m":
+		e.Tag = posixACLMask
+	case "other", "o":
+		e.Tag = posixACLOther
+	default:
+		return e, fmt.Errorf("invalid tag: %s", ace.Tag)
+	}
+
+	return e, nil
+}
+
+// posixACEFromEntry converts the POSIX ACL entry into the PosixACE.  The qualifier
+// of the named user or group is resolved into the name.
+func posixACEFromEntry(e posixACLEntry, path string) PosixACE {
+	ace := PosixACE{
+		Tag:        posixACLTagNames[e.Tag],
+		Permission: posixPermString(e.Perm),
+		path:       path,
+	}
+
+	switch e.Tag {
+	case posixACLUser:
+		ace.Qualifier = lookupPosixName(e.ID, false)
+	case posixACLGroup:
+		ace.Qualifier = lookupPosixName(e.ID, true)
+	}
+
+	return ace
+}
@@ -0,0 +1,241 @@
+package acl
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"syscall"
+	"testing"
+
+	"github.com/pkg/xattr"
+)
+
+func TestPosixACLCodec(t *testing.T) {
+	acl := posixACL{
+		{Tag: posixACLOther, Perm: 5, ID: posixACLUndefinedID},
+		{Tag: posixACLUser, Perm: 7, ID: 1001},
+		{Tag: posixACLUserObj, Perm: 7, ID: posixACLUndefinedID},
+		{Tag: posixACLMask, Perm: 7, ID: posixACLUndefinedID},
+		{Tag: posixACLGroupObj, Perm: 5, ID: posixACLUndefinedID},
+		{Tag: posixACLUser, Perm: 5, ID: 1000},
+	}
+
+	data := encodePosixACL(acl)
+
+	expected := []byte{
+		2, 0, 0, 0, // version
+		0x01, 0, 7, 0, 0xff, 0xff, 0xff, 0xff, // user::rwx
+		0x02, 0, 5, 0, 0xe8, 0x03, 0, 0, // user:1000:r-x
+		0x02, 0, 7, 0, 0xe9, 0x03, 0, 0, // user:1001:rwx
+		0x04, 0, 5, 0, 0xff, 0xff, 0xff, 0xff, // group::r-x
+		0x10, 0, 7, 0, 0xff, 0xff, 0xff, 0xff, // mask::rwx
+		0x20, 0, 5, 0, 0xff, 0xff, 0xff, 0xff, // other::r-x
+	}
+	if !bytes.Equal(data, expected) {
+		t.Errorf("expect %v but got %v", expected, data)
+	}
+
+	aclOut, err := decodePosixACL(data)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if !reflect.DeepEqual(acl, aclOut) {
+		t.Errorf("expect %+v but got %+v", acl, aclOut)
+	}
+
+	if _, err := decodePosixACL(data[:len(data)-1]); err == nil {
+		t.Errorf("expect error on truncated data")
+	}
+	if _, err := decodePosixACL([]byte{1, 0, 0, 0}); err == nil {
+		t.Errorf("expect error on unsupported version")
+	}
+}
+
+func TestPosixACLMask(t *testing.T) {
+	acl := posixACLFromMode(0750)
+	acl.ensureMask()
+	if acl.find(posixACLMask, posixACLUndefinedID) >= 0 {
+		t.Errorf("unexpected mask without named entries: %+v", acl)
+	}
+
+	acl.set(posixACLUser, 1000, 6)
+	acl.ensureMask()
+	if i := acl.find(posixACLMask, posixACLUndefinedID); i < 0 || acl[i].Perm != 7 {
+		t.Errorf("unexpected mask: %+v", acl)
+	}
+
+	// existing mask is not recalculated
+	acl.remove(posixACLUser, 1000)
+	acl.set(posixACLUser, 1001, 4)
+	acl.ensureMask()
+	if i := acl.find(posixACLMask, posixACLUndefinedID); i < 0 || acl[i].Perm != 7 {
+		t.Errorf("unexpected mask: %+v", acl)
+	}
+}
+
+func TestPosixPerm(t *testing.T) {
+	for perm, bits := range map[string]uint16{"rwX": 6, "r-x": 5, "--X": 0, "rw-": 6} {
+		if b, _ := parsePosixPerm(perm, false); b != bits {
+			t.Errorf("expect %d for %s but got %d", bits, perm, b)
+		}
+	}
+	if b, _ := parsePosixPerm("rwX", true); b != 7 {
+		t.Errorf("expect %d for %s but got %d", 7, "rwX", b)
+	}
+	if _, err := parsePosixPerm("rwz", true); err == nil {
+		t.Errorf("expect error on invalid permission")
+	}
+	if s := posixPermString(5); s != "r-x" {
+		t.Errorf("expect %s but got %s", "r-x", s)
+	}
+}
+
+// TestPosixACLScratchDir sets and removes ACEs on a scratch directory.  The scratch
+// directory is created in the directory specified by the environment variable
+// `TG_TOOLSET_SCRATCH`, or the system's temporary directory.  It is skipped if
+// the filesystem does not support the POSIX ACL.
+func TestPosixUnknownID(t *testing.T) {
+	// an id that doesn't resolve into any user or group.
+	e := posixACLEntry{Tag: posixACLUser, Perm: 5, ID: 4000123}
+
+	ace := posixACEFromEntry(e, "")
+	if ace.Qualifier != "4000123" {
+		t.Errorf("expect numerical qualifier but got %s", ace.Qualifier)
+	}
+
+	eOut, err := posixEntryFromACE(ace, false)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if !reflect.DeepEqual(eOut, e) {
+		t.Errorf("expect %+v but got %+v", e, eOut)
+	}
+
+	if _, err := lookupPosixID("no-such-user-123", false); err == nil {
+		t.Errorf("expect error on unknown user")
+	}
+}
+
+func TestPosixACLScratchDir(t *testing.T) {
+	dir, err := ioutil.TempDir(os.Getenv("TG_TOOLSET_SCRATCH"), "posixacl")
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// check ACL support of the filesystem
+	acl, err := getPosixACL(dir, false)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if err := setPosixACL(dir, acl, false); err != nil {
+		if e, ok := err.(*xattr.Error); ok && e.Err == syscall.EOPNOTSUPP {
+			t.Skipf("posix acl not supported: %s", dir)
+		}
+		t.Fatalf("%s", err)
+	}
+
+	aces := []PosixACE{
+		{Tag: "user", Qualifier: "nobody", Permission: "r-X"},
+		{Tag: "user", Qualifier: "nobody", Permission: "r-X", Default: true},
+	}
+	if err := updatePosixACL(dir, aces, false); err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	out, mask, err := getPosixACEs(dir)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if len(out) != 1 || out[0].Qualifier != "nobody" || out[0].Permission != "r-x" {
+		t.Errorf("unexpected ACEs: %+v", out)
+	}
+	if mask != "r-x" {
+		t.Errorf("unexpected mask: %s", mask)
+	}
+
+	// new file inherits the default ACL, with the mask derived from the file mode.
+	f := filepath.Join(dir, "test.txt")
+	if err := ioutil.WriteFile(f, []byte("test"), 0644); err != nil {
+		t.Fatalf("%s", err)
+	}
+	out, mask, _ = getPosixACEs(f)
+	if len(out) != 1 || out[0].Qualifier != "nobody" || out[0].Permission != "r-x" {
+		t.Errorf("unexpected inherited ACEs: %+v", out)
+	}
+	if mask != "r--" {
+		t.Errorf("unexpected inherited mask: %s", mask)
+	}
+
+	if err := updatePosixACL(dir, aces, true); err != nil {
+		t.Fatalf("%s", err)
+	}
+	out, _, _ = getPosixACEs(dir)
+	if len(out) != 0 {
+		t.Errorf("unexpected ACEs after removal: %+v", out)
+	}
+	dacl, _ := getPosixACL(dir, true)
+	if dacl.hasNamedEntries() {
+		t.Errorf("unexpected default ACL after removal: %+v", dacl)
+	}
+}
+
+func TestNewPosixACE(t *testing.T) {
+	ace := newPosixACE(GroupPrincipal("geeks"), "rwX", true)
+	if ace.Tag != "group" || ace.Qualifier != "geeks" || !ace.Default {
+		t.Errorf("unexpected group ACE: %+v", ace)
+	}
+	if p := ace.Principal(); p != "g:geeks" {
+		t.Errorf("expect principal g:geeks but got %s", p)
+	}
+
+	ace = newPosixACE("honlee", "r-X", false)
+	if ace.Tag != "user" || ace.Qualifier != "honlee" || ace.Principal() != "honlee" {
+		t.Errorf("unexpected user ACE: %+v", ace)
+	}
+}
+
+// TestPosixACEWriter resolves the writer role from the `trusted.writers` file attribute
+// of a scratch directory.  It is skipped if the filesystem does not support the attribute.
+func TestPosixACEWriter(t *testing.T) {
+	dir, err := ioutil.TempDir(os.Getenv("TG_TOOLSET_SCRATCH"), "posixacl")
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := xattr.Set(dir, fattrWriters, []byte("edwger")); err != nil {
+		t.Skipf("file attribute %s not supported: %s", fattrWriters, err)
+	}
+
+	// stop looking up the file attribute at the parent of the scratch directory.
+	base := filepath.Dir(dir)
+	RolerMap[base] = CephFsRoler{}
+	defer delete(RolerMap, base)
+
+	sub := filepath.Join(dir, "sub")
+	if err := os.Mkdir(sub, 0755); err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	ace := newPosixACE("edwger", "rwx", false)
+	ace.path = sub
+	if r := ace.ToRole(); r != Writer {
+		t.Errorf("expect role %s but got %s", Writer, r)
+	}
+
+	ace = newPosixACE("honlee", "rwx", false)
+	ace.path = sub
+	if r := ace.ToRole(); r != Contributor {
+		t.Errorf("expect role %s but got %s", Contributor, r)
+	}
+
+	delListed(sub, fattrWriters, []string{"edwger"})
+	ace = newPosixACE("edwger", "rwx", false)
+	ace.path = sub
+	if r := ace.ToRole(); r != Contributor {
+		t.Errorf("expect role %s after removal but got %s", Contributor, r)
+	}
+}
@@ -0,0 +1,193 @@
+package acl
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	ufp "github.com/Donders-Institute/tg-toolset-golang/pkg/filepath"
+	log "github.com/Donders-Institute/tg-toolset-golang/pkg/logger"
+)
+
+// Progress is a snapshot of the progress of setting or removing roles by the Runner.
+type Progress struct {
+	// Path is the top-level path of the run.
+	Path string `json:"path"`
+	// Elapsed is the time elapsed since the start of the run, in seconds.
+	Elapsed float64 `json:"elapsed"`
+	// Walked is the number of paths found by the walk through the filesystem tree.
+	Walked int64 `json:"walked"`
+	// Processed is the number of paths on which the roles are set or removed, or skipped.
+	Processed int64 `json:"processed"`
+	// Queued is the number of paths found by the walk, and waiting to be processed.
+	Queued int64 `json:"queued"`
+	// DirsPending is the number of directories the walk has entered but not completed.
+	DirsPending int64 `json:"dirsPending"`
+	// Estimated is the estimated total number of paths, derived from the inodes in use on
+	// the filesystem.  It is the number of walked paths once the walk is completed.
+	Estimated int64 `json:"estimated"`
+	// Rate is the number of paths processed per second.
+	Rate float64 `json:"rate"`
+	// ETA is the estimated time to completion, in seconds.  It is -1 if it is unknown.
+	ETA float64 `json:"eta"`
+}
+
+// String returns a single-line representation of the progress.
+func (p Progress) String() string {
+	eta := "unknown"
+	if p.ETA >= 0 {
+		eta = (time.Duration(p.ETA) * time.Second).String()
+	}
+	return fmt.Sprintf("processed %d/~%d paths (%.1f paths/s), walked: %d, queued: %d, directories pending: %d, elapsed: %s, eta: %s",
+		p.Processed, p.Estimated, p.Rate, p.Walked, p.Queued, p.DirsPending,
+		(time.Duration(p.Elapsed) * time.Second).String(), eta)
+}
+
+// progressMeter keeps track of the walk of the Runner for reporting the progress.  The
+// processed paths are counted by the `runCollector`.
+type progressMeter struct {
+	root      string
+	start     time.Time
+	estimated int64
+	walked    int64
+	dirs      int64
+	walkDone  int32
+}
+
+// newProgressMeter starts tracking the progress of a run on the `root`, with the total
+// number of paths estimated by the inodes in use on the filesystem of the `root`.
+func newProgressMeter(root string) *progressMeter {
+	m := &progressMeter{root: filepath.Clean(root), start: time.Now()}
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(root, &st); err == nil && st.Files >= st.Ffree {
+		m.estimated = int64(st.Files - st.Ffree)
+	} else if err != nil {
+		log.Debugf("cannot estimate number of paths in %s: %s", root, err)
+	}
+	return m
+}
+
+// walkOptions returns the walk options `opts` with the walked paths and the pending
+// directories counted by the meter.
+func (m *progressMeter) walkOptions(opts ufp.WalkOptions) ufp.WalkOptions {
+	visit, leave := opts.Visit, opts.Leave
+	opts.Visit = func(p ufp.FilePathMode, dir string) {
+		atomic.AddInt64(&m.walked, 1)
+		if p.Mode.IsDir() {
+			atomic.AddInt64(&m.dirs, 1)
+		}
+		if visit != nil {
+			visit(p, dir)
+		}
+	}
+	opts.Leave = func(dir string) {
+		atomic.AddInt64(&m.dirs, -1)
+		if filepath.Clean(dir) == m.root {
+			atomic.StoreInt32(&m.walkDone, 1)
+		}
+		if leave != nil {
+			leave(dir)
+		}
+	}
+	return opts
+}
+
+// noWalk sets the meter for a run on the top-level path only, without walking through
+// the filesystem tree, e.g. the POSIX ACL applied recursively by the roler.
+func (m *progressMeter) noWalk() {
+	atomic.StoreInt64(&m.walked, 1)
+	atomic.StoreInt32(&m.walkDone, 1)
+}
+
+// get returns the progress with `processed` paths.
+func (m *progressMeter) get(processed int64) Progress {
+	p := Progress{
+		Path:        m.root,
+		Elapsed:     time.Since(m.start).Seconds(),
+		Walked:      atomic.LoadInt64(&m.walked),
+		Processed:   processed,
+		DirsPending: atomic.LoadInt64(&m.dirs),
+		Estimated:   m.estimated,
+		ETA:         -1,
+	}
+
+	if p.Queued = p.Walked - p.Processed; p.Queued < 0 {
+		p.Queued = 0
+	}
+
+	if atomic.LoadInt32(&m.walkDone) == 1 || p.Estimated < p.Walked {
+		p.Estimated = p.Walked
+	}
+	if p.Estimated < p.Processed {
+		p.Estimated = p.Processed
+	}
+
+	if p.Elapsed > 0 {
+		p.Rate = float64(p.Processed) / p.Elapsed
+	}
+	if p.Rate > 0 {
+		p.ETA = float64(p.Estimated-p.Processed) / p.Rate
+	}
+
+	return p
+}
+
+// startProgress reports the progress of the run every `Runner.ProgressInterval`, as JSON
+// lines written to `Runner.ProgressOutput` or as log messages if the output is not set.
+// It returns a function to stop the reporting with a final report.  Nothing is reported
+// if the interval is not set.
+func (r *Runner) startProgress() (stop func()) {
+
+	if r.ProgressInterval <= 0 {
+		return func() {}
+	}
+
+	r.progress = newProgressMeter(r.ppath)
+
+	report := func() {
+		p := r.progress.get(r.collector.processed())
+		if r.ProgressOutput == nil {
+			log.Infof("progress: %s", p)
+			return
+		}
+		if err := writeProgress(r.ProgressOutput, p); err != nil {
+			log.Errorf("cannot write progress: %s", err)
+		}
+	}
+
+	ticker := time.NewTicker(r.ProgressInterval)
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		for {
+			select {
+			case <-ticker.C:
+				report()
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		ticker.Stop()
+		close(done)
+		<-stopped
+		report()
+	}
+}
+
+// writeProgress writes the progress `p` as a JSON line to `w`.
+func writeProgress(w io.Writer, p Progress) error {
+	data, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
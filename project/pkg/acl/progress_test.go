@@ -0,0 +1,46 @@
+package acl
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"testing"
+
+	ufp "github.com/Donders-Institute/tg-toolset-golang/pkg/filepath"
+)
+
+func TestProgressMeter(t *testing.T) {
+	root := makeJournalTestTree(t)
+	defer os.RemoveAll(root)
+
+	m := newProgressMeter(root)
+	if p := m.get(0); p.Walked != 0 || p.ETA != -1 {
+		t.Errorf("unexpected progress before walk: %s", p)
+	}
+
+	n := int64(0)
+	for range ufp.GoFastWalkWithOptions(root, m.walkOptions(ufp.WalkOptions{}), 4) {
+		n++
+	}
+
+	p := m.get(3)
+	if p.Walked != n || p.Processed != 3 || p.Queued != n-3 || p.DirsPending != 0 {
+		t.Errorf("unexpected progress: %s", p)
+	}
+	// the estimated total is the number of walked paths once the walk is completed.
+	if p.Estimated != n {
+		t.Errorf("expect estimated %d but got %d", n, p.Estimated)
+	}
+
+	var buf bytes.Buffer
+	if err := writeProgress(&buf, p); err != nil {
+		t.Fatal(err)
+	}
+	var out Progress
+	if err := json.Unmarshal(buf.Bytes(), &out); err != nil {
+		t.Fatal(err)
+	}
+	if out.Path != root || out.Walked != n || out.Processed != 3 {
+		t.Errorf("unexpected progress line: %s", buf.String())
+	}
+}
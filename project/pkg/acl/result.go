@@ -0,0 +1,182 @@
+package acl
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	ufp "github.com/Donders-Institute/tg-toolset-golang/pkg/filepath"
+	log "github.com/Donders-Institute/tg-toolset-golang/pkg/logger"
+)
+
+// PathError is the error of setting or removing the roles on a path.
+type PathError struct {
+	Path  string
+	Roles RoleMap
+	Err   error
+}
+
+// Error implements the error interface.
+func (e PathError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Err, e.Path)
+}
+
+// RunResult is the result of setting or removing roles by the Runner.  The paths include
+// the parent directories on which the traverse role is set or removed.
+type RunResult struct {
+	// Visited is the number of paths visited.
+	Visited int
+	// Changed is the number of paths on which the roles are set or removed.
+	Changed int
+	// Skipped is the number of paths left untouched, either because there is nothing to
+	// do, the roler is not found, or the run is cancelled.
+	Skipped int
+	// Failed is the number of paths on which the roles cannot be set or removed, after
+	// the retries.
+	Failed int
+	// Retried is the number of retries on the failed paths.
+	Retried int
+	// Errors are the errors of the failed paths.
+	Errors []PathError
+}
+
+// String returns a single-line representation of the result.
+func (res RunResult) String() string {
+	return fmt.Sprintf("paths visited: %d, changed: %d, skipped: %d, failed: %d, retried: %d", res.Visited, res.Changed, res.Skipped, res.Failed, res.Retried)
+}
+
+// ExitCode maps the result to the exit code of the CLIs: 0 if the roles are set or removed
+// on all paths, 2 if failed on any of the paths.
+func (res RunResult) ExitCode() int {
+	if res.Failed > 0 {
+		return 2
+	}
+	return 0
+}
+
+// runCollector collects the RunResult from the concurrent workers of the Runner.  It also
+// keeps the failed paths for retrying.
+type runCollector struct {
+	mutex    sync.Mutex
+	result   RunResult
+	failures []pathFailure
+}
+
+// pathFailure is a path on which the roles failed to be set or removed.
+type pathFailure struct {
+	path  ufp.FilePathMode
+	roles RoleMap
+	err   error
+}
+
+// visit counts a visited path and its outcome of setting or removing the `roles`: changed
+// if `err` is nil, failed otherwise.
+func (c *runCollector) visit(p ufp.FilePathMode, roles RoleMap, err error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.result.Visited++
+	c.count(p, roles, err)
+}
+
+// retry counts the outcome of a retry on a failed path, which is taken out from the
+// collector by `takeFailures`.
+func (c *runCollector) retry(p ufp.FilePathMode, roles RoleMap, err error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.result.Retried++
+	c.count(p, roles, err)
+}
+
+// count counts the path as changed if `err` is nil, or keeps it as a failure otherwise.
+func (c *runCollector) count(p ufp.FilePathMode, roles RoleMap, err error) {
+	if err != nil {
+		c.failures = append(c.failures, pathFailure{path: p, roles: roles, err: err})
+		return
+	}
+	c.result.Changed++
+}
+
+// skip counts a visited path that is left untouched.
+func (c *runCollector) skip() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.result.Visited++
+	c.result.Skipped++
+}
+
+// processed returns the number of visited paths.
+func (c *runCollector) processed() int64 {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return int64(c.result.Visited)
+}
+
+// takeFailures takes the failed paths out from the collector for retrying.
+func (c *runCollector) takeFailures() []pathFailure {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	failures := c.failures
+	c.failures = nil
+	return failures
+}
+
+// putFailures puts the failed paths back into the collector, e.g. when the retry is
+// cancelled.
+func (c *runCollector) putFailures(failures []pathFailure) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.failures = append(c.failures, failures...)
+}
+
+// get returns a copy of the collected result, with the errors of the failed paths.
+func (c *runCollector) get() RunResult {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	res := c.result
+	res.Failed = len(c.failures)
+	res.Errors = make([]PathError, 0, len(c.failures))
+	for _, f := range c.failures {
+		res.Errors = append(res.Errors, PathError{Path: f.path.Path, Roles: f.roles, Err: f.err})
+	}
+	return res
+}
+
+// runWithSignals calls the context-aware `run` function with a context cancelled upon
+// the `signalHandled`, and maps the result to the exit code.  If the run is stopped by
+// a signal, the exit code is the signal number.
+func runWithSignals(run func(ctx context.Context) (RunResult, error)) (exitcode int, err error) {
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	chanS := make(chan os.Signal, 1)
+	signal.Notify(chanS, signalHandled...)
+	defer signal.Stop(chanS)
+
+	var sig os.Signal
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		select {
+		case sig = <-chanS:
+			log.Warnf("Stopping due to received signal: %s", sig)
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	res, err := run(ctx)
+	cancel()
+	<-stopped
+
+	if sig != nil {
+		return int(sig.(syscall.Signal)), nil
+	}
+	if err != nil {
+		return 1, err
+	}
+	return res.ExitCode(), nil
+}
@@ -0,0 +1,109 @@
+package acl
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	ufp "github.com/Donders-Institute/tg-toolset-golang/pkg/filepath"
+)
+
+func TestRunCollector(t *testing.T) {
+	c := &runCollector{}
+	roles := RoleMap{Viewer: {"nobody"}}
+	c.visit(ufp.FilePathMode{Path: "/a"}, roles, nil)
+	c.visit(ufp.FilePathMode{Path: "/b"}, roles, fmt.Errorf("permission denied"))
+	c.visit(ufp.FilePathMode{Path: "/c"}, roles, fmt.Errorf("permission denied"))
+	c.skip()
+
+	res := c.get()
+	if res.Visited != 4 || res.Changed != 1 || res.Failed != 2 || res.Skipped != 1 {
+		t.Errorf("unexpected result: %s", res)
+	}
+	if len(res.Errors) != 2 || res.Errors[0].Error() != "permission denied: /b" {
+		t.Errorf("unexpected errors: %v", res.Errors)
+	}
+	if ec := res.ExitCode(); ec != 2 {
+		t.Errorf("expect exit code 2 but got %d", ec)
+	}
+
+	// a failed path succeeded in the retry is counted as changed.
+	failures := c.takeFailures()
+	c.retry(failures[0].path, failures[0].roles, nil)
+	c.retry(failures[1].path, failures[1].roles, fmt.Errorf("no such user"))
+	res = c.get()
+	if res.Visited != 4 || res.Changed != 2 || res.Failed != 1 || res.Retried != 2 {
+		t.Errorf("unexpected result after retry: %s", res)
+	}
+	if len(res.Errors) != 1 || res.Errors[0].Path != "/c" || res.Errors[0].Roles[Viewer][0] != "nobody" {
+		t.Errorf("unexpected errors after retry: %v", res.Errors)
+	}
+	if ec := (RunResult{Visited: 1, Changed: 1}).ExitCode(); ec != 0 {
+		t.Errorf("expect exit code 0 but got %d", ec)
+	}
+}
+
+func TestWalkWithContext(t *testing.T) {
+	root := makeJournalTestTree(t)
+	defer os.RemoveAll(root)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// the sub-directories are not walked into once the ctx is cancelled.
+	for p := range ufp.GoFastWalkWithOptions(root, withContext(ctx, ufp.WalkOptions{}), 4) {
+		if rel, _ := filepath.Rel(root, p.Path); rel != "." && filepath.Dir(rel) != "." {
+			t.Errorf("unexpected path walked after cancellation: %s", p.Path)
+		}
+	}
+}
+
+// TestRunnerSetRolesContext sets roles on a scratch directory with the PosixRoler, and
+// checks the result of the run.  It is skipped if the PosixRoler is not supported.
+func TestRunnerSetRolesContext(t *testing.T) {
+	root := makeJournalTestTree(t)
+	defer os.RemoveAll(root)
+
+	base := filepath.Dir(root)
+	RolerMap[base] = PosixRoler{}
+	defer delete(RolerMap, base)
+
+	if err := setPlainPosixACEs(root, []PosixACE{newPosixACE("nobody", "r-X", false)}, false, false); err != nil {
+		t.Skipf("posix acl not supported: %s", err)
+	}
+
+	r := Runner{RootPath: root, Viewers: "nobody", Nthreads: 2, Silence: true}
+
+	// nothing is done with a cancelled ctx.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	r.Force = true
+	res, err := r.SetRolesContext(ctx)
+	if err != context.Canceled {
+		t.Errorf("expect error %s but got %v", context.Canceled, err)
+	}
+	if res.Changed != 0 {
+		t.Errorf("unexpected result after cancellation: %s", res)
+	}
+
+	r.Force = false
+	r.Contributors, r.Viewers = "nobody", ""
+	res, err = r.SetRolesContext(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Visited != 1 || res.Changed != 1 || res.Failed != 0 {
+		t.Errorf("unexpected result: %s", res)
+	}
+
+	// roles in place, the path is skipped.
+	res, err = r.SetRolesContext(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Visited != 1 || res.Skipped != 1 {
+		t.Errorf("unexpected result: %s", res)
+	}
+}
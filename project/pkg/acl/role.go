@@ -3,9 +3,12 @@
 package acl
 
 import (
+	"fmt"
 	"os"
+	"path/filepath"
 	"strings"
 
+	"github.com/Donders-Institute/tg-toolset-golang/pkg/config"
 	ufp "github.com/Donders-Institute/tg-toolset-golang/pkg/filepath"
 )
 
@@ -49,15 +52,59 @@ func (r Role) String() string {
 	return roleStrings[r]
 }
 
+// MarshalText implements the encoding.TextMarshaler interface so that the role
+// is serialized with its human-readable name.
+func (r Role) MarshalText() ([]byte, error) {
+	return []byte(r.String()), nil
+}
+
+// UnmarshalText implements the encoding.TextUnmarshaler interface.
+func (r *Role) UnmarshalText(text []byte) error {
+	role, err := ParseRole(string(text))
+	if err != nil {
+		return err
+	}
+	*r = role
+	return nil
+}
+
+// ParseRole returns the role referred by the human-readable name.
+func ParseRole(name string) (Role, error) {
+	for r, s := range roleStrings {
+		if s == strings.ToLower(name) {
+			return r, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown role: %s", name)
+}
+
 // IsValidRole checks if the given role is a valid one.
 func IsValidRole(role Role) bool {
 	return role <= System
 }
 
 // RoleMap is a map with key as the role, and value as
-// a list of usernames in the role.
+// a list of principals in the role.  A principal is either a username,
+// or a group name prefixed with `g:` (see `GroupPrincipal`).
 type RoleMap map[Role][]string
 
+// groupPrefix is the prefix of a principal referring to a group.
+const groupPrefix string = "g:"
+
+// GroupPrincipal returns the principal referring to the group `name`.
+func GroupPrincipal(name string) string {
+	return groupPrefix + name
+}
+
+// ParsePrincipal splits the `principal` into the name of the user or group, and
+// whether the principal refers to a group.
+func ParsePrincipal(principal string) (name string, group bool) {
+	if strings.HasPrefix(principal, groupPrefix) {
+		return strings.TrimPrefix(principal, groupPrefix), true
+	}
+	return principal, false
+}
+
 // RolePathMap is a data structure where the RoleMap is associated with a Path.
 type RolePathMap struct {
 	Path    string
@@ -75,6 +122,9 @@ type Roler interface {
 // RolerMap defines a list of supported rolers with associated path as key of
 // the map.  The path is usually refers to the top-level mount point of the
 // fileserver on which the roler performs actions.
+//
+// It contains the rolers of the built-in storage systems, and is replaced by the
+// storage systems declared in the configuration via `ConfigureRolers`.
 var RolerMap = map[string]Roler{
 	"/project":         NetAppRoler{},
 	"/groupshare":      NetAppRoler{},
@@ -82,6 +132,58 @@ var RolerMap = map[string]Roler{
 	"/project_cephfs":  CephFsRoler{},
 }
 
+// NewRoler returns the roler of the given `kind`: `netapp`, `freenas`, `cephfs` or `posix`.
+func NewRoler(kind string) (Roler, error) {
+	switch strings.ToLower(kind) {
+	case "netapp":
+		return NetAppRoler{}, nil
+	case "freenas":
+		return FreeNasRoler{}, nil
+	case "cephfs":
+		return CephFsRoler{}, nil
+	case "posix":
+		return PosixRoler{}, nil
+	default:
+		return nil, fmt.Errorf("unsupported roler: %s", kind)
+	}
+}
+
+// ConfigureRolers replaces the RolerMap with the rolers of the storage systems declared
+// in the storage configuration `conf`, with the project root and the other mount points
+// of a storage system as the paths.
+func ConfigureRolers(conf config.StorageConfiguration) error {
+	rmap := make(map[string]Roler)
+	for _, s := range conf.Systems {
+		roler, err := NewRoler(s.Roler)
+		if err != nil {
+			return fmt.Errorf("storage system %s: %s", s.Name, err)
+		}
+		for _, p := range s.Paths() {
+			rmap[filepath.Clean(p)] = roler
+		}
+	}
+	RolerMap = rmap
+	return nil
+}
+
+// LoadStorage configures the RolerMap (see `ConfigureRolers`) with the storage systems
+// declared in the configuration file `cpath`, and returns the storage configuration.
+// The built-in storage systems (see `config.DefaultStorageConfiguration`) are used if
+// `cpath` is an empty string.
+func LoadStorage(cpath string) (config.StorageConfiguration, error) {
+
+	if cpath == "" {
+		conf := config.DefaultStorageConfiguration()
+		return conf, ConfigureRolers(conf)
+	}
+
+	conf, err := config.LoadConfig(cpath)
+	if err != nil {
+		return conf.Storage, err
+	}
+	return conf.Storage, ConfigureRolers(conf.Storage)
+}
+
 // GetRoler returns a proper roler determined from the given path.
 // It resolves the symbolic link, and determins the roler based on
 // the source of the link.
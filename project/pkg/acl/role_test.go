@@ -0,0 +1,41 @@
+package acl
+
+import (
+	"testing"
+
+	"github.com/Donders-Institute/tg-toolset-golang/pkg/config"
+	ufp "github.com/Donders-Institute/tg-toolset-golang/pkg/filepath"
+)
+
+func TestConfigureRolers(t *testing.T) {
+
+	rmap := RolerMap
+	defer func() { RolerMap = rmap }()
+
+	conf := config.StorageConfiguration{
+		Systems: []config.StorageSystemConfiguration{
+			{Name: "netapp", ProjectRoot: "/project", MountPoints: []string{"/groupshare/"}, Roler: "netapp"},
+			{Name: "lustre", ProjectRoot: "/project_lustre", Roler: "cephfs"},
+		},
+	}
+
+	if err := ConfigureRolers(conf); err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	for p, expected := range map[string]Roler{
+		"/project/3010000.01":         NetAppRoler{},
+		"/groupshare/tg":              NetAppRoler{},
+		"/project_lustre/3010000.01":  CephFsRoler{},
+		"/project_freenas/3010000.01": nil,
+	} {
+		if roler := GetRoler(ufp.FilePathMode{Path: p}); roler != expected {
+			t.Errorf("%s: expect roler %T but got %T", p, expected, roler)
+		}
+	}
+
+	conf.Systems[1].Roler = "unknown"
+	if err := ConfigureRolers(conf); err == nil {
+		t.Errorf("expect error on unsupported roler")
+	}
+}
@@ -1,21 +1,27 @@
 package acl
 
 import (
+	"context"
 	"fmt"
+	"io"
 	"os"
-	"os/signal"
 	"os/user"
 	"path/filepath"
 	"reflect"
 	"strings"
 	"sync"
 	"syscall"
+	"time"
 
 	ufp "github.com/Donders-Institute/tg-toolset-golang/pkg/filepath"
 	log "github.com/Donders-Institute/tg-toolset-golang/pkg/logger"
 	ustr "github.com/Donders-Institute/tg-toolset-golang/pkg/strings"
 )
 
+// LockFile is the name of the lock file created in the top-level directory on which
+// the roles are being set/deleted.
+const LockFile string = ".prj_setacl.lock"
+
 var signalHandled = []os.Signal{
 	syscall.SIGABRT,
 	syscall.SIGHUP,
@@ -32,6 +38,8 @@ type Runner struct {
 	Managers string
 	// Contributors is a comma-separated list of system UIDs to be set as contributors or deleted from the contributor role.
 	Contributors string
+	// Writers is a comma-separated list of system UIDs to be set as writers or deleted from the writer role.
+	Writers string
 	// Viewers is a comma-separated list of system UIDs to be set as viewers or deleted from the viewer role.
 	Viewers string
 	// Traversers is a comma-separated list of system UIDs to be deleted from the traverse role.
@@ -55,35 +63,161 @@ type Runner struct {
 	// SkipFiles specifies whether the set/delete action should skip applying role changes on
 	// existing files.
 	SkipFiles bool
+	// Include are the glob patterns of the files on which the set/delete/get action is
+	// performed while walking through the filesystem tree; other files are skipped.
+	// See `filepath.WalkOptions` for how the patterns are matched.
+	//
+	// The walk filters (i.e. Include, Exclude, MaxDepth, SameFilesystem and SkipSnapshots) do
+	// not apply to the rolers applying the roles recursively by themselves, e.g. the CephFsRoler.
+	Include []string
+	// Exclude are the glob patterns of the files and directories skipped, together with the
+	// content of the directories, while walking through the filesystem tree.
+	Exclude []string
+	// MaxDepth is the maximum number of directory levels below the RootPath to walk through.
+	// The default 0 means no limit.
+	MaxDepth int
+	// SameFilesystem specifies whether the walk is restricted to the filesystem of the RootPath.
+	SameFilesystem bool
+	// SkipSnapshots specifies whether the snapshot directories of the filers (e.g. `.snapshot`)
+	// are skipped while walking through the filesystem tree.  See `filepath.SnapshotDirs`.
+	SkipSnapshots bool
+	// Incremental specifies whether the set/delete action only applies on the files changed
+	// since the last run of the same action on the RootPath, as recorded in the LastRunStore.
+	// The directories are always walked through and processed.  The last run is recorded
+	// when the action is completed without failure.  Like the walk filters, it doesn't apply
+	// to the rolers applying the roles recursively by themselves.
+	//
+	// Note that the files of a directory tree moved into the RootPath within the same
+	// filesystem keep their modification and status change times, and are therefore skipped.
+	// A full run is needed after such a move.
+	Incremental bool
+	// LastRunStore is the path of the store of the last-run timestamps of the incremental
+	// set/delete actions.  The default is `LastRunStorePath`.
+	LastRunStore string
+	// Limiter limits the rate of the filesystem operations of the walk and the workers of the
+	// set/delete/get action.  It can be shared by multiple Runners.  For the rolers applying the
+	// roles recursively by themselves, the recursive operation is counted as one operation.
+	Limiter *ufp.RateLimiter
+	// ControlFile is the path of the file from which the limits of the Limiter are reloaded
+	// whenever the file is modified during the set/delete action (see `RateLimiter.LoadControl`).
+	ControlFile string
+	// DryRun specifies whether the set/delete action should only be planned.  In dry-run mode,
+	// the role changes on every walked path are reported without touching the filesystem.
+	DryRun bool
+	// Output specifies the format in which the roles are printed by PrintRoles.
+	Output OutputFormat
+	// Journal specifies whether the progress of the set/delete action should be recorded in
+	// a journal file in the RootPath, so that an interrupted action can be resumed.
+	Journal bool
+	// Resume specifies whether the set/delete action should continue from the journal of an
+	// interrupted action, skipping the directories completed already.  It implies Journal.
+	Resume bool
+	// LockTimeout is the maximum duration to wait for the lock held by another set/delete
+	// action on the same RootPath to be released.  The default 0 means no waiting.
+	LockTimeout time.Duration
+	// ProgressInterval is the interval at which the progress of the set/delete action is
+	// reported (see `Progress`).  The default 0 means no progress report.
+	ProgressInterval time.Duration
+	// ProgressOutput is the writer to which the progress is written as JSON lines.  If it is
+	// not set, the progress is reported in the log.
+	ProgressOutput io.Writer
+	// Retries is the number of times the roles are retried on the paths on which they failed
+	// to be set or removed.  The failed paths are retried after the walk is completed.
+	Retries int
+	// RetryBackoff is the time to wait before the first retry of the failed paths.  It is
+	// doubled after every retry.
+	RetryBackoff time.Duration
+	// FailureReport is the path of the report of the paths on which the roles failed to be set
+	// or removed after the retries (see `FailureReport`).  The report is removed if there is
+	// no failure.
+	FailureReport string
+	// Expiry is the time at which the roles set by SetRoles expire.  The roles with an expiry
+	// are recorded in the GrantRegistry, and removed by a sweep over the expired grants.  The
+	// zero time means the roles do not expire.
+	Expiry time.Time
+	// GrantRegistry is the path of the registry of the roles with an expiry (see `GrantRegistry`).
+	// If it is specified, the registry is also updated for the roles set without an expiry or
+	// removed by RemoveRoles, so that they are not removed by the sweep afterwards.
+	GrantRegistry string
+	// ValidatePrincipal is a pre-flight check on every user and group to be set in a role by
+	// SetRoles, e.g. against the project database.  The roles are not set on any path if it
+	// returns an error for one of the principals.  No check is performed if it is not set.
+	ValidatePrincipal func(principal string) error
 
 	// ppath is an absolute path evaluated from RootPath.  If RootPath is a symbolic link,
 	// the ppath will be pointed to the evaluated target.
 	ppath string
+
+	// changedSince is the time since which the files walked through by an incremental
+	// set/delete action are changed.
+	changedSince time.Time
+
+	// journal records the progress of the set/delete action.
+	journal *journal
+
+	// collector collects the result of the set/delete action.
+	collector *runCollector
+
+	// progress keeps track of the walk for reporting the progress.
+	progress *progressMeter
 }
 
 // SetRoles sets user roles recursively on a the path specified by `Runner.RootPath`.
+// The action is stopped by the system signals, in which case the exit code is the
+// signal number; otherwise the exit code is derived from the `RunResult`.
 func (r *Runner) SetRoles() (exitcode int, err error) {
+	return runWithSignals(r.SetRolesContext)
+}
+
+// SetRolesContext sets user roles recursively on a the path specified by `Runner.RootPath`,
+// and returns the counts of the paths visited, changed, skipped and failed.  The action
+// is stopped when the `ctx` is cancelled, in which case the error of the `ctx` is returned.
+func (r *Runner) SetRolesContext(ctx context.Context) (result RunResult, err error) {
 
 	// map for role specification inputs (commad options)
 	roleSpec := make(map[Role]string)
 	roleSpec[Manager] = r.Managers
-	//roleSpec[Writer] = r.Writers
+	roleSpec[Writer] = r.Writers
 	roleSpec[Contributor] = r.Contributors
 	roleSpec[Viewer] = r.Viewers
 
 	// construct operable map and check duplicated specification
 	roles, usersT, err := r.parseRoles(roleSpec, true)
 	if err != nil {
-		exitcode = 1
 		return
 	}
 
+	if err = r.validatePrincipals(roles); err != nil {
+		return
+	}
+
+	if err = r.walkFilter(ufp.WalkOptions{}).Validate(); err != nil {
+		return
+	}
+
+	if !r.Expiry.IsZero() {
+		if r.GrantRegistry == "" {
+			err = fmt.Errorf("grant registry not specified for roles with expiry")
+			return
+		}
+		if !r.Expiry.After(time.Now()) {
+			err = fmt.Errorf("expiry in the past: %s", r.Expiry)
+			return
+		}
+	}
+
+	// register the roles in the grant registry once they are in place.
+	defer func() {
+		if err == nil && result.Failed == 0 && !r.DryRun {
+			err = r.updateGrants(roles, false)
+		}
+	}()
+
 	// resolve any symlinks on ppathSym to actual path this program should work on.
 	r.ppath, _ = filepath.EvalSymlinks(r.RootPath)
 
 	fpinfo, err := ufp.GetFilePathMode(r.ppath)
 	if err != nil {
-		exitcode = 1
 		err = fmt.Errorf("path not found or unaccessible: %s", r.RootPath)
 		return
 	}
@@ -91,15 +225,18 @@ func (r *Runner) SetRoles() (exitcode int, err error) {
 	// check whether there is a need to set ACL based on the ACL set on ppath.
 	roler := GetRoler(*fpinfo)
 	if roler == nil {
-		exitcode = 1
 		err = fmt.Errorf("roler not found for path: %s", fpinfo.Path)
 		return
 	}
 
+	// the writer role is approximated on the POSIX ACL; see the CephFsRoler.
+	if len(roles[Writer]) > 0 && usePosixACL(roler) {
+		log.Warnf("writer role approximated by the contributor permission, writers can delete and rename files of others: %s", fpinfo.Path)
+	}
+
 	log.Debugf("%+v", fpinfo)
 	rolesNow, err := roler.GetRoles(*fpinfo)
 	if err != nil {
-		exitcode = 1
 		err = fmt.Errorf("%s: %s", err, fpinfo.Path)
 		return
 	}
@@ -119,69 +256,113 @@ func (r *Runner) SetRoles() (exitcode int, err error) {
 			}
 		}
 	}
-	if n == 0 && !r.Force {
+	// in incremental mode, the new files may miss the roles in place on the top-level path.
+	incremental := r.Incremental && !usePosixACL(roler)
+
+	if n == 0 && !r.Force && !r.Resume && !incremental {
 		log.Warnf("All roles in place, I have nothing to do.")
+		result.Visited, result.Skipped = 1, 1
+		return
+	}
+
+	spec := journalSpec("set", roles)
+
+	// walk only through the files changed since the last run of the same action.
+	if incremental {
+		var commit func() error
+		if commit, err = r.startIncremental("set", roles); err != nil {
+			return
+		}
+		defer func() {
+			if err == nil && result.Failed == 0 && !r.DryRun {
+				err = commit()
+			}
+		}()
+	}
+
+	// RoleMap for traverse role
+	rolesT := make(map[Role][]string)
+	rolesT[Traverse] = usersT
+
+	// report the planned changes without touching the filesystem.
+	if r.DryRun {
+		r.planRoles(roles, rolesT, false)
 		return
 	}
 
 	// acquiring operation lock file
 	if fpinfo.Mode.IsDir() {
 		// acquire lock for the current process
-		flock := filepath.Join(r.ppath, ".prj_setacl.lock")
-		if err = ufp.AcquireLock(flock); err != nil {
-			exitcode = 1
+		var flock string
+		if flock, err = r.acquireLock(); err != nil {
 			return
 		}
 		defer os.Remove(flock)
 	}
 
-	chanS := make(chan os.Signal, 1)
-	signal.Notify(chanS, signalHandled...)
-
-	// RoleMap for traverse role
-	rolesT := make(map[Role][]string)
-	rolesT[Traverse] = usersT
+	r.collector = &runCollector{}
+	defer func() { result = r.collector.get() }()
+	defer r.startProgress()()
+	defer r.startThrottle()()
 
 	var chanF chan ufp.FilePathMode
 
-	if _, ok := roler.(CephFsRoler); ok {
-		// for CephFS (POSIX ACL), the setacl acts only on
+	if usePosixACL(roler) {
+		// for CephFS and plain POSIX filesystems (POSIX ACL), the setacl acts only on
 		// the top-level directory recursively given the better
 		// performance and permission correctness it automatically applies.
 		chanF = make(chan ufp.FilePathMode, r.Nthreads*4)
 		chanF <- *fpinfo
 		close(chanF)
+		if r.progress != nil {
+			r.progress.noWalk()
+		}
 	} else {
 		// for other rolers (mostly NFS4ACL), the setacl acts on individual
 		// files and sub-directories so that permission can be applied correctly.
-		chanF = ufp.GoFastWalk(r.ppath, r.FollowLink, r.SkipFiles, r.Nthreads*4)
+		var done bool
+		if chanF, done, err = r.goWalk(ctx, spec, fpinfo.Mode.IsDir()); err != nil {
+			return
+		}
+		if done {
+			log.Warnf("All directories completed according to the journal, I have nothing to do.")
+			return
+		}
+		defer r.closeJournal()
 	}
 
 	// set specified user roles
-	chanOut := r.goSetRoles(roles, chanF, r.Nthreads)
+	chanOut := r.goSetRoles(ctx, roles, chanF, r.Nthreads)
 
 	// set traverse roles
 	chanFt := r.goPrintOut(chanOut, r.Traverse, rolesT, r.Nthreads*4, false)
-	chanOutt := r.goSetRoles(rolesT, chanFt, r.Nthreads)
+	chanOutt := r.goSetRoles(ctx, rolesT, chanFt, r.Nthreads)
 
-	// block main until the output is all printed, or a system signal is received
-	select {
-	case s := <-chanS:
-		log.Warnf("Stopped due to received signal: %s\n", s)
-		exitcode = int(s.(syscall.Signal))
-		return
-	case <-r.goPrintOut(chanOutt, false, nil, 0, false):
-		exitcode = 0
-		return
+	// block until the output is all printed; the workers skip the remaining paths
+	// once the ctx is cancelled.
+	<-r.goPrintOut(chanOutt, false, nil, 0, false)
+
+	if err = r.closeFailures(ctx, false); err == nil {
+		r.completeJournal()
 	}
+	return
 }
 
 // RemoveRoles removes user roles recursively on a the path specified by `Runner.RootPath`.
+// The action is stopped by the system signals, in which case the exit code is the
+// signal number; otherwise the exit code is derived from the `RunResult`.
 func (r *Runner) RemoveRoles() (exitcode int, err error) {
+	return runWithSignals(r.RemoveRolesContext)
+}
+
+// RemoveRolesContext removes user roles recursively on a the path specified by `Runner.RootPath`,
+// and returns the counts of the paths visited, changed, skipped and failed.  The action
+// is stopped when the `ctx` is cancelled, in which case the error of the `ctx` is returned.
+func (r *Runner) RemoveRolesContext(ctx context.Context) (result RunResult, err error) {
 	// map for role specification inputs (commad options)
 	roleSpec := make(map[Role]string)
 	roleSpec[Manager] = r.Managers
-	//roleSpec[Writer] = r.Writers
+	roleSpec[Writer] = r.Writers
 	roleSpec[Contributor] = r.Contributors
 	roleSpec[Viewer] = r.Viewers
 	roleSpec[Traverse] = r.Traversers
@@ -189,23 +370,31 @@ func (r *Runner) RemoveRoles() (exitcode int, err error) {
 	// construct operable map and check duplicated specification
 	roles, usersT, err := r.parseRoles(roleSpec, false)
 	if err != nil {
-		exitcode = 1
 		return
 	}
 
+	if err = r.walkFilter(ufp.WalkOptions{}).Validate(); err != nil {
+		return
+	}
+
+	// unregister the removed roles from the grant registry.
+	defer func() {
+		if err == nil && result.Failed == 0 && !r.DryRun {
+			err = r.updateGrants(roles, true)
+		}
+	}()
+
 	// resolve any symlinks on ppath
 	r.ppath, _ = filepath.EvalSymlinks(r.RootPath)
 
 	fpinfo, err := ufp.GetFilePathMode(r.ppath)
 	if err != nil {
-		exitcode = 1
 		err = fmt.Errorf("path not found or unaccessible: %s", r.RootPath)
 		return
 	}
 
 	roler := GetRoler(*fpinfo)
 	if roler == nil {
-		exitcode = 1
 		err = fmt.Errorf("roler not found: %s", fpinfo.Path)
 		return
 	}
@@ -213,7 +402,6 @@ func (r *Runner) RemoveRoles() (exitcode int, err error) {
 	log.Debugf("+%v", fpinfo)
 	rolesNow, err := roler.GetRoles(*fpinfo)
 	if err != nil {
-		exitcode = 1
 		err = fmt.Errorf("%s: %s", err, fpinfo.Path)
 		return
 	}
@@ -243,63 +431,202 @@ func (r *Runner) RemoveRoles() (exitcode int, err error) {
 		}
 	}
 
-	if n == 0 && !r.Force {
+	// in incremental mode, the new files may miss the roles in place on the top-level path.
+	incremental := r.Incremental && !usePosixACL(roler)
+
+	if n == 0 && !r.Force && !r.Resume && !incremental {
 		log.Warnf("All roles in place, I have nothing to do.")
+		result.Visited, result.Skipped = 1, 1
+		return
+	}
+
+	spec := journalSpec("delete", roles)
+
+	// walk only through the files changed since the last run of the same action.
+	if incremental {
+		var commit func() error
+		if commit, err = r.startIncremental("delete", roles); err != nil {
+			return
+		}
+		defer func() {
+			if err == nil && result.Failed == 0 && !r.DryRun {
+				err = commit()
+			}
+		}()
+	}
+
+	// RoleMap for traverse role removal
+	rolesT := make(map[Role][]string)
+	rolesT[Traverse] = usersT
+
+	// report the planned changes without touching the filesystem.
+	if r.DryRun {
+		r.planRoles(roles, rolesT, true)
 		return
 	}
 
 	// acquiring operation lock file
 	if fpinfo.Mode.IsDir() {
 		// acquire lock for the current process
-		flock := filepath.Join(r.ppath, ".prj_setacl.lock")
-		if err := ufp.AcquireLock(flock); err != nil {
-			log.Fatalf("%s", err)
+		var flock string
+		if flock, err = r.acquireLock(); err != nil {
+			return
 		}
 		defer os.Remove(flock)
 	}
 
-	chanS := make(chan os.Signal, 1)
-	signal.Notify(chanS, signalHandled...)
-
-	// RoleMap for traverse role removal
-	rolesT := make(map[Role][]string)
-	rolesT[Traverse] = usersT
+	r.collector = &runCollector{}
+	defer func() { result = r.collector.get() }()
+	defer r.startProgress()()
+	defer r.startThrottle()()
 
 	var chanF chan ufp.FilePathMode
 
-	if _, ok := roler.(CephFsRoler); ok {
-		// for CephFS (POSIX ACL), the setacl acts only on
+	if usePosixACL(roler) {
+		// for CephFS and plain POSIX filesystems (POSIX ACL), the setacl acts only on
 		// the top-level directory recursively given the better
 		// performance and permission correctness it automatically applies.
 		chanF = make(chan ufp.FilePathMode, r.Nthreads*4)
 		chanF <- *fpinfo
 		close(chanF)
+		if r.progress != nil {
+			r.progress.noWalk()
+		}
 	} else {
 		// for other rolers (mostly NFS4ACL), the setacl acts on individual
 		// files and sub-directories so that permission can be applied correctly.
-		chanF = ufp.GoFastWalk(r.ppath, r.FollowLink, r.SkipFiles, r.Nthreads*4)
+		var done bool
+		if chanF, done, err = r.goWalk(ctx, spec, fpinfo.Mode.IsDir()); err != nil {
+			return
+		}
+		if done {
+			log.Warnf("All directories completed according to the journal, I have nothing to do.")
+			return
+		}
+		defer r.closeJournal()
 	}
 
 	// remove specified user roles
-	chanOut := r.goDelRoles(roles, chanF, r.Nthreads)
+	chanOut := r.goDelRoles(ctx, roles, chanF, r.Nthreads)
 
 	// channels for removing traverse roles
 	chanFt := r.goPrintOut(chanOut, r.Traverse, rolesT, r.Nthreads*4, true)
-	chanOutt := r.goDelRoles(rolesT, chanFt, r.Nthreads)
+	chanOutt := r.goDelRoles(ctx, rolesT, chanFt, r.Nthreads)
+
+	// block until the output is all printed; the workers skip the remaining paths
+	// once the ctx is cancelled.
+	<-r.goPrintOut(chanOutt, false, nil, 0, true)
+
+	if err = r.closeFailures(ctx, true); err == nil {
+		r.completeJournal()
+	}
+	return
+}
+
+// acquireLock acquires the operation lock on the `Runner.ppath` and returns the path of
+// the lock file.  A stale lock left behind by an interrupted action on the same host is
+// replaced; a lock held by another process is waited for until `Runner.LockTimeout`.
+func (r Runner) acquireLock() (string, error) {
+	flock := filepath.Join(r.ppath, LockFile)
+	return flock, ufp.AcquireLockWait(flock, r.LockTimeout)
+}
+
+// goWalk starts walking through the `Runner.ppath`, and returns the channel of the walked
+// paths.  The action specified by `spec` is recorded in the journal if the journal or resume
+// mode is enabled.  In resume mode, the directories completed according to the journal are
+// left out from the walk, and `done` is true if the whole `Runner.ppath` is completed.
+// The journal is only used when `Runner.ppath` is a directory, as indicated by `isDir`.
+// The sub-directories are no longer walked into once the `ctx` is cancelled.
+func (r *Runner) goWalk(ctx context.Context, spec string, isDir bool) (chanF chan ufp.FilePathMode, done bool, err error) {
+	if (!r.Journal && !r.Resume) || !isDir {
+		opts := ufp.WalkOptions{FollowLink: r.FollowLink, SkipFiles: r.SkipFiles}
+		chanF = ufp.GoFastWalkWithOptions(r.ppath, r.walkOptions(ctx, opts), r.Nthreads*4)
+		return
+	}
+
+	if r.journal, err = openJournal(journalPath(r.ppath), spec, r.Resume); err != nil {
+		return
+	}
+
+	if r.Resume && r.journal.isDone(r.ppath) {
+		r.journal.close(true)
+		r.journal = nil
+		done = true
+		return
+	}
+
+	// the `Runner.ppath` is only completed after the traverse roles are applied on it and
+	// on its parents (see `completeJournal`).
+	r.journal.hold(r.ppath)
+
+	opts := r.journal.walkOptions(r.FollowLink, r.SkipFiles, r.Resume)
+	chanF = ufp.GoFastWalkWithOptions(r.ppath, r.walkOptions(ctx, opts), r.Nthreads*4)
+	return
+}
+
+// walkFilter returns the walk options `opts` with the walk filters of the Runner.
+func (r Runner) walkFilter(opts ufp.WalkOptions) ufp.WalkOptions {
+	opts.Include = r.Include
+	opts.Exclude = r.Exclude
+	opts.MaxDepth = r.MaxDepth
+	opts.SameFilesystem = r.SameFilesystem
+	opts.SkipSnapshots = r.SkipSnapshots
+	opts.ChangedSince = r.changedSince
+	opts.Limiter = r.Limiter
+	return opts
+}
 
-	// block main until the output is all printed, or a system signal is received
-	select {
-	case s := <-chanS:
-		log.Warnf("Stopped due to received signal: %s\n", s)
-		exitcode = int(s.(syscall.Signal))
+// walkOptions returns the walk options `opts` with the walk filters of the Runner, and with
+// the walk stopped when the `ctx` is cancelled and tracked for reporting the progress.
+func (r *Runner) walkOptions(ctx context.Context, opts ufp.WalkOptions) ufp.WalkOptions {
+	opts = withContext(ctx, r.walkFilter(opts))
+	if r.progress != nil {
+		opts = r.progress.walkOptions(opts)
+	}
+	return opts
+}
+
+// withContext returns the walk options `opts` with the sub-directories skipped once the
+// `ctx` is cancelled.
+func withContext(ctx context.Context, opts ufp.WalkOptions) ufp.WalkOptions {
+	skipDir := opts.SkipDir
+	opts.SkipDir = func(dir string) bool {
+		if ctx.Err() != nil {
+			return true
+		}
+		return skipDir != nil && skipDir(dir)
+	}
+	return opts
+}
+
+// completeJournal releases the hold on the `Runner.ppath` in the journal, if any, once the
+// traverse roles are applied without failures.  The `Runner.ppath` is then recorded as
+// completed if its whole subtree is completed.
+func (r *Runner) completeJournal() {
+	if r.journal == nil || r.collector.get().Failed > 0 {
 		return
-	case <-r.goPrintOut(chanOutt, false, nil, 0, true):
-		exitcode = 0
+	}
+	r.journal.unhold(r.ppath)
+}
+
+// closeJournal closes the journal, if any.  The journal file is removed if the whole
+// `Runner.ppath` is completed; otherwise it is kept for resuming the action.
+func (r *Runner) closeJournal() {
+	if r.journal == nil {
 		return
 	}
+
+	done := r.journal.isDone(r.ppath)
+	if !done {
+		log.Warnf("Progress recorded in %s, run again in resume mode to continue.", r.journal.store.path)
+	}
+	if err := r.journal.close(done); err != nil {
+		log.Errorf("cannot close journal: %s", err)
+	}
 }
 
-// PrintRoles prints user roles on a the path specified by `Runner.RootPath` to the stdout.
+// PrintRoles prints user roles on a the path specified by `Runner.RootPath` to the stdout,
+// in the format specified by `Runner.Output`.
 // Use the `recursion` argument to enable/disable recursion through filesystem tree.
 func (r *Runner) PrintRoles(recursion bool) error {
 
@@ -309,20 +636,23 @@ func (r *Runner) PrintRoles(recursion bool) error {
 		return err
 	}
 
+	w := NewRoleWriter(os.Stdout, r.Output)
 	for o := range chanOut {
-		fmt.Printf("%s:\n", o.Path)
-		for _, r := range []Role{Manager, Contributor, Writer, Viewer, Traverse} {
-			if users, ok := o.RoleMap[r]; ok {
-				fmt.Printf("%12s: %s\n", r, strings.Join(users, ","))
-			}
+		if err := w.Write(o); err != nil {
+			log.Errorf("%s: %s", err, o.Path)
 		}
 	}
-	return nil
+	return w.Flush()
 }
 
 // GetRoles returns user roles on a the path specified by `Runner.RootPath` via a channel.
 // Use the `recursion` argument to enable/disable recursion through filesystem tree.
 func (r *Runner) GetRoles(recursion bool) (chan RolePathMap, error) {
+
+	if err := r.walkFilter(ufp.WalkOptions{}).Validate(); err != nil {
+		return nil, err
+	}
+
 	// resolve any symlinks on ppath
 	r.ppath, _ = filepath.EvalSymlinks(r.RootPath)
 
@@ -339,7 +669,8 @@ func (r *Runner) GetRoles(recursion bool) (chan RolePathMap, error) {
 	var chanD chan ufp.FilePathMode
 	nthreads := r.Nthreads
 	if recursion {
-		chanD = ufp.GoFastWalk(r.ppath, r.FollowLink, r.SkipFiles, nthreads)
+		opts := ufp.WalkOptions{FollowLink: r.FollowLink, SkipFiles: r.SkipFiles}
+		chanD = ufp.GoFastWalkWithOptions(r.ppath, r.walkFilter(opts), nthreads)
 	} else {
 		nthreads = 1
 		chanD = make(chan ufp.FilePathMode)
@@ -359,6 +690,9 @@ func (r *Runner) GetRoles(recursion bool) (chan RolePathMap, error) {
 // 1. The users specified in the roleSpec cannot contain the current user.
 //
 // 2. The same user id cannot appear twice if userUnique option is true
+//
+// The groups are specified with the `g:` prefix, e.g. `g:tg` (see `ParsePrincipal`).  Empty
+// entries in the comma-separated specification are skipped.
 func (r Runner) parseRoles(roleSpec map[Role]string, userUnique bool) (map[Role][]string, []string, error) {
 	roles := make(map[Role][]string)
 	users := make(map[string]bool)
@@ -368,12 +702,17 @@ func (r Runner) parseRoles(roleSpec map[Role]string, userUnique bool) (map[Role]
 	me, _ := user.Current()
 
 	for r, spec := range roleSpec {
-		if spec == "" {
-			continue
-		}
-		roles[r] = strings.Split(spec, ",")
-		usersT = append(usersT, roles[r]...)
-		for _, u := range roles[r] {
+		for _, u := range strings.Split(spec, ",") {
+
+			// skip empty entries, e.g. from joining unset CLI flags
+			if u == "" {
+				continue
+			}
+
+			// the group name cannot be empty
+			if name, _ := ParsePrincipal(u); name == "" {
+				return nil, nil, fmt.Errorf("empty user or group name in: %s", spec)
+			}
 
 			// cannot change the role for the user himself
 			if u == me.Username {
@@ -385,11 +724,37 @@ func (r Runner) parseRoles(roleSpec map[Role]string, userUnique bool) (map[Role]
 				return nil, nil, fmt.Errorf("user specified more than once: %s", u)
 			}
 			users[u] = true
+
+			roles[r] = append(roles[r], u)
+			usersT = append(usersT, u)
 		}
 	}
 	return roles, usersT, nil
 }
 
+// validatePrincipals checks the principals in the `roles` with the `Runner.ValidatePrincipal`,
+// and returns an error listing all principals failing the check.
+func (r Runner) validatePrincipals(roles RoleMap) error {
+
+	if r.ValidatePrincipal == nil {
+		return nil
+	}
+
+	var invalid []string
+	for _, role := range rolesInOrder {
+		for _, u := range roles[role] {
+			if err := r.ValidatePrincipal(u); err != nil {
+				invalid = append(invalid, err.Error())
+			}
+		}
+	}
+
+	if len(invalid) > 0 {
+		return fmt.Errorf("invalid users or groups: %s", strings.Join(invalid, "; "))
+	}
+	return nil
+}
+
 // goGetACL performs getting ACL on walked paths, using a go routine. The result is pushed to
 // a channel of `acl.RolePathMap`.  It also closes the channel when all walked paths are processed.
 func (r Runner) goGetACL(chanD chan ufp.FilePathMode, nthreads int) chan RolePathMap {
@@ -409,7 +774,10 @@ func (r Runner) goGetACL(chanD chan ufp.FilePathMode, nthreads int) chan RolePat
 					continue
 				}
 				log.Debugf("path: %s %s", p.Path, reflect.TypeOf(roler))
-				if roles, err := roler.GetRoles(p); err == nil {
+				release := r.Limiter.Acquire()
+				roles, err := roler.GetRoles(p)
+				release()
+				if err == nil {
 					chanOut <- RolePathMap{Path: p.Path, RoleMap: roles}
 				} else {
 					log.Errorf("%s: %s", err, p.Path)
@@ -440,7 +808,7 @@ func (r Runner) goGetACL(chanD chan ufp.FilePathMode, nthreads int) chan RolePat
 //
 // The returned channel can be passed onto the goPrintOut function for displaying the
 // results asynchronously.
-func (r Runner) goSetRoles(roles RoleMap, chanF chan ufp.FilePathMode, nthreads int) chan RolePathMap {
+func (r Runner) goSetRoles(ctx context.Context, roles RoleMap, chanF chan ufp.FilePathMode, nthreads int) chan RolePathMap {
 
 	// output channel
 	chanOut := make(chan RolePathMap)
@@ -453,24 +821,17 @@ func (r Runner) goSetRoles(roles RoleMap, chanF chan ufp.FilePathMode, nthreads
 
 		if roler == nil {
 			log.Warnf("roler not found: %s", f.Path)
+			r.skip()
 			return
 		}
 
-		// set recursion to true if the roler is implemented for CephFS.
-		_, recursion := roler.(CephFsRoler)
-
-		// set recursion to false if it is only about setting Traverse role
-		// because setting traverse role walks upwards in the directory tree
-		// and therefore there is no reason for recursion.
-		if _, ok := roles[Traverse]; ok && len(roles) == 1 {
-			recursion = false
-		}
-
-		if rolesNew, err := roler.SetRoles(f, roles, recursion, false); err == nil {
-			chanOut <- RolePathMap{Path: f.Path, RoleMap: rolesNew}
-		} else {
+		rolesNew, err := r.updateRoles(roler, f, roles, false)
+		r.visit(f, roles, err)
+		if err != nil {
 			log.Errorf("%s: %s", err, f.Path)
+			return
 		}
+		chanOut <- RolePathMap{Path: f.Path, RoleMap: rolesNew}
 	}
 
 	// launch parallel go routines for setting ACL
@@ -480,6 +841,11 @@ func (r Runner) goSetRoles(roles RoleMap, chanF chan ufp.FilePathMode, nthreads
 		for i := 0; i < nthreads; i++ {
 			go func() {
 				for f := range chanF {
+					// drain the remaining paths once the ctx is cancelled.
+					if ctx.Err() != nil {
+						r.skip()
+						continue
+					}
 					log.Debugf("process file: %s", f.Path)
 					updateACL(f)
 				}
@@ -499,7 +865,7 @@ func (r Runner) goSetRoles(roles RoleMap, chanF chan ufp.FilePathMode, nthreads
 //
 // The returned channel can be passed onto the goPrintOut function for displaying the
 // results asynchronously.
-func (r Runner) goDelRoles(roles RoleMap, chanF chan ufp.FilePathMode, nthreads int) chan RolePathMap {
+func (r Runner) goDelRoles(ctx context.Context, roles RoleMap, chanF chan ufp.FilePathMode, nthreads int) chan RolePathMap {
 
 	// output channel
 	chanOut := make(chan RolePathMap)
@@ -511,24 +877,17 @@ func (r Runner) goDelRoles(roles RoleMap, chanF chan ufp.FilePathMode, nthreads
 
 		if roler == nil {
 			log.Warnf("roler not found: %s", f.Path)
+			r.skip()
 			return
 		}
 
-		// set recursion to true if the roler is implemented for CephFS.
-		_, recursion := roler.(CephFsRoler)
-
-		// set recursion to false if it is only about setting Traverse role
-		// because setting traverse role walks upwards in the directory tree
-		// and therefore there is no reason for recursion.
-		if _, ok := roles[Traverse]; ok && len(roles) == 1 {
-			recursion = false
-		}
-
-		if rolesNew, err := roler.DelRoles(f, roles, recursion, false); err == nil {
-			chanOut <- RolePathMap{Path: f.Path, RoleMap: rolesNew}
-		} else {
+		rolesNew, err := r.updateRoles(roler, f, roles, true)
+		r.visit(f, roles, err)
+		if err != nil {
 			log.Errorf("%s: %s", err, f.Path)
+			return
 		}
+		chanOut <- RolePathMap{Path: f.Path, RoleMap: rolesNew}
 	}
 
 	// launch parallel go routines for deleting ACL
@@ -538,6 +897,11 @@ func (r Runner) goDelRoles(roles RoleMap, chanF chan ufp.FilePathMode, nthreads
 		for i := 0; i < nthreads; i++ {
 			go func() {
 				for f := range chanF {
+					// drain the remaining paths once the ctx is cancelled.
+					if ctx.Err() != nil {
+						r.skip()
+						continue
+					}
 					log.Debugf("processing file: %s", f.Path)
 					updateACL(f)
 				}
@@ -551,6 +915,38 @@ func (r Runner) goDelRoles(roles RoleMap, chanF chan ufp.FilePathMode, nthreads
 	return chanOut
 }
 
+// updateRoles sets, or removes if `remove` is true, the `roles` on the path `f` with the
+// `roler`, and marks the path done in the journal, if any.
+func (r Runner) updateRoles(roler Roler, f ufp.FilePathMode, roles RoleMap, remove bool) (RoleMap, error) {
+
+	// set recursion to true if the roler is implemented with the POSIX ACL.
+	recursion := usePosixACL(roler)
+
+	// set recursion to false if it is only about setting Traverse role
+	// because setting traverse role walks upwards in the directory tree
+	// and therefore there is no reason for recursion.
+	_, ok := roles[Traverse]
+	traverseOnly := ok && len(roles) == 1
+	if traverseOnly {
+		recursion = false
+	}
+
+	defer r.Limiter.Acquire()()
+
+	var rolesNew RoleMap
+	var err error
+	if remove {
+		rolesNew, err = roler.DelRoles(f, roles, recursion, false)
+	} else {
+		rolesNew, err = roler.SetRoles(f, roles, recursion, false)
+	}
+
+	if err == nil && r.journal != nil && !traverseOnly {
+		r.journal.done(f)
+	}
+	return rolesNew, err
+}
+
 // goPrintOut prints out information of paths on which the new ACL has been applied.
 //
 // Optionally, it also resolves the paths on which the traverse role has to be set.
@@ -617,3 +1013,17 @@ func (r Runner) goPrintOut(chanOut chan RolePathMap,
 
 	return chanFt
 }
+
+// visit counts the path visited by the set/delete action into the result, see `runCollector`.
+func (r Runner) visit(f ufp.FilePathMode, roles RoleMap, err error) {
+	if r.collector != nil {
+		r.collector.visit(f, roles, err)
+	}
+}
+
+// skip counts the path skipped by the set/delete action into the result, see `runCollector`.
+func (r Runner) skip() {
+	if r.collector != nil {
+		r.collector.skip()
+	}
+}
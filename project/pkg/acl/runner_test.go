@@ -0,0 +1,59 @@
+package acl
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestValidatePrincipals(t *testing.T) {
+	roles := RoleMap{Manager: {"honlee"}, Viewer: {"edwger", "g:tg"}}
+
+	r := Runner{}
+	if err := r.validatePrincipals(roles); err != nil {
+		t.Errorf("unexpected error without check: %s", err)
+	}
+
+	r.ValidatePrincipal = func(p string) error {
+		if p == "edwger" {
+			return fmt.Errorf("%s: checked out", p)
+		}
+		return nil
+	}
+	err := r.validatePrincipals(roles)
+	if err == nil || err.Error() != "invalid users or groups: edwger: checked out" {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestParseRolesEmptyEntries(t *testing.T) {
+	r := Runner{}
+
+	// role specs of `pdbutil role remove` joining the per-role users and the `-a` users.
+	for name, c := range map[string]struct {
+		spec   map[Role]string
+		expect map[Role][]string
+	}{
+		"only -a": {
+			spec:   map[Role]string{Manager: ",u1", Contributor: ",u1", Writer: ",u1", Viewer: ",u1"},
+			expect: map[Role][]string{Manager: {"u1"}, Contributor: {"u1"}, Writer: {"u1"}, Viewer: {"u1"}},
+		},
+		"only -m": {
+			spec:   map[Role]string{Manager: "u1,", Contributor: ",", Writer: ",", Viewer: ","},
+			expect: map[Role][]string{Manager: {"u1"}},
+		},
+	} {
+		roles, _, err := r.parseRoles(c.spec, false)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", name, err)
+			continue
+		}
+		if !reflect.DeepEqual(roles, c.expect) {
+			t.Errorf("%s: expect roles %v, got %v", name, c.expect, roles)
+		}
+	}
+
+	if _, _, err := r.parseRoles(map[Role]string{Viewer: "u1,g:"}, false); err == nil {
+		t.Errorf("expect error on group without name")
+	}
+}
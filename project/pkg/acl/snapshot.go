@@ -0,0 +1,525 @@
+package acl
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/xattr"
+
+	ufp "github.com/Donders-Institute/tg-toolset-golang/pkg/filepath"
+	log "github.com/Donders-Institute/tg-toolset-golang/pkg/logger"
+)
+
+// snapshotVersion is the version of the ACL snapshot format.
+const snapshotVersion int = 1
+
+// SnapshotHeader is the first record of an ACL snapshot.
+type SnapshotHeader struct {
+	Version int       `json:"version"`
+	Root    string    `json:"root"`
+	Created time.Time `json:"created"`
+}
+
+// SnapshotRecord is the ACL of a path in an ACL snapshot.  The path is relative to the
+// root of the snapshot so that the snapshot can be restored on another root (e.g. after
+// a filer migration).
+//
+// Depending on the roler of the path, the ACL is either the NFSv4 ACEs in the format of
+// `nfs4_getfacl`, or the POSIX access and default ACEs in the format of `getfacl` with
+// the users and groups referred by name.  The NFSv4 flag and mask bits that have no letter
+// in the ACE string are kept in `Nfs4Bits`, in the order of the ACEs; it is left out if
+// none of the ACEs has such bits.
+type SnapshotRecord struct {
+	Path         string            `json:"path"`
+	Nfs4         []string          `json:"nfs4,omitempty"`
+	Nfs4Bits     []SnapshotACEBits `json:"nfs4Bits,omitempty"`
+	Posix        []string          `json:"posix,omitempty"`
+	PosixDefault []string          `json:"posixDefault,omitempty"`
+}
+
+// SnapshotACEBits are the flag and mask bits of an NFSv4 ACE that have no letter in the
+// ACE string, e.g. the flags and masks of the later NFSv4 minor versions.
+type SnapshotACEBits struct {
+	Flag uint32 `json:"flag,omitempty"`
+	Mask uint32 `json:"mask,omitempty"`
+}
+
+// SnapshotSummary contains the counters of an export, restore or verify action.
+type SnapshotSummary struct {
+	// Paths is the number of processed paths.
+	Paths int
+	// Failed is the number of paths on which the action failed.
+	Failed int
+	// Mismatched is the number of paths of which the ACL differs from the snapshot.
+	Mismatched int
+}
+
+// String returns a single-line representation of the summary.
+func (s SnapshotSummary) String() string {
+	return fmt.Sprintf("paths processed: %d, failed: %d, mismatched: %d", s.Paths, s.Failed, s.Mismatched)
+}
+
+// usePosixACL checks if the ACL of the path managed by the `roler` is the POSIX ACL.
+func usePosixACL(roler Roler) bool {
+	switch roler.(type) {
+	case CephFsRoler, PosixRoler:
+		return true
+	default:
+		return false
+	}
+}
+
+// readSnapshotRecord reads the ACL of the path `p` into the SnapshotRecord, with the
+// path relative to the `root`.
+func readSnapshotRecord(root string, p ufp.FilePathMode) (*SnapshotRecord, error) {
+
+	roler := GetRoler(p)
+	if roler == nil {
+		return nil, fmt.Errorf("roler not found")
+	}
+
+	rel, err := filepath.Rel(root, filepath.Clean(p.Path))
+	if err != nil {
+		return nil, err
+	}
+
+	rec := SnapshotRecord{Path: rel}
+
+	if !usePosixACL(roler) {
+		aces, err := getACL(p.Path)
+		if err != nil {
+			return nil, err
+		}
+		rec.Nfs4, rec.Nfs4Bits = snapshotNfs4ACEs(aces)
+		return &rec, nil
+	}
+
+	if rec.Posix, err = readPosixACEs(p.Path, false); err != nil {
+		return nil, err
+	}
+	if p.Mode.IsDir() {
+		if rec.PosixDefault, err = readPosixACEs(p.Path, true); err != nil {
+			return nil, err
+		}
+	}
+	return &rec, nil
+}
+
+// snapshotNfs4ACEs converts the NFSv4 `aces` into the ACE strings and the bits without
+// letter of the SnapshotRecord.  The bits are nil if none of the ACEs has such bits.
+func snapshotNfs4ACEs(aces []ACE) ([]string, []SnapshotACEBits) {
+	strs := make([]string, 0, len(aces))
+	bits := make([]SnapshotACEBits, 0, len(aces))
+	hasBits := false
+	for _, ace := range aces {
+		strs = append(strs, ace.String())
+		bits = append(bits, SnapshotACEBits{Flag: ace.flagBits, Mask: ace.maskBits})
+		hasBits = hasBits || ace.flagBits != 0 || ace.maskBits != 0
+	}
+	if !hasBits {
+		bits = nil
+	}
+	return strs, bits
+}
+
+// nfs4ACEsFromSnapshot converts the NFSv4 ACE strings and the bits without letter of the
+// SnapshotRecord back into the ACEs.
+func nfs4ACEsFromSnapshot(rec SnapshotRecord) ([]ACE, error) {
+	if len(rec.Nfs4Bits) > 0 && len(rec.Nfs4Bits) != len(rec.Nfs4) {
+		return nil, fmt.Errorf("number of NFSv4 ACE bits mismatches the ACEs in snapshot")
+	}
+	aces := make([]ACE, 0, len(rec.Nfs4))
+	for i, s := range rec.Nfs4 {
+		ace, err := parseAce(s)
+		if err != nil {
+			return nil, err
+		}
+		if len(rec.Nfs4Bits) > 0 {
+			ace.flagBits, ace.maskBits = rec.Nfs4Bits[i].Flag, rec.Nfs4Bits[i].Mask
+		}
+		aces = append(aces, *ace)
+	}
+	return aces, nil
+}
+
+// readPosixACEs reads the access ACL (`dflt` is false) or the default ACL (`dflt` is true)
+// of the path in the format of `getfacl`, e.g. `user:honlee:rwx`.
+func readPosixACEs(path string, dflt bool) ([]string, error) {
+	acl, err := getPosixACL(path, dflt)
+	if err != nil {
+		return nil, err
+	}
+	acl.sort()
+
+	var aces []string
+	for _, e := range acl {
+		ace := posixACEFromEntry(e, path)
+		aces = append(aces, fmt.Sprintf("%s:%s:%s", ace.Tag, ace.Qualifier, ace.Permission))
+	}
+	return aces, nil
+}
+
+// writePosixACEs writes the ACEs in the format of `getfacl` to the access ACL (`dflt` is false)
+// or the default ACL (`dflt` is true) of the path.  The default ACL is removed if there is no ACE.
+func writePosixACEs(path string, aces []string, dflt bool) error {
+
+	if dflt && len(aces) == 0 {
+		err := xattr.Remove(path, xattrPosixACLDefault)
+		if e, ok := err.(*xattr.Error); ok && e.Err == xattr.ENOATTR {
+			return nil
+		}
+		return err
+	}
+
+	acl := make(posixACL, 0, len(aces))
+	for _, s := range aces {
+		d := strings.Split(s, ":")
+		if len(d) != 3 {
+			return fmt.Errorf("invalid ACE string: %s", s)
+		}
+		e, err := posixEntryFromACE(PosixACE{Tag: d[0], Qualifier: d[1], Permission: d[2]}, false)
+		if err != nil {
+			return fmt.Errorf("invalid ACE %s: %s", s, err)
+		}
+		acl = append(acl, e)
+	}
+	return setPosixACL(path, acl, dflt)
+}
+
+// resolveSnapshotPath resolves the path of the SnapshotRecord in the `root`.  It returns an
+// error if the resolved path, with the symbolic links evaluated, is outside of the `root`.
+func resolveSnapshotPath(root string, rec SnapshotRecord) (string, error) {
+
+	path := filepath.Join(root, rec.Path)
+
+	rpath, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return "", err
+	}
+
+	if rel, err := filepath.Rel(root, rpath); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("path outside of %s", root)
+	}
+
+	return path, nil
+}
+
+// restoreSnapshotRecord restores the ACL of the SnapshotRecord on the path resolved in the `root`.
+// The POSIX ACL is only restored on the paths of which the current user is a manager.
+func restoreSnapshotRecord(root string, rec SnapshotRecord) error {
+
+	path, err := resolveSnapshotPath(root, rec)
+	if err != nil {
+		return err
+	}
+
+	fpinfo, err := ufp.GetFilePathMode(path)
+	if err != nil {
+		return err
+	}
+
+	roler := GetRoler(*fpinfo)
+	if roler == nil {
+		return fmt.Errorf("roler not found")
+	}
+
+	if !usePosixACL(roler) {
+		if len(rec.Nfs4) == 0 {
+			return fmt.Errorf("no NFSv4 ACL in snapshot")
+		}
+		aces, err := nfs4ACEsFromSnapshot(rec)
+		if err != nil {
+			return err
+		}
+		return setNfs4ACL(path, aces)
+	}
+
+	if len(rec.Posix) == 0 {
+		return fmt.Errorf("no POSIX ACL in snapshot")
+	}
+
+	if !isManager(path, "") {
+		return fmt.Errorf("permission denied: not a manager")
+	}
+
+	return withCapFowner(func() error {
+		if err := writePosixACEs(path, rec.Posix, false); err != nil {
+			return err
+		}
+		if !fpinfo.Mode.IsDir() {
+			return nil
+		}
+		return writePosixACEs(path, rec.PosixDefault, true)
+	})
+}
+
+// ExportACL walks through the `Runner.RootPath` and writes the ACL of every path to `w`
+// as a gzip-compressed snapshot.  The snapshot consists of JSON lines: a SnapshotHeader
+// followed by a SnapshotRecord per path.  Symbolic links are not followed.  The paths of
+// which the ACL cannot be read are left out from the snapshot, and an error is returned
+// with the complete snapshot of the other paths.
+func (r *Runner) ExportACL(w io.Writer) (SnapshotSummary, error) {
+
+	var summary SnapshotSummary
+
+	r.ppath, _ = filepath.EvalSymlinks(r.RootPath)
+	if _, err := ufp.GetFilePathMode(r.ppath); err != nil {
+		return summary, fmt.Errorf("path not found or unaccessible: %s", r.RootPath)
+	}
+
+	zw := gzip.NewWriter(w)
+	enc := json.NewEncoder(zw)
+
+	if err := enc.Encode(SnapshotHeader{Version: snapshotVersion, Root: r.ppath, Created: time.Now()}); err != nil {
+		return summary, err
+	}
+
+	chanF := ufp.GoFastWalk(r.ppath, false, false, r.Nthreads*4)
+
+	// read the ACLs in parallel; write them in sequence.
+	chanR := make(chan *SnapshotRecord, r.Nthreads*4)
+	var failed int
+	var mutex sync.Mutex
+	go func() {
+		var wg sync.WaitGroup
+		wg.Add(r.Nthreads)
+		for i := 0; i < r.Nthreads; i++ {
+			go func() {
+				defer wg.Done()
+				for p := range chanF {
+					if p.Mode&os.ModeSymlink != 0 || isRunnerFile(r.ppath, p.Path) {
+						continue
+					}
+					rec, err := readSnapshotRecord(r.ppath, p)
+					if err != nil {
+						log.Errorf("%s: %s", err, p.Path)
+						mutex.Lock()
+						failed++
+						mutex.Unlock()
+						continue
+					}
+					chanR <- rec
+				}
+			}()
+		}
+		wg.Wait()
+		close(chanR)
+	}()
+
+	var err error
+	for rec := range chanR {
+		if err != nil {
+			// drain the channel to let the workers finish.
+			continue
+		}
+		if err = enc.Encode(rec); err != nil {
+			continue
+		}
+		summary.Paths++
+		if !r.Silence {
+			log.Infof("%s", rec.Path)
+		}
+	}
+	summary.Failed = failed
+	summary.Paths += failed
+
+	if err != nil {
+		return summary, err
+	}
+
+	if err := zw.Close(); err != nil {
+		return summary, err
+	}
+
+	if failed > 0 {
+		return summary, fmt.Errorf("cannot export ACL of %d paths", failed)
+	}
+
+	return summary, nil
+}
+
+// isRunnerFile checks if the path is one of the files created by the Runner in the
+// top-level directory `root`, i.e. the lock file and the journal.
+func isRunnerFile(root, path string) bool {
+	path = filepath.Clean(path)
+	return path == filepath.Join(root, LockFile) || path == journalPath(root)
+}
+
+// readSnapshot reads the SnapshotHeader from the gzip-compressed snapshot `rd`, and returns
+// a channel of the SnapshotRecords in it.  The error of reading the records, if any, is
+// sent to the `chanErr` channel once the record channel is closed.
+func readSnapshot(rd io.Reader, buffer int) (*SnapshotHeader, chan SnapshotRecord, chan error, error) {
+
+	zr, err := gzip.NewReader(rd)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("invalid snapshot: %s", err)
+	}
+
+	dec := json.NewDecoder(bufio.NewReader(zr))
+
+	var header SnapshotHeader
+	if err := dec.Decode(&header); err != nil {
+		return nil, nil, nil, fmt.Errorf("invalid snapshot header: %s", err)
+	}
+	if header.Version != snapshotVersion {
+		return nil, nil, nil, fmt.Errorf("unsupported snapshot version: %d", header.Version)
+	}
+
+	chanR := make(chan SnapshotRecord, buffer)
+	chanErr := make(chan error, 1)
+	go func() {
+		defer close(chanErr)
+		defer close(chanR)
+		for {
+			var rec SnapshotRecord
+			err := dec.Decode(&rec)
+			if err == io.EOF {
+				return
+			}
+			if err != nil {
+				chanErr <- fmt.Errorf("invalid snapshot record: %s", err)
+				return
+			}
+			chanR <- rec
+		}
+	}()
+
+	return &header, chanR, chanErr, nil
+}
+
+// RestoreACL restores the ACLs in the snapshot `rd` created by `ExportACL` on the
+// `Runner.RootPath`, which can be different from the root of the snapshot.  The ACL of a
+// path is replaced as a whole by the one in the snapshot.  Paths in the snapshot that no
+// longer exist are reported as failed; paths not in the snapshot are left untouched.
+//
+// If `verify` is true, the ACL of every restored path is read back and compared with the
+// snapshot.  In dry-run mode, nothing is restored and the paths of which the ACL differs
+// from the snapshot are reported, as `VerifyACL` does.
+func (r *Runner) RestoreACL(rd io.Reader, verify bool) (summary SnapshotSummary, err error) {
+
+	if r.DryRun {
+		return r.VerifyACL(rd)
+	}
+
+	r.ppath, _ = filepath.EvalSymlinks(r.RootPath)
+	fpinfo, err := ufp.GetFilePathMode(r.ppath)
+	if err != nil {
+		return summary, fmt.Errorf("path not found or unaccessible: %s", r.RootPath)
+	}
+
+	header, chanR, chanErr, err := readSnapshot(rd, r.Nthreads*4)
+	if err != nil {
+		return summary, err
+	}
+	log.Infof("restoring snapshot of %s created at %s", header.Root, header.Created.Format(time.RFC3339))
+
+	if fpinfo.Mode.IsDir() {
+		var flock string
+		if flock, err = r.acquireLock(); err != nil {
+			// drain the snapshot reader.
+			for range chanR {
+			}
+			return
+		}
+		defer os.Remove(flock)
+	}
+
+	summary = r.processSnapshot(chanR, func(rec SnapshotRecord) (bool, error) {
+		if err := restoreSnapshotRecord(r.ppath, rec); err != nil {
+			return false, err
+		}
+		if !verify {
+			return true, nil
+		}
+		return verifySnapshotRecord(r.ppath, rec)
+	})
+
+	return summary, <-chanErr
+}
+
+// VerifyACL compares the ACLs on the `Runner.RootPath` with the snapshot `rd` created by
+// `ExportACL`, and reports the paths of which the ACL differs from the snapshot.
+func (r *Runner) VerifyACL(rd io.Reader) (SnapshotSummary, error) {
+
+	r.ppath, _ = filepath.EvalSymlinks(r.RootPath)
+	if _, err := ufp.GetFilePathMode(r.ppath); err != nil {
+		return SnapshotSummary{}, fmt.Errorf("path not found or unaccessible: %s", r.RootPath)
+	}
+
+	_, chanR, chanErr, err := readSnapshot(rd, r.Nthreads*4)
+	if err != nil {
+		return SnapshotSummary{}, err
+	}
+
+	summary := r.processSnapshot(chanR, func(rec SnapshotRecord) (bool, error) {
+		return verifySnapshotRecord(r.ppath, rec)
+	})
+
+	return summary, <-chanErr
+}
+
+// verifySnapshotRecord checks if the ACL of the path resolved in the `root` is identical
+// to the one in the SnapshotRecord.
+func verifySnapshotRecord(root string, rec SnapshotRecord) (bool, error) {
+	path, err := resolveSnapshotPath(root, rec)
+	if err != nil {
+		return false, err
+	}
+
+	fpinfo, err := ufp.GetFilePathMode(path)
+	if err != nil {
+		return false, err
+	}
+
+	now, err := readSnapshotRecord(root, *fpinfo)
+	if err != nil {
+		return false, err
+	}
+
+	return reflect.DeepEqual(*now, rec), nil
+}
+
+// processSnapshot applies the function `f` on the SnapshotRecords from the channel `chanR`
+// in parallel.  The function returns whether the ACL of the path matches the record.
+func (r Runner) processSnapshot(chanR chan SnapshotRecord, f func(rec SnapshotRecord) (bool, error)) SnapshotSummary {
+
+	var summary SnapshotSummary
+	var mutex sync.Mutex
+
+	var wg sync.WaitGroup
+	wg.Add(r.Nthreads)
+	for i := 0; i < r.Nthreads; i++ {
+		go func() {
+			defer wg.Done()
+			for rec := range chanR {
+				ok, err := f(rec)
+
+				mutex.Lock()
+				summary.Paths++
+				switch {
+				case err != nil:
+					summary.Failed++
+					log.Errorf("%s: %s", err, rec.Path)
+				case !ok:
+					summary.Mismatched++
+					log.Warnf("ACL differs from snapshot: %s", rec.Path)
+				case !r.Silence:
+					log.Infof("%s", rec.Path)
+				}
+				mutex.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	return summary
+}
@@ -0,0 +1,187 @@
+package acl
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/pkg/xattr"
+)
+
+// TestSnapshotScratchDir exports, verifies and restores the ACLs of a scratch directory
+// managed by the CephFsRoler.  It is skipped if the filesystem does not support the POSIX ACL.
+func TestSnapshotScratchDir(t *testing.T) {
+	dir, err := ioutil.TempDir(os.Getenv("TG_TOOLSET_SCRATCH"), "snapshot")
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// check ACL support of the filesystem
+	acl, err := getPosixACL(dir, false)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if err := setPosixACL(dir, acl, false); err != nil {
+		if e, ok := err.(*xattr.Error); ok && e.Err == syscall.EOPNOTSUPP {
+			t.Skipf("posix acl not supported: %s", dir)
+		}
+		t.Fatalf("%s", err)
+	}
+
+	// manage the scratch directory with the CephFsRoler.
+	base := filepath.Dir(dir)
+	RolerMap[base] = CephFsRoler{}
+	defer delete(RolerMap, base)
+
+	sub := filepath.Join(dir, "sub")
+	if err := os.Mkdir(sub, 0755); err != nil {
+		t.Fatalf("%s", err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(sub, "f"), []byte("test"), 0644); err != nil {
+		t.Fatalf("%s", err)
+	}
+	if err := updatePosixACL(sub, []PosixACE{{Tag: "user", Qualifier: "nobody", Permission: "r-X"}}, false); err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	runner := Runner{RootPath: dir, Nthreads: 2, Silence: true}
+
+	var snapshot bytes.Buffer
+	summary, err := runner.ExportACL(&snapshot)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if summary.Paths != 3 || summary.Failed != 0 {
+		t.Errorf("unexpected export summary: %s", summary)
+	}
+
+	// change the ACLs after the snapshot.
+	if err := updatePosixACL(sub, []PosixACE{{Tag: "user", Qualifier: "nobody", Permission: "r-X"}}, true); err != nil {
+		t.Fatalf("%s", err)
+	}
+	if err := updatePosixACL(dir, []PosixACE{{Tag: "user", Qualifier: "nobody", Permission: "r-X", Default: true}}, false); err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	summary, err = runner.VerifyACL(bytes.NewReader(snapshot.Bytes()))
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if summary.Mismatched != 2 {
+		t.Errorf("expect 2 mismatched paths: %s", summary)
+	}
+
+	summary, err = runner.RestoreACL(bytes.NewReader(snapshot.Bytes()), true)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if summary.Paths != 3 || summary.Mismatched != 0 || summary.Failed != 0 {
+		t.Errorf("unexpected restore summary: %s", summary)
+	}
+
+	out, _, _ := getPosixACEs(sub)
+	if len(out) != 1 || out[0].Qualifier != "nobody" {
+		t.Errorf("unexpected ACEs after restore: %+v", out)
+	}
+	if dacl, _ := getPosixACL(dir, true); len(dacl) != 0 {
+		t.Errorf("unexpected default ACL after restore: %+v", dacl)
+	}
+}
+
+func TestResolveSnapshotPath(t *testing.T) {
+	dir, err := ioutil.TempDir("", "snapshot")
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	defer os.RemoveAll(dir)
+	dir, _ = filepath.EvalSymlinks(dir)
+
+	root := filepath.Join(dir, "root")
+	if err := os.MkdirAll(filepath.Join(root, "sub"), 0755); err != nil {
+		t.Fatalf("%s", err)
+	}
+	if err := os.Symlink(dir, filepath.Join(root, "link")); err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	for _, c := range []struct {
+		path string
+		ok   bool
+	}{
+		{".", true},
+		{"sub", true},
+		{"sub/../sub", true},
+		{"..", false},
+		{"../root/../..", false},
+		{"link", false},
+		{"link/root/sub", true},
+	} {
+		_, err := resolveSnapshotPath(root, SnapshotRecord{Path: c.path})
+		if (err == nil) != c.ok {
+			t.Errorf("%s: unexpected error %v", c.path, err)
+		}
+	}
+}
+
+func TestSnapshotNfs4Bits(t *testing.T) {
+	data := []byte{
+		0, 0, 0, 1, // number of ACEs
+		0, 0, 0, 0, // type: ALLOW
+		0, 0, 0x01, 0x03, // flag: FILE_INHERIT|DIRECTORY_INHERIT and an unknown bit
+		0x10, 0, 0, 0x01, // mask: READ_DATA and an unknown bit
+		0, 0, 0, 4, // length of principle
+		'a', 'b', 'c', '@',
+	}
+
+	aces, err := decodeNfs4ACL(data)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	// the unknown bits survive the JSON round trip of the snapshot record.
+	rec := SnapshotRecord{Path: "."}
+	rec.Nfs4, rec.Nfs4Bits = snapshotNfs4ACEs(aces)
+	js, err := json.Marshal(rec)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	var recIn SnapshotRecord
+	if err := json.Unmarshal(js, &recIn); err != nil {
+		t.Fatalf("%s", err)
+	}
+	acesIn, err := nfs4ACEsFromSnapshot(recIn)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	dataOut, err := encodeNfs4ACL(acesIn)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if !bytes.Equal(data, dataOut) {
+		t.Errorf("expect %v but got %v", data, dataOut)
+	}
+
+	// the bits are left out if no ACE has them.
+	if _, bits := snapshotNfs4ACEs([]ACE{{Type: "A", Principle: "abc@", Mask: "r"}}); bits != nil {
+		t.Errorf("unexpected ACE bits: %+v", bits)
+	}
+}
+
+func TestIsRunnerFile(t *testing.T) {
+	root := "/project/3010000.01"
+	for p, expect := range map[string]bool{
+		filepath.Join(root, LockFile):                     true,
+		journalPath(root):                                 true,
+		filepath.Join(root, "sub", LockFile):              false,
+		filepath.Join(root, "sub", ".prj_setacl.journal"): false,
+	} {
+		if isRunnerFile(root, p) != expect {
+			t.Errorf("expect runner file %t: %s", expect, p)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package acl
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	log "github.com/Donders-Institute/tg-toolset-golang/pkg/logger"
+)
+
+// controlInterval is the interval at which the control file is checked for changes.
+const controlInterval = time.Second
+
+// startThrottle adjusts the `Runner.Limiter` while the set/delete action is running: the
+// SIGUSR1 signal slows down the operations by halving the rate, and the SIGUSR2 signal
+// reverts the last slow-down; the limits are also reloaded from the `Runner.ControlFile`
+// whenever the file is modified.  It returns a function to stop the adjustments.  Nothing
+// is adjusted if the limiter is not set.
+func (r Runner) startThrottle() (stop func()) {
+
+	if r.Limiter == nil {
+		return func() {}
+	}
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGUSR1, syscall.SIGUSR2)
+
+	// the limits are loaded from an existing control file when the action starts.
+	var mtime time.Time
+	reload := func() {
+		if r.ControlFile == "" {
+			return
+		}
+		fi, err := os.Stat(r.ControlFile)
+		if err != nil || fi.ModTime().Equal(mtime) {
+			return
+		}
+		mtime = fi.ModTime()
+		if err := r.Limiter.LoadControl(r.ControlFile); err != nil {
+			log.Errorf("cannot load control file: %s", err)
+			return
+		}
+		rate, concurrency := r.Limiter.Limits()
+		log.Warnf("limits reloaded from %s: rate %.1f ops/s, concurrency %d", r.ControlFile, rate, concurrency)
+	}
+	reload()
+
+	ticker := time.NewTicker(controlInterval)
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		for {
+			select {
+			case s := <-sigs:
+				switch s {
+				case syscall.SIGUSR1:
+					log.Warnf("slowing down to %.1f ops/s", r.Limiter.SlowDown())
+				case syscall.SIGUSR2:
+					log.Warnf("speeding up to %.1f ops/s (0 for no limit)", r.Limiter.SpeedUp())
+				}
+			case <-ticker.C:
+				reload()
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		signal.Stop(sigs)
+		ticker.Stop()
+		close(done)
+		<-stopped
+	}
+}
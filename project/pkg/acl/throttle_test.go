@@ -0,0 +1,57 @@
+package acl
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	ufp "github.com/Donders-Institute/tg-toolset-golang/pkg/filepath"
+)
+
+// waitRate waits for the rate of the limiter `l` to become `rate`, and returns the rate
+// of the limiter at the end of the wait.
+func waitRate(l *ufp.RateLimiter, rate float64) float64 {
+	for i := 0; i < 50; i++ {
+		if r, _ := l.Limits(); r == rate {
+			return r
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	r, _ := l.Limits()
+	return r
+}
+
+func TestStartThrottle(t *testing.T) {
+	dir, err := ioutil.TempDir("", "throttle")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	fctl := filepath.Join(dir, "control")
+	if err := ioutil.WriteFile(fctl, []byte("rate = 80\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	r := Runner{Limiter: ufp.NewRateLimiter(100, 4), ControlFile: fctl}
+	stop := r.startThrottle()
+	defer stop()
+
+	// the limits are loaded from the control file at the start.
+	if rate := waitRate(r.Limiter, 80); rate != 80 {
+		t.Errorf("expect rate 80 from control file but got %f", rate)
+	}
+
+	syscall.Kill(os.Getpid(), syscall.SIGUSR1)
+	if rate := waitRate(r.Limiter, 40); rate != 40 {
+		t.Errorf("expect rate 40 after SIGUSR1 but got %f", rate)
+	}
+
+	syscall.Kill(os.Getpid(), syscall.SIGUSR2)
+	if rate := waitRate(r.Limiter, 80); rate != 80 {
+		t.Errorf("expect rate 80 after SIGUSR2 but got %f", rate)
+	}
+}
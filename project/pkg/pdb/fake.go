@@ -0,0 +1,343 @@
+package pdb
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Fake implements the `PDB` interface with an in-memory project database loaded
+// from a YAML or JSON fixture file.  It is meant for testing the tools offline,
+// without connection to the MySQL database or the core api.
+//
+// An example of the fixture file:
+//
+//	projects:
+//	  - id: "3010000.01"
+//	    name: "Test project"
+//	    owner: honlee
+//	    status: active
+//	    members:
+//	      - {userID: honlee, role: manager}
+//	users:
+//	  - id: honlee
+//	    firstName: Hurng-Chun
+//	    lastName: Lee
+//	    email: h.lee@donders.ru.nl
+//	    status: CheckedIn
+//	    function: ResearchSupport
+//	pendingActions:
+//	  "3010000.01":
+//	    members:
+//	      - {userID: edwger, role: viewer}
+//	    storage: {quotaGb: 10, system: netapp}
+//	labBookings:
+//	  - lab: MRI
+//	    project: "3010000.01"
+//	    subject: "sub-01"
+//	    session: "ses-01"
+//	    modality: PRISMA
+//	    operator: honlee
+//	    start: "2020-04-22T09:00:00+02:00"
+//
+// The project status, user status and user function take the names used by the core api.
+type Fake struct {
+	mutex    *sync.Mutex
+	projects []*Project
+	users    []*User
+	actions  map[string]*DataProjectUpdate
+	bookings []fakeLabBooking
+}
+
+// fakeLabBooking is a lab booking of the fake project database.
+type fakeLabBooking struct {
+	lab     Lab
+	booking LabBooking
+}
+
+// fakeMember is the fixture data structure of a `Member`.
+type fakeMember struct {
+	UserID string `yaml:"userID"`
+	Role   string `yaml:"role"`
+}
+
+// fakeFixture is the data structure of the fixture file of the fake project database.
+type fakeFixture struct {
+	Projects []struct {
+		ID      string       `yaml:"id"`
+		Name    string       `yaml:"name"`
+		Owner   string       `yaml:"owner"`
+		Status  string       `yaml:"status"`
+		Members []fakeMember `yaml:"members"`
+	} `yaml:"projects"`
+	Users []struct {
+		ID         string `yaml:"id"`
+		FirstName  string `yaml:"firstName"`
+		MiddleName string `yaml:"middleName"`
+		LastName   string `yaml:"lastName"`
+		Email      string `yaml:"email"`
+		Status     string `yaml:"status"`
+		Function   string `yaml:"function"`
+	} `yaml:"users"`
+	PendingActions map[string]struct {
+		Members []fakeMember `yaml:"members"`
+		Storage struct {
+			QuotaGb int    `yaml:"quotaGb"`
+			System  string `yaml:"system"`
+		} `yaml:"storage"`
+	} `yaml:"pendingActions"`
+	LabBookings []struct {
+		Lab      string `yaml:"lab"`
+		Project  string `yaml:"project"`
+		Subject  string `yaml:"subject"`
+		Session  string `yaml:"session"`
+		Modality string `yaml:"modality"`
+		Operator string `yaml:"operator"`
+		Start    string `yaml:"start"`
+	} `yaml:"labBookings"`
+}
+
+// NewFake loads the fake project database from the given `fixture` file.
+func NewFake(fixture string) (*Fake, error) {
+
+	if fixture == "" {
+		return nil, fmt.Errorf("fixture file of the fake pdb not specified")
+	}
+
+	data, err := ioutil.ReadFile(fixture)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read fixture %s: %s", fixture, err)
+	}
+
+	var f fakeFixture
+	if err := yaml.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("cannot parse fixture %s: %s", fixture, err)
+	}
+
+	fake := Fake{
+		mutex:   &sync.Mutex{},
+		actions: make(map[string]*DataProjectUpdate),
+	}
+
+	for _, p := range f.Projects {
+		fake.projects = append(fake.projects, &Project{
+			ID:      p.ID,
+			Name:    p.Name,
+			Owner:   p.Owner,
+			Status:  parseProjectStatusV2(p.Status),
+			Members: fakeMembers(p.Members),
+		})
+	}
+
+	for _, u := range f.Users {
+		fake.users = append(fake.users, &User{
+			ID:         u.ID,
+			Firstname:  u.FirstName,
+			Middlename: u.MiddleName,
+			Lastname:   u.LastName,
+			Email:      u.Email,
+			Status:     parseUserStatusV2(u.Status),
+			Function:   parseUserFunctionV2(u.Function),
+		})
+	}
+
+	for pid, a := range f.PendingActions {
+		fake.actions[pid] = &DataProjectUpdate{
+			Members: fakeMembers(a.Members),
+			Storage: Storage{
+				QuotaGb: a.Storage.QuotaGb,
+				System:  a.Storage.System,
+			},
+		}
+	}
+
+	for _, b := range f.LabBookings {
+		var lab Lab
+		if err := lab.Set(b.Lab); err != nil {
+			return nil, fmt.Errorf("invalid lab booking in fixture %s: %s", fixture, err)
+		}
+		start, err := time.Parse(time.RFC3339, b.Start)
+		if err != nil {
+			return nil, fmt.Errorf("invalid lab booking in fixture %s: %s", fixture, err)
+		}
+		booking := LabBooking{
+			Project:   b.Project,
+			Subject:   b.Subject,
+			Session:   b.Session,
+			Modality:  b.Modality,
+			Operator:  User{ID: b.Operator},
+			StartTime: start,
+		}
+		if booking.Session == "" {
+			booking.Session = "1"
+		}
+		fake.bookings = append(fake.bookings, fakeLabBooking{lab: lab, booking: booking})
+	}
+
+	return &fake, nil
+}
+
+// fakeMembers converts the members in the fixture into `Member`s.
+func fakeMembers(members []fakeMember) []Member {
+	mems := make([]Member, 0, len(members))
+	for _, m := range members {
+		mems = append(mems, Member{UserID: m.UserID, Role: strings.ToLower(m.Role)})
+	}
+	return mems
+}
+
+// copyProject returns a copy of the project so that the fake project database is
+// not altered by the caller.
+func copyProject(p *Project) *Project {
+	c := *p
+	c.Members = append([]Member{}, p.Members...)
+	return &c
+}
+
+// GetProjectPendingActions returns the pending project actions of the fake project database.
+func (f *Fake) GetProjectPendingActions() (map[string]*DataProjectUpdate, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	actions := make(map[string]*DataProjectUpdate)
+	for pid, a := range f.actions {
+		c := *a
+		c.Members = append([]Member{}, a.Members...)
+		actions[pid] = &c
+	}
+	return actions, nil
+}
+
+// DelProjectPendingActions removes the member roles in the given `actions` from the
+// pending project actions of the fake project database.  A project is removed from
+// the pending actions when it has no pending member roles left.
+func (f *Fake) DelProjectPendingActions(actions map[string]*DataProjectUpdate) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	for pid, act := range actions {
+		a, ok := f.actions[pid]
+		if !ok {
+			continue
+		}
+		mems := make([]Member, 0, len(a.Members))
+		for _, m := range a.Members {
+			performed := false
+			for _, pm := range act.Members {
+				if m.UserID == pm.UserID && m.Role == pm.Role {
+					performed = true
+					break
+				}
+			}
+			if !performed {
+				mems = append(mems, m)
+			}
+		}
+		if len(mems) == 0 {
+			delete(f.actions, pid)
+			continue
+		}
+		a.Members = mems
+	}
+	return nil
+}
+
+// GetProjects returns the projects of the fake project database.  If `activeOnly` is `true`,
+// only the active projects are returned.
+func (f *Fake) GetProjects(activeOnly bool) ([]*Project, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	projects := make([]*Project, 0)
+	for _, p := range f.projects {
+		if activeOnly && p.Status != ProjectStatusActive {
+			continue
+		}
+		projects = append(projects, copyProject(p))
+	}
+	return projects, nil
+}
+
+// GetProject returns the project identified by the `projectID` in the fake project database.
+func (f *Fake) GetProject(projectID string) (*Project, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	for _, p := range f.projects {
+		if p.ID == projectID {
+			return copyProject(p), nil
+		}
+	}
+	return nil, fmt.Errorf("project not found: %s", projectID)
+}
+
+// GetUser returns the user identified by the `userID` in the fake project database.
+func (f *Fake) GetUser(userID string) (*User, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if u := f.findUser(func(u *User) bool { return u.ID == userID }); u != nil {
+		return u, nil
+	}
+	return nil, fmt.Errorf("user not found: %s", userID)
+}
+
+// GetUserByEmail returns the user identified by the `email` in the fake project database.
+// The email address is matched case-insensitively.
+func (f *Fake) GetUserByEmail(email string) (*User, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if u := f.findUser(func(u *User) bool { return strings.EqualFold(u.Email, email) }); u != nil {
+		return u, nil
+	}
+	return nil, fmt.Errorf("user not found: %s", email)
+}
+
+// findUser returns a copy of the first user satisfying the `match` function, or `nil`
+// if there is no such user.
+func (f *Fake) findUser(match func(u *User) bool) *User {
+	for _, u := range f.users {
+		if match(u) {
+			c := *u
+			return &c
+		}
+	}
+	return nil
+}
+
+// GetLabBookings returns the bookings of the given `Lab` on a given `date` string in the
+// fake project database.  The `date` string is in the format of `2020-04-22`.
+func (f *Fake) GetLabBookings(lab Lab, date string) ([]*LabBooking, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	day, err := time.ParseInLocation("2006-01-02", date, time.Local)
+	if err != nil {
+		return nil, fmt.Errorf("invalid date %s: %s", date, err)
+	}
+
+	bookings := make([]*LabBooking, 0)
+	for _, b := range f.bookings {
+		if b.lab != lab {
+			continue
+		}
+		if t := b.booking.StartTime.In(time.Local); t.Before(day) || !t.Before(day.AddDate(0, 0, 1)) {
+			continue
+		}
+		c := b.booking
+		if u := f.findUser(func(u *User) bool { return u.ID == c.Operator.ID }); u != nil {
+			c.Operator = *u
+		}
+		bookings = append(bookings, &c)
+	}
+
+	sort.Slice(bookings, func(i, j int) bool { return bookings[i].StartTime.Before(bookings[j].StartTime) })
+
+	return bookings, nil
+}
@@ -0,0 +1,126 @@
+package pdb
+
+import (
+	"testing"
+
+	"github.com/Donders-Institute/tg-toolset-golang/pkg/config"
+)
+
+func newTestFake(t *testing.T) PDB {
+	f, err := New(config.PDBConfiguration{
+		Version: config.PDBVersionFake,
+		Fake:    config.FakePDBConfiguration{Fixture: "testdata/fake.yml"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+func TestNewFakeVersion(t *testing.T) {
+	// the fake project database is selected by the version 0.
+	if _, err := New(config.PDBConfiguration{Fake: config.FakePDBConfiguration{Fixture: "testdata/fake.yml"}}); err != nil {
+		t.Errorf("unexpected error on pdb version 0: %s", err)
+	}
+	// but not by a configuration without the version.
+	if _, err := New(config.PDBConfiguration{Version: config.PDBVersionUnset}); err == nil {
+		t.Errorf("expect error on pdb without version")
+	}
+}
+
+func TestFakeProjects(t *testing.T) {
+	f := newTestFake(t)
+
+	if projects, _ := f.GetProjects(true); len(projects) != 1 {
+		t.Errorf("expect 1 active project, got %d", len(projects))
+	}
+	if projects, _ := f.GetProjects(false); len(projects) != 2 {
+		t.Errorf("expect 2 projects, got %d", len(projects))
+	}
+
+	p, err := f.GetProject("3010000.01")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Owner != "honlee" || p.Status != ProjectStatusActive || len(p.Members) != 2 {
+		t.Errorf("unexpected project: %+v", p)
+	}
+
+	// altering the returned project should not change the fake pdb.
+	p.Members[0].Role = "viewer"
+	if p, _ := f.GetProject("3010000.01"); p.Members[0].Role != "manager" {
+		t.Errorf("fake pdb altered by the caller: %+v", p)
+	}
+
+	if _, err := f.GetProject("3010000.99"); err == nil {
+		t.Errorf("expect error for unknown project")
+	}
+}
+
+func TestFakeUsers(t *testing.T) {
+	f := newTestFake(t)
+
+	u, err := f.GetUser("edwger")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Status != UserStatusCheckedOutExtended || u.Function != UserFunctionPhD {
+		t.Errorf("unexpected user: %+v", u)
+	}
+
+	u, err = f.GetUserByEmail("H.Lee@donders.ru.nl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.ID != "honlee" {
+		t.Errorf("unexpected user: %+v", u)
+	}
+
+	if _, err := f.GetUser("nobody"); err == nil {
+		t.Errorf("expect error for unknown user")
+	}
+}
+
+func TestFakePendingActions(t *testing.T) {
+	f := newTestFake(t)
+
+	actions, err := f.GetProjectPendingActions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a, ok := actions["3010000.01"]; !ok || len(a.Members) != 2 || a.Storage.QuotaGb != 10 {
+		t.Fatalf("unexpected pending actions: %+v", actions)
+	}
+
+	f.DelProjectPendingActions(map[string]*DataProjectUpdate{
+		"3010000.01": {Members: []Member{{UserID: "edwger", Role: "viewer"}}},
+	})
+	if actions, _ := f.GetProjectPendingActions(); len(actions["3010000.01"].Members) != 1 {
+		t.Errorf("unexpected pending actions: %+v", actions["3010000.01"])
+	}
+
+	f.DelProjectPendingActions(map[string]*DataProjectUpdate{
+		"3010000.01": {Members: []Member{{UserID: "rendbru", Role: "contributor"}}},
+	})
+	if actions, _ := f.GetProjectPendingActions(); len(actions) != 0 {
+		t.Errorf("expect no pending actions, got %+v", actions)
+	}
+}
+
+func TestFakeLabBookings(t *testing.T) {
+	f := newTestFake(t)
+
+	bookings, err := f.GetLabBookings(MRI, "2020-04-22")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bookings) != 2 {
+		t.Fatalf("expect 2 bookings, got %d", len(bookings))
+	}
+	if b := bookings[0]; b.Subject != "sub-01" || b.Session != "1" || b.Operator.Email != "h.lee@donders.ru.nl" {
+		t.Errorf("unexpected booking: %+v", b)
+	}
+	if b := bookings[1]; b.Subject != "sub-02" || b.Session != "ses-01" {
+		t.Errorf("unexpected booking: %+v", b)
+	}
+}
@@ -21,9 +21,18 @@ func init() {
 }
 
 // New returns the `PDBClient` corresponding to the given
-// PDB `version`.
+// PDB `version`.  The version `config.PDBVersionFake` (0) refers to
+// the `Fake` project database loaded from a fixture file.
 func New(c config.PDBConfiguration) (PDB, error) {
 	switch c.Version {
+	case config.PDBVersionUnset:
+		return nil, fmt.Errorf("pdb version not configured")
+	case config.PDBVersionFake:
+		fake, err := NewFake(c.Fake.Fixture)
+		if err != nil {
+			return nil, err
+		}
+		return fake, nil
 	case 1:
 		return V1{config: c.V1}, nil
 	case 2:
@@ -60,6 +60,9 @@ type Project struct {
 	Name   string        `json:"projectName"`
 	Owner  string        `json:"owner"`
 	Status ProjectStatus `json:"status"`
+	// Members contains the data-access roles of the project members registered
+	// in the project database.
+	Members []Member `json:"members,omitempty"`
 }
 
 // ProjectStatus defines PDB project status.
@@ -252,6 +252,15 @@ func (v1 V1) GetProjects(activeOnly bool) ([]*Project, error) {
 		return nil, err
 	}
 
+	// attach project members
+	members, err := selectProjectMembers(db, "")
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range projects {
+		p.Members = members[p.ID]
+	}
+
 	return projects, nil
 }
 
@@ -290,14 +299,60 @@ func (v1 V1) GetProject(projectID string) (*Project, error) {
 		return nil, err
 	}
 
+	members, err := selectProjectMembers(db, pid)
+	if err != nil {
+		return nil, err
+	}
+
 	return &Project{
-		ID:     pid,
-		Name:   pname,
-		Owner:  oid,
-		Status: parseProjectStatusByCalculatedSpace(cspace),
+		ID:      pid,
+		Name:    pname,
+		Owner:   oid,
+		Status:  parseProjectStatusByCalculatedSpace(cspace),
+		Members: members[pid],
 	}, nil
 }
 
+// selectProjectMembers gets the data-access roles of the members of the given project, or
+// of all projects if `project` is empty, from the `acls` table of the project database.
+// It returns a map with project id as key and the project members as value.
+func selectProjectMembers(db *sql.DB, project string) (map[string][]Member, error) {
+
+	query := `
+	SELECT
+		project, projectRole, user
+	FROM
+		acls
+	`
+
+	args := []interface{}{}
+	if project != "" {
+		query += `
+		WHERE
+			project=?
+		`
+		args = append(args, project)
+	}
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	members := make(map[string][]Member)
+	for rows.Next() {
+		var pid string
+		var m Member
+		if err := rows.Scan(&pid, &m.Role, &m.UserID); err != nil {
+			return nil, err
+		}
+		members[pid] = append(members[pid], m)
+	}
+
+	return members, rows.Err()
+}
+
 // parseProjectStatusByCalculatedSpace interprets the project status by
 // the calculated space.
 func parseProjectStatusByCalculatedSpace(space int) ProjectStatus {
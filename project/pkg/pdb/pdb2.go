@@ -2,6 +2,9 @@ package pdb
 
 import (
 	"fmt"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/shurcooL/graphql"
 
@@ -72,25 +75,96 @@ func (v2 V2) GetProjectPendingActions() (map[string]*DataProjectUpdate, error) {
 
 // GetProjects retrieves list of project identifiers from the project database.
 func (v2 V2) GetProjects(activeOnly bool) ([]*Project, error) {
-	return nil, fmt.Errorf("not implemented")
+
+	var qry struct {
+		Projects []coreAPIProject `graphql:"projects"`
+	}
+
+	if err := query(v2.config.AuthClientSecret, v2.config.AuthURL, v2.config.CoreAPIURL, &qry, nil); err != nil {
+		log.Errorf("fail to query projects: %s", err)
+		return nil, err
+	}
+
+	projects := make([]*Project, 0, len(qry.Projects))
+	for _, p := range qry.Projects {
+		prj := p.toProject()
+		if activeOnly && prj.Status != ProjectStatusActive {
+			continue
+		}
+		projects = append(projects, prj)
+	}
+
+	return projects, nil
 }
 
 // GetProject retrieves attributes of a project.
 func (v2 V2) GetProject(projectID string) (*Project, error) {
-	return nil, fmt.Errorf("not implemented")
+
+	var qry struct {
+		Project *coreAPIProject `graphql:"project(number: $id)"`
+	}
+
+	vars := map[string]interface{}{
+		"id": graphql.ID(projectID),
+	}
+
+	if err := query(v2.config.AuthClientSecret, v2.config.AuthURL, v2.config.CoreAPIURL, &qry, vars); err != nil {
+		log.Errorf("fail to query project: %s", err)
+		return nil, err
+	}
+
+	if qry.Project == nil {
+		return nil, fmt.Errorf("project not found: %s", projectID)
+	}
+
+	return qry.Project.toProject(), nil
 }
 
 // GetUser gets the user identified by the given uid in the project database.
 // It returns the pointer to the user data represented in the User data structure.
 func (v2 V2) GetUser(uid string) (*User, error) {
 
-	return &User{}, nil
+	var qry struct {
+		User *coreAPIUser `graphql:"user(username: $id)"`
+	}
+
+	vars := map[string]interface{}{
+		"id": graphql.ID(uid),
+	}
+
+	if err := query(v2.config.AuthClientSecret, v2.config.AuthURL, v2.config.CoreAPIURL, &qry, vars); err != nil {
+		log.Errorf("fail to query user: %s", err)
+		return nil, err
+	}
+
+	if qry.User == nil {
+		return nil, fmt.Errorf("user not found: %s", uid)
+	}
+
+	return qry.User.toUser(), nil
 }
 
 // GetUserByEmail gets the user identified by the given email address.
 func (v2 V2) GetUserByEmail(email string) (*User, error) {
 
-	return nil, fmt.Errorf("not implemented")
+	var qry struct {
+		User *coreAPIUser `graphql:"userByEmail(email: $email)"`
+	}
+
+	vars := map[string]interface{}{
+		"email": graphql.String(email),
+	}
+
+	if err := query(v2.config.AuthClientSecret, v2.config.AuthURL, v2.config.CoreAPIURL, &qry, vars); err != nil {
+		log.Errorf("fail to query user by email: %s", err)
+		return nil, err
+	}
+
+	if qry.User == nil {
+		return nil, fmt.Errorf("user not found: %s", email)
+	}
+
+	return qry.User.toUser(), nil
 }
 
 // GetLabBookings retrieves calendar bookings concerning the given `Lab` on a given `date` string.
@@ -98,9 +172,204 @@ func (v2 V2) GetUserByEmail(email string) (*User, error) {
 func (v2 V2) GetLabBookings(lab Lab, date string) ([]*LabBooking, error) {
 	bookings := make([]*LabBooking, 0)
 
+	start, err := time.ParseInLocation("2006-01-02", date, time.Local)
+	if err != nil {
+		return nil, fmt.Errorf("invalid date: %s", date)
+	}
+
+	// DateTime aligns to the `DateTime` scalar type of the core api; the type name is
+	// translated directly into the GraphQL type by the graphql library.
+	type DateTime string
+
+	var qry struct {
+		BookingEvents []struct {
+			Start   graphql.String
+			Status  graphql.String
+			Subject graphql.String
+			Session graphql.String
+			Project struct {
+				Number graphql.String
+				Title  graphql.String
+			}
+			Lab struct {
+				Description graphql.String
+			}
+			Operator coreAPIUser
+		} `graphql:"bookingEvents(start: $start, end: $end)"`
+	}
+
+	vars := map[string]interface{}{
+		"start": DateTime(start.Format(time.RFC3339)),
+		"end":   DateTime(start.AddDate(0, 0, 1).Format(time.RFC3339)),
+	}
+
+	if err := query(v2.config.AuthClientSecret, v2.config.AuthURL, v2.config.CoreAPIURL, &qry, vars); err != nil {
+		log.Errorf("fail to query lab bookings: %s", err)
+		return nil, err
+	}
+
+	// regular expression for matching lab description
+	labPat, err := lab.GetDescriptionRegex()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, e := range qry.BookingEvents {
+
+		switch strings.ToUpper(string(e.Status)) {
+		case "CONFIRMED", "TENTATIVE":
+		default:
+			continue
+		}
+
+		subj := string(e.Subject)
+		if subj == "" || subj == "Cancellation" || subj == "0" {
+			continue
+		}
+
+		m := labPat.FindStringSubmatch(strings.ToUpper(string(e.Lab.Description)))
+		if len(m) < 2 {
+			continue
+		}
+
+		t, err := time.Parse(time.RFC3339, string(e.Start))
+		if err != nil {
+			log.Errorf("cannot parse time: %s", e.Start)
+			continue
+		}
+
+		sess := string(e.Session)
+		if sess == "" {
+			sess = "1"
+		}
+
+		bookings = append(bookings, &LabBooking{
+			Project:      string(e.Project.Number),
+			Subject:      subj,
+			Session:      sess,
+			Modality:     m[1],
+			ProjectTitle: string(e.Project.Title),
+			Operator:     *e.Operator.toUser(),
+			StartTime:    t,
+		})
+	}
+
+	sort.Slice(bookings, func(i, j int) bool { return bookings[i].StartTime.Before(bookings[j].StartTime) })
+
 	return bookings, nil
 }
 
+// coreAPIUser is the data structure of a user returned by the core api.
+type coreAPIUser struct {
+	Username   graphql.String
+	FirstName  graphql.String
+	MiddleName graphql.String
+	LastName   graphql.String
+	Email      graphql.String
+	Status     graphql.String
+	Function   graphql.String
+}
+
+// toUser converts the coreAPIUser into the User.
+func (u coreAPIUser) toUser() *User {
+	return &User{
+		ID:         string(u.Username),
+		Firstname:  string(u.FirstName),
+		Middlename: string(u.MiddleName),
+		Lastname:   string(u.LastName),
+		Email:      string(u.Email),
+		Status:     parseUserStatusV2(string(u.Status)),
+		Function:   parseUserFunctionV2(string(u.Function)),
+	}
+}
+
+// coreAPIProject is the data structure of a project returned by the core api.
+type coreAPIProject struct {
+	Number graphql.String
+	Title  graphql.String
+	Status graphql.String
+	Owner  struct {
+		Username graphql.String
+	}
+	Members []struct {
+		Member struct {
+			Username graphql.String
+		}
+		Role graphql.String
+	}
+}
+
+// toProject converts the coreAPIProject into the Project.
+func (p coreAPIProject) toProject() *Project {
+	prj := &Project{
+		ID:     string(p.Number),
+		Name:   string(p.Title),
+		Owner:  string(p.Owner.Username),
+		Status: parseProjectStatusV2(string(p.Status)),
+	}
+	for _, m := range p.Members {
+		prj.Members = append(prj.Members, Member{
+			UserID: string(m.Member.Username),
+			Role:   strings.ToLower(string(m.Role)),
+		})
+	}
+	return prj
+}
+
+// parseProjectStatusV2 interprets the core api project status into corresponding `ProjectStatus`.
+func parseProjectStatusV2(s string) ProjectStatus {
+	switch strings.ToLower(s) {
+	case "active":
+		return ProjectStatusActive
+	case "inactive":
+		return ProjectStatusInactive
+	default:
+		return ProjectStatusUnknown
+	}
+}
+
+// parseUserStatusV2 interprets the core api user status into corresponding `UserStatus`.
+func parseUserStatusV2(s string) UserStatus {
+	switch s {
+	case "CheckedIn":
+		return UserStatusCheckedIn
+	case "CheckedOut":
+		return UserStatusCheckedOut
+	case "CheckedOutExtended":
+		return UserStatusCheckedOutExtended
+	case "Tentative":
+		return UserStatusTentative
+	default:
+		return UserStatusUnknown
+	}
+}
+
+// parseUserFunctionV2 interprets the core api user function into corresponding `UserFunction`.
+func parseUserFunctionV2(f string) UserFunction {
+	switch f {
+	case "PrincipalInvestigator":
+		return UserFunctionPrincipalInvestigator
+	case "Trainee":
+		return UserFunctionTrainee
+	case "PhD":
+		return UserFunctionPhD
+	case "Postdoc":
+		return UserFunctionPostdoc
+	case "ResearchSupport":
+		return UserFunctionResearchSupport
+	case "OtherSupport":
+		return UserFunctionOtherSupport
+	case "ResearchStaff":
+		return UserFunctionResearchStaff
+	case "OtherResearcher":
+		return UserFunctionOtherResearcher
+	case "SeniorResearcher":
+		return UserFunctionSeniorResearcher
+	default:
+		return UserFunctionOther
+	}
+}
+
 // getProjectStorageResource retrieves the storage resource of a given project.
 func getProjectStorageResource(conf config.CoreAPIConfiguration, projectID string) (*Storage, error) {
 	var stor Storage
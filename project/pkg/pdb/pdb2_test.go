@@ -0,0 +1,165 @@
+package pdb
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Donders-Institute/tg-toolset-golang/pkg/config"
+)
+
+// stubCoreAPIResponses maps the top-level field of a GraphQL query to the `data` of the
+// response returned by the stub core api.  The fields are matched in order.
+var stubCoreAPIResponses = []struct {
+	field string
+	data  string
+}{
+	{"bookingEvents(", `{"bookingEvents": [
+		{"start": "2020-04-22T13:00:00+02:00", "status": "CONFIRMED", "subject": "sub-02", "session": "ses-01",
+		 "project": {"number": "3010000.01", "title": "Test project"}, "lab": {"description": "PRISMA"},
+		 "operator": {"username": "honlee", "status": "CheckedIn", "function": "ResearchSupport"}},
+		{"start": "2020-04-22T09:00:00+02:00", "status": "TENTATIVE", "subject": "sub-01", "session": "",
+		 "project": {"number": "3010000.01", "title": "Test project"}, "lab": {"description": "SKYRA"},
+		 "operator": {"username": "honlee", "status": "CheckedIn", "function": "ResearchSupport"}},
+		{"start": "2020-04-22T10:00:00+02:00", "status": "CANCELLED", "subject": "sub-03", "session": "ses-01",
+		 "project": {"number": "3010000.01", "title": "Test project"}, "lab": {"description": "PRISMA"},
+		 "operator": {"username": "honlee"}},
+		{"start": "2020-04-22T11:00:00+02:00", "status": "CONFIRMED", "subject": "sub-04", "session": "ses-01",
+		 "project": {"number": "3010000.01", "title": "Test project"}, "lab": {"description": "MEG"},
+		 "operator": {"username": "honlee"}}
+	]}`},
+	{"userByEmail(", `{"userByEmail": {"username": "honlee", "firstName": "Hurng-Chun", "lastName": "Lee",
+		"email": "h.lee@donders.ru.nl", "status": "CheckedIn", "function": "ResearchSupport"}}`},
+	{"user(", `{"user": {"username": "honlee", "firstName": "Hurng-Chun", "lastName": "Lee",
+		"email": "h.lee@donders.ru.nl", "status": "CheckedOutExtended", "function": "PrincipalInvestigator"}}`},
+	{"projects", `{"projects": [
+		{"number": "3010000.01", "title": "Test project", "status": "Active", "owner": {"username": "honlee"},
+		 "members": [{"member": {"username": "honlee"}, "role": "Manager"}, {"member": {"username": "edwger"}, "role": "Viewer"}]},
+		{"number": "3010000.02", "title": "Old project", "status": "Inactive", "owner": {"username": "honlee"}, "members": []}
+	]}`},
+	{"project(", `{"project": {"number": "3010000.01", "title": "Test project", "status": "Active", "owner": {"username": "honlee"},
+		"members": [{"member": {"username": "honlee"}, "role": "Manager"}]}}`},
+}
+
+// newStubCoreAPI starts a local stub server of the authentication service and the GraphQL
+// core api, and returns the V2 interface connected to it.
+func newStubCoreAPI(t *testing.T) (*httptest.Server, V2) {
+
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/connect/token", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"access_token": "stub", "expires_in": 3600, "token_type": "Bearer"}`))
+	})
+
+	mux.HandleFunc("/graphql", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Query     string                 `json:"query"`
+			Variables map[string]interface{} `json:"variables"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		t.Logf("query: %s, variables: %v", req.Query, req.Variables)
+
+		w.Header().Set("Content-Type", "application/json")
+		for _, resp := range stubCoreAPIResponses {
+			if strings.Contains(req.Query, resp.field) {
+				w.Write([]byte(`{"data": ` + resp.data + `}`))
+				return
+			}
+		}
+		w.Write([]byte(`{"errors": [{"message": "unknown query"}]}`))
+	})
+
+	srv := httptest.NewServer(mux)
+
+	return srv, V2{
+		config: config.CoreAPIConfiguration{
+			AuthClientSecret: "secret",
+			AuthURL:          srv.URL,
+			CoreAPIURL:       srv.URL + "/graphql",
+		},
+	}
+}
+
+func TestV2GetProjects(t *testing.T) {
+	srv, v2 := newStubCoreAPI(t)
+	defer srv.Close()
+
+	projects, err := v2.GetProjects(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(projects) != 1 {
+		t.Fatalf("expect 1 active project, got %d", len(projects))
+	}
+	p := projects[0]
+	if p.ID != "3010000.01" || p.Owner != "honlee" || p.Status != ProjectStatusActive {
+		t.Errorf("unexpected project: %+v", p)
+	}
+	if len(p.Members) != 2 || p.Members[1] != (Member{UserID: "edwger", Role: "viewer"}) {
+		t.Errorf("unexpected members: %+v", p.Members)
+	}
+
+	if projects, _ := v2.GetProjects(false); len(projects) != 2 {
+		t.Errorf("expect 2 projects, got %d", len(projects))
+	}
+}
+
+func TestV2GetProject(t *testing.T) {
+	srv, v2 := newStubCoreAPI(t)
+	defer srv.Close()
+
+	p, err := v2.GetProject("3010000.01")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.ID != "3010000.01" || p.Name != "Test project" || len(p.Members) != 1 {
+		t.Errorf("unexpected project: %+v", p)
+	}
+}
+
+func TestV2GetUser(t *testing.T) {
+	srv, v2 := newStubCoreAPI(t)
+	defer srv.Close()
+
+	u, err := v2.GetUser("honlee")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.ID != "honlee" || u.Status != UserStatusCheckedOutExtended || u.Function != UserFunctionPrincipalInvestigator {
+		t.Errorf("unexpected user: %+v", u)
+	}
+
+	u, err = v2.GetUserByEmail("h.lee@donders.ru.nl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Email != "h.lee@donders.ru.nl" || u.Status != UserStatusCheckedIn || u.Function != UserFunctionResearchSupport {
+		t.Errorf("unexpected user: %+v", u)
+	}
+}
+
+func TestV2GetLabBookings(t *testing.T) {
+	srv, v2 := newStubCoreAPI(t)
+	defer srv.Close()
+
+	lab := MRI
+	bookings, err := v2.GetLabBookings(lab, "2020-04-22")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bookings) != 2 {
+		t.Fatalf("expect 2 bookings, got %d", len(bookings))
+	}
+	if b := bookings[0]; b.Subject != "sub-01" || b.Session != "1" || b.Modality != "SKYRA" || b.Operator.ID != "honlee" {
+		t.Errorf("unexpected booking: %+v", b)
+	}
+	if b := bookings[1]; b.Subject != "sub-02" || b.Session != "ses-01" || b.Modality != "PRISMA" {
+		t.Errorf("unexpected booking: %+v", b)
+	}
+}
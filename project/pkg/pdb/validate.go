@@ -0,0 +1,148 @@
+package pdb
+
+import (
+	"fmt"
+	"strings"
+
+	log "github.com/Donders-Institute/tg-toolset-golang/pkg/logger"
+	"github.com/Donders-Institute/tg-toolset-golang/project/pkg/acl"
+)
+
+// UserCheck is an enumerator for how the users are checked against the project database
+// before they are granted a role.
+type UserCheck int
+
+const (
+	// UserCheckNone disables the check.
+	UserCheckNone UserCheck = iota
+	// UserCheckWarn only warns about the invalid users.
+	UserCheckWarn
+	// UserCheckReject rejects the invalid users.
+	UserCheckReject
+)
+
+var userCheckStrings = map[UserCheck]string{
+	UserCheckNone:   "none",
+	UserCheckWarn:   "warn",
+	UserCheckReject: "reject",
+}
+
+// Set implements the interface for flag.Var().
+func (c *UserCheck) Set(v string) error {
+	for k, s := range userCheckStrings {
+		if s == strings.ToLower(v) {
+			*c = k
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown user check: %s", v)
+}
+
+// String implements the interface for flag.Var().  It returns the
+// name of the user check.
+func (c *UserCheck) String() string {
+	return userCheckStrings[*c]
+}
+
+// Type implements the interface for pflag.Var() used by the cobra commands.
+func (c *UserCheck) Type() string {
+	return "check"
+}
+
+// ValidateUser checks whether the user `uid` can be granted a role, according to the user
+// profile in the project database.  It returns an error if the user is unknown to the project
+// database, or has the status checked out, tentative or unknown.
+func ValidateUser(ipdb PDB, uid string) error {
+	u, err := ipdb.GetUser(uid)
+	if err != nil {
+		return fmt.Errorf("%s: unknown user: %s", uid, err)
+	}
+
+	switch u.Status {
+	case UserStatusCheckedIn, UserStatusCheckedOutExtended:
+		return nil
+	case UserStatusCheckedOut:
+		return fmt.Errorf("%s: user checked out", uid)
+	case UserStatusTentative:
+		return fmt.Errorf("%s: user tentative", uid)
+	default:
+		return fmt.Errorf("%s: unknown user status", uid)
+	}
+}
+
+// Check checks the `principals` against the project database with `ValidateUser`.  The
+// groups (see `acl.ParsePrincipal`) are not checked.  With UserCheckReject, an error listing
+// the invalid users is returned; with UserCheckWarn, the invalid users are only logged.
+func (c UserCheck) Check(ipdb PDB, principals ...string) error {
+
+	if c == UserCheckNone {
+		return nil
+	}
+
+	var invalid []string
+	for _, p := range principals {
+		if _, group := acl.ParsePrincipal(p); group {
+			continue
+		}
+		if err := ValidateUser(ipdb, p); err != nil {
+			if c == UserCheckWarn {
+				log.Warnf("%s", err)
+				continue
+			}
+			invalid = append(invalid, err.Error())
+		}
+	}
+
+	if len(invalid) > 0 {
+		return fmt.Errorf("invalid users: %s", strings.Join(invalid, "; "))
+	}
+	return nil
+}
+
+// FilterMembers checks the `members` to be granted a role against the project database with
+// `ValidateUser`; the members to be removed (i.e. with the role `none`) and the groups are not
+// checked.  With UserCheckReject, the members failing the check are left out from the returned
+// members and listed in the returned error; with UserCheckWarn, they are only logged.
+func (c UserCheck) FilterMembers(ipdb PDB, members []Member) ([]Member, error) {
+
+	validate := c.Validator(ipdb)
+	if validate == nil {
+		return members, nil
+	}
+
+	valid := make([]Member, 0, len(members))
+	var invalid []string
+	for _, m := range members {
+		if m.Role != "none" {
+			if err := validate(m.UserID); err != nil {
+				invalid = append(invalid, err.Error())
+				continue
+			}
+		}
+		valid = append(valid, m)
+	}
+
+	if len(invalid) > 0 {
+		return valid, fmt.Errorf("invalid users: %s", strings.Join(invalid, "; "))
+	}
+	return valid, nil
+}
+
+// Validator returns the check of a principal against the project database, to be used
+// as the `acl.Runner.ValidatePrincipal`.  It returns nil for UserCheckNone.
+func (c UserCheck) Validator(ipdb PDB) func(principal string) error {
+	if c == UserCheckNone {
+		return nil
+	}
+	return func(principal string) error {
+		if _, group := acl.ParsePrincipal(principal); group {
+			return nil
+		}
+		err := ValidateUser(ipdb, principal)
+		if err != nil && c == UserCheckWarn {
+			log.Warnf("%s", err)
+			return nil
+		}
+		return err
+	}
+}
@@ -0,0 +1,56 @@
+package pdb
+
+import (
+	"testing"
+)
+
+func TestValidateUser(t *testing.T) {
+	f := newTestFake(t)
+
+	for uid, valid := range map[string]bool{"honlee": true, "edwger": true, "rendbru": false, "nobody": false} {
+		if err := ValidateUser(f, uid); (err == nil) != valid {
+			t.Errorf("%s: expect valid %t but got error %v", uid, valid, err)
+		}
+	}
+
+	// groups are not checked.
+	if err := UserCheckReject.Check(f, "honlee", "g:tg"); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+	if err := UserCheckReject.Check(f, "honlee", "rendbru", "nobody"); err == nil {
+		t.Errorf("expect invalid users rejected")
+	}
+	if err := UserCheckWarn.Check(f, "rendbru"); err != nil {
+		t.Errorf("expect invalid users only warned but got %s", err)
+	}
+
+	if v := UserCheckNone.Validator(f); v != nil {
+		t.Errorf("expect no validator without check")
+	}
+	if err := UserCheckReject.Validator(f)("rendbru"); err == nil {
+		t.Errorf("expect checked out user rejected")
+	}
+
+	// only the invalid grants are left out.
+	members := []Member{
+		{UserID: "honlee", Role: "manager"},
+		{UserID: "rendbru", Role: "viewer"},
+		{UserID: "rendbru", Role: "none"},
+		{UserID: "g:tg", Role: "contributor"},
+	}
+	valid, err := UserCheckReject.FilterMembers(f, members)
+	if err == nil {
+		t.Errorf("expect invalid grants rejected")
+	}
+	if len(valid) != 3 || valid[1].Role != "none" {
+		t.Errorf("unexpected valid members: %+v", valid)
+	}
+	if valid, err := UserCheckWarn.FilterMembers(f, members); err != nil || len(valid) != 4 {
+		t.Errorf("expect invalid grants only warned but got %+v: %v", valid, err)
+	}
+
+	var c UserCheck
+	if err := c.Set("warn"); err != nil || c != UserCheckWarn {
+		t.Errorf("unexpected user check %s: %v", c.String(), err)
+	}
+}
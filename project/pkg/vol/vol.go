@@ -1,6 +1,8 @@
 package vol
 
 import (
+	"fmt"
+	"path/filepath"
 	"strconv"
 	"strings"
 
@@ -20,10 +22,42 @@ type VolumeManager interface {
 // VolumeManagerMap defines a list of supported VolumeManager with associated path as key of
 // the map.  The path is usually refers to the top-level mount point of the
 // fileserver on which the VolumeManager performs actions.
+//
+// It contains the volume managers of the built-in storage systems, and is replaced by the
+// storage systems declared in the configuration via `ConfigureVolumeManagers`.
 var VolumeManagerMap = map[string]VolumeManager{
 	"/project": NetAppVolumeManager{},
 }
 
+// NewVolumeManager returns the VolumeManager of the given `kind`, e.g. `netapp`.
+func NewVolumeManager(kind string) (VolumeManager, error) {
+	switch strings.ToLower(kind) {
+	case "netapp":
+		return NetAppVolumeManager{}, nil
+	default:
+		return nil, fmt.Errorf("unsupported volume manager: %s", kind)
+	}
+}
+
+// ConfigureVolumeManagers replaces the VolumeManagerMap with the volume managers of the
+// storage systems declared in the storage configuration `conf`, with the project root of
+// a storage system as the path.  Storage systems without volume manager are left out.
+func ConfigureVolumeManagers(conf config.StorageConfiguration) error {
+	vmap := make(map[string]VolumeManager)
+	for _, s := range conf.Systems {
+		if s.VolumeManager == "" {
+			continue
+		}
+		m, err := NewVolumeManager(s.VolumeManager)
+		if err != nil {
+			return fmt.Errorf("storage system %s: %s", s.Name, err)
+		}
+		vmap[filepath.Clean(s.ProjectRoot)] = m
+	}
+	VolumeManagerMap = vmap
+	return nil
+}
+
 // convertSize parses the size string and convert it into bytes in integer
 func convertSize(sizeStr string) (uint64, error) {
 